@@ -3,12 +3,13 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 	"text/tabwriter"
 
@@ -19,10 +20,14 @@ import (
 	_ "github.com/docker/machine/drivers/amazonec2"
 	_ "github.com/docker/machine/drivers/azure"
 	_ "github.com/docker/machine/drivers/digitalocean"
+	_ "github.com/docker/machine/drivers/fake"
+	_ "github.com/docker/machine/drivers/generic"
 	_ "github.com/docker/machine/drivers/google"
 	_ "github.com/docker/machine/drivers/hyperv"
+	_ "github.com/docker/machine/drivers/kvm"
 	_ "github.com/docker/machine/drivers/none"
 	_ "github.com/docker/machine/drivers/openstack"
+	_ "github.com/docker/machine/drivers/plugin"
 	_ "github.com/docker/machine/drivers/rackspace"
 	_ "github.com/docker/machine/drivers/softlayer"
 	_ "github.com/docker/machine/drivers/virtualbox"
@@ -122,12 +127,134 @@ func setupCertificates(caCertPath, caKeyPath, clientCertPath, clientKeyPath stri
 	return nil
 }
 
+var swarmCreateFlags = append(
+	drivers.GetCreateFlags(),
+	cli.StringFlag{
+		Name: "driver, d",
+		Usage: fmt.Sprintf(
+			"Driver to create machines with. Available drivers: %s",
+			strings.Join(drivers.GetDriverNames(), ", "),
+		),
+		Value: "none",
+	},
+	cli.StringFlag{
+		Name:  "arch",
+		Usage: "Node architecture (amd64, 386, arm)",
+		Value: "amd64",
+	},
+	cli.IntFlag{
+		Name:  "size",
+		Usage: "Number of machines in the swarm, including the master",
+		Value: 1,
+	},
+	cli.StringFlag{
+		Name:  "swarm-discovery",
+		Usage: "Discovery service to use with Swarm (default: create a new token)",
+		Value: "",
+	},
+	cli.StringFlag{
+		Name:  "swarm-host",
+		Usage: "ip/socket to listen on for Swarm master",
+		Value: "tcp://0.0.0.0:3376",
+	},
+	cli.StringFlag{
+		Name:  "swarm-image",
+		Usage: "Swarm image to run, e.g. a pinned version from a private registry",
+		Value: "swarm:latest",
+	},
+	cli.StringFlag{
+		Name:  "swarm-strategy",
+		Usage: "Scheduling strategy for the Swarm master (spread, binpack, random)",
+		Value: "spread",
+	},
+	cli.StringSliceFlag{
+		Name:  "swarm-opt",
+		Usage: "Additional option for the Swarm master, e.g. heartbeat=5s (can be repeated)",
+		Value: &cli.StringSlice{},
+	},
+	cli.StringSliceFlag{
+		Name:  "engine-label",
+		Usage: "Label for the Docker engine, used for Swarm constraints, e.g. storage=ssd (can be repeated)",
+		Value: &cli.StringSlice{},
+	},
+	cli.StringFlag{
+		Name:  "engine-http-proxy",
+		Usage: "HTTP proxy for the Docker engine and for installing it",
+		Value: "",
+	},
+	cli.StringFlag{
+		Name:  "engine-https-proxy",
+		Usage: "HTTPS proxy for the Docker engine and for installing it",
+		Value: "",
+	},
+	cli.StringFlag{
+		Name:  "engine-no-proxy",
+		Usage: "Hosts the Docker engine connects to without a proxy",
+		Value: "",
+	},
+)
+
+// addPluginCreateFlags adds the flags of the driver plugins to the command
+// creating machines when it is the one about to run. Plugins are only asked
+// for their flags then, since that starts a process of each of them.
+func addPluginCreateFlags(app *cli.App, args cli.Args, getFlags func() []cli.Flag) {
+	commands := app.Commands
+	switch {
+	case args.First() == "create":
+	case args.First() == "swarm" && args.Get(1) == "create":
+		for i := range commands {
+			if commands[i].HasName("swarm") {
+				commands = commands[i].Subcommands
+				break
+			}
+		}
+	default:
+		return
+	}
+
+	for i := range commands {
+		if commands[i].HasName("create") {
+			commands[i].Flags = append(commands[i].Flags, getFlags()...)
+			return
+		}
+	}
+}
+
 var Commands = []cli.Command{
 	{
 		Name:   "active",
 		Usage:  "Get or set the active machine",
 		Action: cmdActive,
 	},
+	{
+		Name:  "cache",
+		Usage: "Manage the cache of boot2docker ISOs",
+		Subcommands: []cli.Command{
+			{
+				Name:   "ls",
+				Usage:  "List the cached boot2docker releases",
+				Action: cmdCacheLs,
+			},
+			{
+				Name:        "pull",
+				Usage:       "Download a boot2docker release into the cache",
+				Description: "Argument is a release, e.g. v1.5.0. Will use the latest release if none is provided.",
+				Action:      cmdCachePull,
+			},
+			{
+				Flags: []cli.Flag{
+					cli.IntFlag{
+						Name:  "keep",
+						Usage: "Number of releases to keep",
+						Value: 1,
+					},
+				},
+				Name:   "prune",
+				Usage:  "Remove all but the newest boot2docker releases from the cache",
+				Action: cmdCachePrune,
+			},
+		},
+	},
 	{
 		Flags: append(
 			drivers.GetCreateFlags(),
@@ -167,6 +294,41 @@ var Commands = []cli.Command{
 				Usage: "addr to advertise for Swarm (default: detect and use the machine IP)",
 				Value: "",
 			},
+			cli.StringFlag{
+				Name:  "swarm-image",
+				Usage: "Swarm image to run, e.g. a pinned version from a private registry",
+				Value: "swarm:latest",
+			},
+			cli.StringFlag{
+				Name:  "swarm-strategy",
+				Usage: "Scheduling strategy for the Swarm master (spread, binpack, random)",
+				Value: "spread",
+			},
+			cli.StringSliceFlag{
+				Name:  "swarm-opt",
+				Usage: "Additional option for the Swarm master, e.g. heartbeat=5s (can be repeated)",
+				Value: &cli.StringSlice{},
+			},
+			cli.StringSliceFlag{
+				Name:  "engine-label",
+				Usage: "Label for the Docker engine, used for Swarm constraints, e.g. storage=ssd (can be repeated)",
+				Value: &cli.StringSlice{},
+			},
+			cli.StringFlag{
+				Name:  "engine-http-proxy",
+				Usage: "HTTP proxy for the Docker engine and for installing it",
+				Value: "",
+			},
+			cli.StringFlag{
+				Name:  "engine-https-proxy",
+				Usage: "HTTPS proxy for the Docker engine and for installing it",
+				Value: "",
+			},
+			cli.StringFlag{
+				Name:  "engine-no-proxy",
+				Usage: "Hosts the Docker engine connects to without a proxy",
+				Value: "",
+			},
 		),
 		Name:   "create",
 		Usage:  "Create a machine",
@@ -217,6 +379,57 @@ var Commands = []cli.Command{
 		Usage:  "List machines",
 		Action: cmdLs,
 	},
+	{
+		Name:  "port",
+		Usage: "Open and close ports of a machine in its provider's firewall",
+		Subcommands: []cli.Command{
+			{
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "cidr",
+						Usage: "Only allow access from this source range, e.g. 10.0.0.0/8",
+						Value: "",
+					},
+				},
+				Name:        "open",
+				Usage:       "Open ports of a machine",
+				Description: "Arguments are a machine name and one or more ports, e.g. 80/tcp or 53/udp.",
+				Action:      cmdPortOpen,
+			},
+			{
+				Name:        "close",
+				Usage:       "Close ports opened with port open",
+				Description: "Arguments are a machine name and one or more ports, e.g. 80/tcp or 53/udp.",
+				Action:      cmdPortClose,
+			},
+			{
+				Name:        "ls",
+				Usage:       "List the ports opened on a machine",
+				Description: "Argument is a machine name. Will use the active machine if none is provided.",
+				Action:      cmdPortLs,
+			},
+		},
+	},
+	{
+		Flags: []cli.Flag{
+			cli.IntFlag{
+				Name:  "cpus",
+				Usage: "Number of CPUs",
+			},
+			cli.IntFlag{
+				Name:  "memory",
+				Usage: "Memory in MB",
+			},
+			cli.StringFlag{
+				Name:  "size",
+				Usage: "Instance size, e.g. an instance type, droplet size, machine type or flavor",
+			},
+		},
+		Name:        "resize",
+		Usage:       "Change the CPUs, memory or size of a machine, restarting it if it is running",
+		Description: "Argument is a machine name. Will use the active machine if none is provided.",
+		Action:      cmdResize,
+	},
 	{
 		Name:        "restart",
 		Usage:       "Restart a machine",
@@ -249,6 +462,74 @@ var Commands = []cli.Command{
 				Name:  "unset, u",
 				Usage: "Unset variables instead of setting them",
 			},
+			cli.StringFlag{
+				Name:  "shell",
+				Usage: "Shell to display the commands for: bash, zsh, fish, tcsh, powershell, cmd or emacs (default: detect from SHELL)",
+				Value: "",
+			},
+			cli.StringFlag{
+				Name:  "format",
+				Usage: "Display the variables as dotenv or json instead of shell commands",
+				Value: "",
+			},
+			cli.BoolFlag{
+				Name:  "no-proxy",
+				Usage: "Add the machine IP to NO_PROXY",
+			},
+		},
+	},
+	{
+		Name:  "share",
+		Usage: "Share host directories with a machine",
+		Subcommands: []cli.Command{
+			{
+				Name:        "add",
+				Usage:       "Share a host directory with a machine, restarting it if it is running",
+				Description: "Arguments are a machine name, a host directory and optionally the path to mount it at in the machine, which defaults to the host path.",
+				Action:      cmdShareAdd,
+			},
+			{
+				Name:        "rm",
+				Usage:       "Stop sharing a directory with a machine, restarting it if it is running",
+				Description: "Arguments are a machine name and the guest or host path of the shared directory.",
+				Action:      cmdShareRm,
+			},
+			{
+				Name:        "ls",
+				Usage:       "List the directories shared with a machine",
+				Description: "Argument is a machine name. Will use the active machine if none is provided.",
+				Action:      cmdShareLs,
+			},
+		},
+	},
+	{
+		Name:  "snapshot",
+		Usage: "Save and restore the state of a machine",
+		Subcommands: []cli.Command{
+			{
+				Name:        "save",
+				Usage:       "Save the state of a machine as a snapshot",
+				Description: "Arguments are a machine name and a name for the snapshot.",
+				Action:      cmdSnapshotSave,
+			},
+			{
+				Name:        "ls",
+				Usage:       "List the snapshots of a machine",
+				Description: "Argument is a machine name. Will use the active machine if none is provided.",
+				Action:      cmdSnapshotLs,
+			},
+			{
+				Name:        "restore",
+				Usage:       "Restore a machine to a snapshot, restarting it if it is running",
+				Description: "Arguments are a machine name and the name of the snapshot.",
+				Action:      cmdSnapshotRestore,
+			},
+			{
+				Name:        "rm",
+				Usage:       "Remove a snapshot",
+				Description: "Arguments are a machine name and the name of the snapshot.",
+				Action:      cmdSnapshotRm,
+			},
 		},
 	},
 	{
@@ -269,6 +550,81 @@ var Commands = []cli.Command{
 		Description: "Argument(s) are one or more machine names. Will use the active machine if none is provided.",
 		Action:      cmdStop,
 	},
+	{
+		Name:  "swarm",
+		Usage: "Create and manage Swarm clusters",
+		Subcommands: []cli.Command{
+			{
+				Name:        "create",
+				Usage:       "Create a Swarm cluster",
+				Description: "Argument is a swarm name. The master is created first, then the nodes in parallel.",
+				Action:      cmdSwarmCreate,
+				Flags:       swarmCreateFlags,
+			},
+			{
+				Name:        "inspect",
+				Usage:       "Inspect information about a Swarm cluster",
+				Description: "Argument is a swarm name.",
+				Action:      cmdSwarmInspect,
+			},
+			{
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "discovery",
+						Usage: "Discovery service of the Swarm cluster to join",
+						Value: "",
+					},
+					cli.BoolFlag{
+						Name:  "master",
+						Usage: "Configure the machine to be a Swarm master",
+					},
+					cli.StringFlag{
+						Name:  "swarm-host",
+						Usage: "ip/socket to listen on for Swarm master",
+						Value: "tcp://0.0.0.0:3376",
+					},
+					cli.StringFlag{
+						Name:  "swarm-addr",
+						Usage: "addr to advertise for Swarm (default: detect and use the machine IP)",
+						Value: "",
+					},
+				},
+				Name:        "join",
+				Usage:       "Add an existing machine to a Swarm cluster",
+				Description: "Argument is a machine name. Any previous Swarm configuration of the machine is replaced.",
+				Action:      cmdSwarmJoin,
+			},
+			{
+				Name:        "leave",
+				Usage:       "Remove a machine from its Swarm cluster",
+				Description: "Argument(s) are one or more machine names.",
+				Action:      cmdSwarmLeave,
+			},
+			{
+				Name:   "ls",
+				Usage:  "List Swarm clusters",
+				Action: cmdSwarmLs,
+			},
+			{
+				Flags: []cli.Flag{
+					cli.BoolFlag{
+						Name:  "force, f",
+						Usage: "Remove local configuration even if machines cannot be removed",
+					},
+				},
+				Name:        "rm",
+				Usage:       "Remove a Swarm cluster and all of its machines",
+				Description: "Argument(s) are one or more swarm names.",
+				Action:      cmdSwarmRm,
+			},
+			{
+				Name:        "scale",
+				Usage:       "Add or remove nodes until a Swarm cluster has the given number of machines",
+				Description: "Arguments are a swarm name and the number of machines, including the master.",
+				Action:      cmdSwarmScale,
+			},
+		},
+	},
 	{
 		Name:        "upgrade",
 		Usage:       "Upgrade a machine to the latest version of Docker",
@@ -352,6 +708,58 @@ func cmdCreate(c *cli.Context) {
 	}
 }
 
+func cmdCacheLs(c *cli.Context) {
+	cache := utils.NewISOCache(utils.GetMachineCacheDir(), utils.NewB2dUtils("", ""))
+
+	isos, err := cache.List()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 5, 1, 3, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tSIZE\tDOWNLOADED\tSHA256")
+
+	for _, iso := range isos {
+		fmt.Fprintf(w, "%s\t%d MB\t%s\t%s\n",
+			iso.Version, iso.Size/1024/1024, iso.Downloaded.Format("2006-01-02 15:04"), iso.SHA256)
+	}
+
+	w.Flush()
+}
+
+func cmdCachePull(c *cli.Context) {
+	version := c.Args().First()
+	if version == "" {
+		version = "latest"
+	}
+
+	cache := utils.NewISOCache(utils.GetMachineCacheDir(), utils.NewB2dUtils("", ""))
+
+	iso, err := cache.Pull(version)
+	if err != nil {
+		log.Fatalf("Error pulling boot2docker %s: %s", version, err)
+	}
+
+	log.Infof("boot2docker %s is in the cache at %s", iso.Version, iso.Path)
+}
+
+func cmdCachePrune(c *cli.Context) {
+	keep := c.Int("keep")
+	if keep < 0 {
+		log.Fatal("--keep must not be negative")
+	}
+
+	cache := utils.NewISOCache(utils.GetMachineCacheDir(), utils.NewB2dUtils("", ""))
+
+	removed, err := cache.Prune(keep)
+	for _, version := range removed {
+		log.Infof("Removed boot2docker %s", version)
+	}
+	if err != nil {
+		log.Fatalf("Error pruning cache: %s", err)
+	}
+}
+
 func cmdConfig(c *cli.Context) {
 	cfg, err := getMachineConfig(c)
 	if err != nil {
@@ -431,6 +839,20 @@ func cmdLs(c *cli.Context) {
 	swarmMasters := make(map[string]string)
 	swarmInfo := make(map[string]string)
 
+	// machines created with the swarm command may share a generated
+	// discovery URL with other swarms, so their membership is looked up
+	// from the swarm definitions instead
+	swarmMembers := make(map[string]string)
+	swarms, err := store.ListSwarms()
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, swarm := range swarms {
+		for _, name := range swarm.Machines() {
+			swarmMembers[name] = swarm.Master
+		}
+	}
+
 	for _, host := range hostList {
 		if !quiet {
 			if host.SwarmMaster {
@@ -467,6 +889,9 @@ func cmdLs(c *cli.Context) {
 
 		if item.SwarmDiscovery != "" {
 			swarmInfo = swarmMasters[item.SwarmDiscovery]
+			if master, ok := swarmMembers[item.Name]; ok {
+				swarmInfo = master
+			}
 			if item.SwarmMaster {
 				swarmInfo = fmt.Sprintf("%s (master)", swarmInfo)
 			}
@@ -501,18 +926,25 @@ func cmdRm(c *cli.Context) {
 }
 
 func cmdEnv(c *cli.Context) {
-	userShell := filepath.Base(os.Getenv("SHELL"))
+	shell := c.String("shell")
+	if shell == "" {
+		shell = detectShell()
+	}
+	format := c.String("format")
+
 	if c.Bool("unset") {
-		switch userShell {
-		case "fish":
-			fmt.Printf("set -e DOCKER_TLS_VERIFY;\nset -e DOCKER_CERT_PATH;\nset -e DOCKER_HOST;\n")
-		default:
-			if userShell == "." && runtime.GOOS == "windows" {
-				fmt.Println("set DOCKER_TLS_VERIFY=\nset DOCKER_CERT_PATH=\nset DOCKER_HOST=\n")
-			} else {
-				fmt.Println("unset DOCKER_TLS_VERIFY DOCKER_CERT_PATH DOCKER_HOST")
-			}
+		if format != "" {
+			log.Fatal("--unset cannot be used with --format")
+		}
+		out, err := formatEnvShell(shell, []envVar{
+			{"DOCKER_TLS_VERIFY", ""},
+			{"DOCKER_CERT_PATH", ""},
+			{"DOCKER_HOST", ""},
+		}, true)
+		if err != nil {
+			log.Fatal(err)
 		}
+		fmt.Print(out)
 		return
 	}
 
@@ -521,6 +953,14 @@ func cmdEnv(c *cli.Context) {
 		log.Fatal(err)
 	}
 
+	// get IP of machine to replace in case swarm host is 0.0.0.0
+	mUrl, err := url.Parse(cfg.machineUrl)
+	if err != nil {
+		log.Fatal(err)
+	}
+	mParts := strings.Split(mUrl.Host, ":")
+	machineIp := mParts[0]
+
 	dockerHost := cfg.machineUrl
 	if c.Bool("swarm") {
 		if !cfg.swarmMaster {
@@ -533,30 +973,33 @@ func cmdEnv(c *cli.Context) {
 		parts := strings.Split(u.Host, ":")
 		swarmPort := parts[1]
 
-		// get IP of machine to replace in case swarm host is 0.0.0.0
-		mUrl, err := url.Parse(cfg.machineUrl)
-		if err != nil {
-			log.Fatal(err)
-		}
-		mParts := strings.Split(mUrl.Host, ":")
-		machineIp := mParts[0]
-
 		dockerHost = fmt.Sprintf("tcp://%s:%s", machineIp, swarmPort)
 	}
 
-	switch userShell {
-	case "fish":
-		fmt.Printf("set -x DOCKER_TLS_VERIFY 1;\nset -x DOCKER_CERT_PATH %s;\nset -x DOCKER_HOST %s;\n",
-			cfg.machineDir, dockerHost)
-	default:
-		if userShell == "." && runtime.GOOS == "windows" {
-			fmt.Printf("set DOCKER_TLS_VERIFY=1\nset DOCKER_CERT_PATH=%s\nset DOCKER_HOST=%s\n",
-				cfg.machineDir, dockerHost)
-		} else {
-			fmt.Printf("export DOCKER_TLS_VERIFY=1\nexport DOCKER_CERT_PATH=%s\nexport DOCKER_HOST=%s\n",
-				cfg.machineDir, dockerHost)
+	vars := []envVar{
+		{"DOCKER_TLS_VERIFY", "1"},
+		{"DOCKER_CERT_PATH", cfg.machineDir},
+		{"DOCKER_HOST", dockerHost},
+	}
+
+	if c.Bool("no-proxy") {
+		noProxy := os.Getenv("NO_PROXY")
+		if noProxy == "" {
+			noProxy = os.Getenv("no_proxy")
 		}
+		vars = append(vars, envVar{"NO_PROXY", appendNoProxy(noProxy, machineIp)})
 	}
+
+	var out string
+	if format != "" {
+		out, err = formatEnvData(format, vars)
+	} else {
+		out, err = formatEnvShell(shell, vars, false)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Print(out)
 }
 
 func cmdSsh(c *cli.Context) {
@@ -601,6 +1044,8 @@ func cmdSsh(c *cli.Context) {
 // machineCommand maps the command name to the corresponding machine command.
 // We run commands concurrently and communicate back an error if there was one.
 func machineCommand(actionName string, machine *Host, errorChan chan<- error) {
+	defer machine.Close()
+
 	commands := map[string](func() error){
 		"start":   machine.Start,
 		"stop":    machine.Stop,
@@ -698,6 +1143,183 @@ func cmdStop(c *cli.Context) {
 	}
 }
 
+// getPortArgs returns the machine and the ports given as arguments to port
+// open and close
+func getPortArgs(c *cli.Context, command string) (*Host, []*drivers.Port) {
+	if len(c.Args()) < 2 {
+		cli.ShowCommandHelp(c, command)
+		log.Fatal("You must specify a machine name and at least one port")
+	}
+
+	ports := []*drivers.Port{}
+	for _, arg := range c.Args()[1:] {
+		port, err := drivers.ParsePort(arg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		port.CIDR = c.String("cidr")
+		ports = append(ports, port)
+	}
+
+	host, err := loadMachine(c.Args().First(), c)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return host, ports
+}
+
+func cmdPortOpen(c *cli.Context) {
+	if cidr := c.String("cidr"); cidr != "" {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			log.Fatalf("Invalid CIDR %q: %s", cidr, err)
+		}
+	}
+
+	host, ports := getPortArgs(c, "open")
+	if err := host.OpenPorts(ports); err != nil {
+		log.Fatalf("Error opening ports on %s: %s", host.Name, err)
+	}
+}
+
+func cmdPortClose(c *cli.Context) {
+	host, ports := getPortArgs(c, "close")
+	if err := host.ClosePorts(ports); err != nil {
+		log.Fatalf("Error closing ports on %s: %s", host.Name, err)
+	}
+}
+
+func cmdPortLs(c *cli.Context) {
+	host := getHost(c)
+
+	w := tabwriter.NewWriter(os.Stdout, 5, 1, 3, ' ', 0)
+	fmt.Fprintln(w, "PORT\tSOURCE")
+
+	for _, p := range host.Ports {
+		source := p.CIDR
+		if source == "" {
+			source = "any"
+		}
+		fmt.Fprintf(w, "%s\t%s\n", p, source)
+	}
+
+	w.Flush()
+}
+
+func cmdResize(c *cli.Context) {
+	host := getHost(c)
+	if err := host.Resize(c.Int("cpus"), c.Int("memory"), c.String("size")); err != nil {
+		log.Fatalf("Error resizing %s: %s", host.Name, err)
+	}
+}
+
+func cmdShareAdd(c *cli.Context) {
+	if len(c.Args()) < 2 {
+		cli.ShowCommandHelp(c, "add")
+		log.Fatal("You must specify a machine name and a host directory")
+	}
+
+	host, err := loadMachine(c.Args().First(), c)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := host.AddShare(c.Args().Get(1), c.Args().Get(2)); err != nil {
+		log.Fatalf("Error sharing %s with %s: %s", c.Args().Get(1), host.Name, err)
+	}
+}
+
+func cmdShareRm(c *cli.Context) {
+	if len(c.Args()) < 2 {
+		cli.ShowCommandHelp(c, "rm")
+		log.Fatal("You must specify a machine name and a shared directory")
+	}
+
+	host, err := loadMachine(c.Args().First(), c)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := host.RemoveShare(c.Args().Get(1)); err != nil {
+		log.Fatalf("Error removing share %s from %s: %s", c.Args().Get(1), host.Name, err)
+	}
+}
+
+func cmdShareLs(c *cli.Context) {
+	host := getHost(c)
+
+	shares, err := host.ListShares()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 5, 1, 3, ' ', 0)
+	fmt.Fprintln(w, "HOST PATH\tGUEST PATH")
+
+	for _, share := range shares {
+		fmt.Fprintf(w, "%s\t/%s\n", share.HostPath, share.Name)
+	}
+
+	w.Flush()
+}
+
+// getSnapshotArgs returns the machine and snapshot given as arguments to
+// snapshot save, restore and rm
+func getSnapshotArgs(c *cli.Context, command string) (*Host, string) {
+	if len(c.Args()) != 2 {
+		cli.ShowCommandHelp(c, command)
+		log.Fatal("You must specify a machine name and a snapshot name")
+	}
+
+	host, err := loadMachine(c.Args().First(), c)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return host, c.Args().Get(1)
+}
+
+func cmdSnapshotSave(c *cli.Context) {
+	host, tag := getSnapshotArgs(c, "save")
+	if err := host.SaveSnapshot(tag); err != nil {
+		log.Fatalf("Error saving snapshot %s of %s: %s", tag, host.Name, err)
+	}
+}
+
+func cmdSnapshotLs(c *cli.Context) {
+	host := getHost(c)
+
+	snapshots, err := host.ListSnapshots()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 5, 1, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tCURRENT\tID")
+
+	for _, s := range snapshots {
+		current := ""
+		if s.Current {
+			current = "*"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", s.Name, current, s.ID)
+	}
+
+	w.Flush()
+}
+
+func cmdSnapshotRestore(c *cli.Context) {
+	host, tag := getSnapshotArgs(c, "restore")
+	if err := host.RestoreSnapshot(tag); err != nil {
+		log.Fatalf("Error restoring snapshot %s of %s: %s", tag, host.Name, err)
+	}
+}
+
+func cmdSnapshotRm(c *cli.Context) {
+	host, tag := getSnapshotArgs(c, "rm")
+	if err := host.RemoveSnapshot(tag); err != nil {
+		log.Fatalf("Error removing snapshot %s of %s: %s", tag, host.Name, err)
+	}
+}
+
 func cmdRestart(c *cli.Context) {
 	if err := runActionWithContext("restart", c); err != nil {
 		log.Fatal(err)
@@ -725,6 +1347,159 @@ func cmdUrl(c *cli.Context) {
 	fmt.Println(url)
 }
 
+func cmdSwarmCreate(c *cli.Context) {
+	name := c.Args().First()
+	if name == "" {
+		cli.ShowCommandHelp(c, "create")
+		log.Fatal("You must specify a swarm name")
+	}
+
+	if err := setupCertificates(c.GlobalString("tls-ca-cert"), c.GlobalString("tls-ca-key"),
+		c.GlobalString("tls-client-cert"), c.GlobalString("tls-client-key")); err != nil {
+		log.Fatalf("Error generating certificates: %s", err)
+	}
+
+	store := NewStore(utils.GetMachineDir(), c.GlobalString("tls-ca-cert"), c.GlobalString("tls-ca-key"))
+
+	swarm, err := store.CreateSwarm(name, c.String("driver"), c.Int("size"),
+		c.String("swarm-discovery"), c.String("swarm-host"), getFlagValues(c, c.Command.Flags))
+	if err != nil {
+		log.Errorf("Error creating swarm: %s", err)
+		log.Warn("You will want to check the provider to make sure the machines and associated resources were properly removed.")
+		log.Fatal("Error creating swarm")
+	}
+
+	log.Infof("Swarm %q has been created with %d machine(s).", name, swarm.Size())
+	log.Infof("To point your Docker client at it, run this in your shell: $(%s env --swarm %s)", c.App.Name, swarm.Master)
+}
+
+func cmdSwarmScale(c *cli.Context) {
+	if len(c.Args()) != 2 {
+		cli.ShowCommandHelp(c, "scale")
+		log.Fatal("You must specify a swarm name and a size")
+	}
+
+	size, err := strconv.Atoi(c.Args()[1])
+	if err != nil {
+		log.Fatalf("Invalid swarm size %q", c.Args()[1])
+	}
+
+	store := NewStore(utils.GetMachineDir(), c.GlobalString("tls-ca-cert"), c.GlobalString("tls-ca-key"))
+
+	swarm, err := store.LoadSwarm(c.Args().First())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := store.ScaleSwarm(swarm, size); err != nil {
+		log.Fatalf("Error scaling swarm: %s", err)
+	}
+}
+
+func cmdSwarmJoin(c *cli.Context) {
+	name := c.Args().First()
+	if name == "" {
+		cli.ShowCommandHelp(c, "join")
+		log.Fatal("You must specify a machine name")
+	}
+
+	discovery := c.String("discovery")
+	if discovery == "" {
+		log.Fatal("You must specify a discovery service with --discovery")
+	}
+
+	store := NewStore(utils.GetMachineDir(), c.GlobalString("tls-ca-cert"), c.GlobalString("tls-ca-key"))
+
+	if err := store.JoinSwarm(name, discovery, c.Bool("master"), c.String("swarm-host"), c.String("swarm-addr")); err != nil {
+		log.Fatalf("Error joining swarm: %s", err)
+	}
+
+	log.Infof("%q has joined the swarm.", name)
+}
+
+func cmdSwarmLeave(c *cli.Context) {
+	if len(c.Args()) == 0 {
+		cli.ShowCommandHelp(c, "leave")
+		log.Fatal("You must specify a machine name")
+	}
+
+	isError := false
+
+	store := NewStore(utils.GetMachineDir(), c.GlobalString("tls-ca-cert"), c.GlobalString("tls-ca-key"))
+	for _, name := range c.Args() {
+		if err := store.LeaveSwarm(name); err != nil {
+			log.Errorf("Error removing %s from its swarm: %s", name, err)
+			isError = true
+		}
+	}
+	if isError {
+		log.Fatal("There was an error removing a machine from its swarm")
+	}
+}
+
+func cmdSwarmLs(c *cli.Context) {
+	store := NewStore(utils.GetMachineDir(), c.GlobalString("tls-ca-cert"), c.GlobalString("tls-ca-key"))
+
+	swarms, err := store.ListSwarms()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 5, 1, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tDRIVER\tMASTER\tSIZE\tDISCOVERY")
+
+	for _, swarm := range swarms {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n",
+			swarm.Name, swarm.DriverName, swarm.Master, swarm.Size(), swarm.Discovery)
+	}
+
+	w.Flush()
+}
+
+func cmdSwarmInspect(c *cli.Context) {
+	name := c.Args().First()
+	if name == "" {
+		cli.ShowCommandHelp(c, "inspect")
+		log.Fatal("You must specify a swarm name")
+	}
+
+	store := NewStore(utils.GetMachineDir(), c.GlobalString("tls-ca-cert"), c.GlobalString("tls-ca-key"))
+
+	swarm, err := store.LoadSwarm(name)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	prettyJSON, err := json.MarshalIndent(swarm, "", "    ")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println(string(prettyJSON))
+}
+
+func cmdSwarmRm(c *cli.Context) {
+	if len(c.Args()) == 0 {
+		cli.ShowCommandHelp(c, "rm")
+		log.Fatal("You must specify a swarm name")
+	}
+
+	force := c.Bool("force")
+
+	isError := false
+
+	store := NewStore(utils.GetMachineDir(), c.GlobalString("tls-ca-cert"), c.GlobalString("tls-ca-key"))
+	for _, name := range c.Args() {
+		if err := store.RemoveSwarm(name, force); err != nil {
+			log.Errorf("Error removing swarm %s: %s", name, err)
+			isError = true
+		}
+	}
+	if isError {
+		log.Fatal("There was an error removing a swarm. To force remove it, pass the -f option. Warning: this might leave machines running on the provider.")
+	}
+}
+
 func cmdNotFound(c *cli.Context, command string) {
 	log.Fatalf(
 		"%s: '%s' is not a %s command. See '%s --help'.",
@@ -784,6 +1559,8 @@ func getHost(c *cli.Context) *Host {
 }
 
 func getHostState(host Host, store Store, hostListItems chan<- hostListItem) {
+	defer host.Close()
+
 	currentState, err := host.Driver.GetState()
 	if err != nil {
 		log.Errorf("error getting state for host %s: %s", host.Name, err)
@@ -330,6 +330,42 @@ func TestRunActionForeachMachine(t *testing.T) {
 	}
 }
 
+func TestAddPluginCreateFlags(t *testing.T) {
+	asked := 0
+	getFlags := func() []cli.Flag {
+		asked++
+		return []cli.Flag{cli.StringFlag{Name: "plugged-region"}}
+	}
+	newApp := func() *cli.App {
+		app := cli.NewApp()
+		app.Commands = []cli.Command{
+			{Name: "create"},
+			{Name: "ls"},
+			{Name: "swarm", Subcommands: []cli.Command{{Name: "create"}}},
+		}
+		return app
+	}
+
+	// other commands do not start the plugins
+	app := newApp()
+	addPluginCreateFlags(app, cli.Args{"ls"}, getFlags)
+	if asked != 0 {
+		t.Fatal("expected the plugins not to be asked for their flags")
+	}
+
+	app = newApp()
+	addPluginCreateFlags(app, cli.Args{"create", "-d", "plugged", "test"}, getFlags)
+	if len(app.Commands[0].Flags) != 1 || len(app.Commands[2].Subcommands[0].Flags) != 0 {
+		t.Fatalf("expected the flags to be added to create only; received %v", app.Commands)
+	}
+
+	app = newApp()
+	addPluginCreateFlags(app, cli.Args{"swarm", "create", "test"}, getFlags)
+	if len(app.Commands[0].Flags) != 0 || len(app.Commands[2].Subcommands[0].Flags) != 1 {
+		t.Fatalf("expected the flags to be added to swarm create only; received %v", app.Commands)
+	}
+}
+
 func TestCmdConfig(t *testing.T) {
 	stdout := os.Stdout
 	r, w, _ := os.Pipe()
@@ -6,10 +6,12 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/url"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/codegangsta/cli"
@@ -28,44 +30,72 @@ const (
 	defaultRootSize          = 16
 	ipRange                  = "0.0.0.0/0"
 	machineSecurityGroupName = "docker-machine"
+	defaultSpotPrice         = "0.50"
+	defaultVolumeType        = "gp2"
+	rootDeviceName           = "/dev/sda1"
+	dockerDataRoot           = "/var/lib/docker"
 )
 
 var (
 	dockerPort = 2376
 	swarmPort  = 3376
+
+	// spot instance requests which are not fulfilled in time are cancelled
+	spotRequestTimeout  = 10 * time.Minute
+	spotRequestInterval = 5 * time.Second
 )
 
 type Driver struct {
-	Id                 string
-	AccessKey          string
-	SecretKey          string
-	SessionToken       string
-	Region             string
-	AMI                string
-	SSHKeyID           int
-	SSHUser            string
-	SSHPort            int
-	KeyName            string
-	InstanceId         string
-	InstanceType       string
-	IPAddress          string
-	PrivateIPAddress   string
-	MachineName        string
-	SecurityGroupId    string
-	SecurityGroupName  string
-	ReservationId      string
-	RootSize           int64
-	IamInstanceProfile string
-	VpcId              string
-	SubnetId           string
-	Zone               string
-	CaCertPath         string
-	PrivateKeyPath     string
-	SwarmMaster        bool
-	SwarmHost          string
-	SwarmDiscovery     string
-	storePath          string
-	keyPath            string
+	Id                      string
+	AccessKey               string
+	SecretKey               string
+	SessionToken            string
+	Profile                 string
+	Region                  string
+	AMI                     string
+	SSHKeyID                int
+	SSHUser                 string
+	SSHPort                 int
+	KeyName                 string
+	InstanceId              string
+	InstanceType            string
+	IPAddress               string
+	PrivateIPAddress        string
+	MachineName             string
+	SecurityGroupId         string
+	SecurityGroupIds        []string
+	SecurityGroupNames      []string
+	SecurityGroupReadOnly   bool
+	CreatedSecurityGroupIds []string
+	PortSecurityGroupId     string
+	SSHSourceRanges         []string
+	DockerSourceRanges      []string
+	ReservationId           string
+	RootSize                int64
+	VolumeType              string
+	Iops                    int64
+	Encrypted               bool
+	DockerOnVolume          bool
+	BlockDeviceMappings     []amz.BlockDeviceMapping
+	IamInstanceProfile      string
+	VpcId                   string
+	SubnetId                string
+	Zone                    string
+	RequestSpotInstance     bool
+	SpotPrice               string
+	SpotInstanceRequestId   string
+	PrivateAddressOnly      bool
+	UsePrivateAddress       bool
+	CaCertPath              string
+	PrivateKeyPath          string
+	SwarmMaster             bool
+	SwarmHost               string
+	SwarmDiscovery          string
+	storePath               string
+	keyPath                 string
+	credentials             *amz.Credentials
+	// endpoint replaces the EC2 endpoint of the region in tests
+	endpoint string
 }
 
 type CreateFlags struct {
@@ -88,23 +118,27 @@ func init() {
 
 func GetCreateFlags() []cli.Flag {
 	return []cli.Flag{
+		// keys of the environment are read by the credential chain so
+		// that they are not saved with the machine
 		cli.StringFlag{
-			Name:   "amazonec2-access-key",
-			Usage:  "AWS Access Key",
-			Value:  "",
-			EnvVar: "AWS_ACCESS_KEY_ID",
+			Name:  "amazonec2-access-key",
+			Usage: "AWS Access Key; without it, the credentials are read from the environment, the shared credentials file or the IAM role of the instance",
+			Value: "",
 		},
 		cli.StringFlag{
-			Name:   "amazonec2-secret-key",
-			Usage:  "AWS Secret Key",
-			Value:  "",
-			EnvVar: "AWS_SECRET_ACCESS_KEY",
+			Name:  "amazonec2-secret-key",
+			Usage: "AWS Secret Key",
+			Value: "",
 		},
 		cli.StringFlag{
-			Name:   "amazonec2-session-token",
-			Usage:  "AWS Session Token",
-			Value:  "",
-			EnvVar: "AWS_SESSION_TOKEN",
+			Name:  "amazonec2-session-token",
+			Usage: "AWS Session Token",
+			Value: "",
+		},
+		cli.StringFlag{
+			Name:  "amazonec2-profile",
+			Usage: "AWS shared credentials profile",
+			Value: "",
 		},
 		cli.StringFlag{
 			Name:   "amazonec2-ami",
@@ -135,12 +169,26 @@ func GetCreateFlags() []cli.Flag {
 			Value:  "",
 			EnvVar: "AWS_SUBNET_ID",
 		},
-		cli.StringFlag{
+		cli.StringSliceFlag{
 			Name:   "amazonec2-security-group",
-			Usage:  "AWS VPC security group",
-			Value:  "docker-machine",
+			Usage:  fmt.Sprintf("AWS VPC security group; repeat to attach more groups. Default: %s", machineSecurityGroupName),
+			Value:  &cli.StringSlice{},
 			EnvVar: "AWS_SECURITY_GROUP",
 		},
+		cli.BoolFlag{
+			Name:  "amazonec2-security-group-readonly",
+			Usage: "Do not modify existing security groups",
+		},
+		cli.StringSliceFlag{
+			Name:  "amazonec2-ssh-cidr",
+			Usage: "CIDR allowed to reach SSH; repeat for more. Default: anywhere, or the VPC with a private address",
+			Value: &cli.StringSlice{},
+		},
+		cli.StringSliceFlag{
+			Name:  "amazonec2-docker-cidr",
+			Usage: "CIDR allowed to reach Docker and Swarm; repeat for more. Default: anywhere, or the VPC with a private address",
+			Value: &cli.StringSlice{},
+		},
 		cli.StringFlag{
 			Name:   "amazonec2-instance-type",
 			Usage:  "AWS instance type",
@@ -153,10 +201,49 @@ func GetCreateFlags() []cli.Flag {
 			Value:  defaultRootSize,
 			EnvVar: "AWS_ROOT_SIZE",
 		},
+		cli.StringFlag{
+			Name:  "amazonec2-volume-type",
+			Usage: "AWS EBS type of the root volume (standard, gp2 or io1)",
+			Value: defaultVolumeType,
+		},
+		cli.IntFlag{
+			Name:  "amazonec2-iops",
+			Usage: "AWS EBS provisioned IOPS of the io1 volumes",
+		},
+		cli.BoolFlag{
+			Name:  "amazonec2-encrypted",
+			Usage: "Encrypt the additional EBS volumes",
+		},
+		cli.StringSliceFlag{
+			Name:  "amazonec2-volume",
+			Usage: "Additional AWS EBS volume as size[:type[:device]], e.g. 100:io1:/dev/sdf; repeat for more",
+			Value: &cli.StringSlice{},
+		},
+		cli.BoolFlag{
+			Name:  "amazonec2-docker-on-volume",
+			Usage: fmt.Sprintf("Place the Docker data root (%s) on the first additional volume", dockerDataRoot),
+		},
 		cli.StringFlag{
 			Name:  "amazonec2-iam-instance-profile",
 			Usage: "AWS IAM Instance Profile",
 		},
+		cli.BoolFlag{
+			Name:  "amazonec2-request-spot-instance",
+			Usage: "Launch the instance as a spot instance",
+		},
+		cli.StringFlag{
+			Name:  "amazonec2-spot-price",
+			Usage: "AWS spot instance maximum price per hour (in USD)",
+			Value: defaultSpotPrice,
+		},
+		cli.BoolFlag{
+			Name:  "amazonec2-private-address-only",
+			Usage: "Only use a private IP address",
+		},
+		cli.BoolFlag{
+			Name:  "amazonec2-use-private-address",
+			Usage: "Connect to the private IP address even if the instance has a public one",
+		},
 	}
 }
 
@@ -175,12 +262,108 @@ func (d *Driver) GetProviderType() provider.ProviderType {
 	return provider.Remote
 }
 
+// AuthorizePort opens ports in a security group of the machine alone, so
+// that the other machines sharing its groups keep their rules
 func (d *Driver) AuthorizePort(ports []*drivers.Port) error {
-	return nil
+	groupId, err := d.portSecurityGroup()
+	if err != nil {
+		return err
+	}
+	sourceRange, err := d.securityGroupSourceRange()
+	if err != nil {
+		return err
+	}
+	log.Debugf("authorizing ports %v in security group %s", ports, groupId)
+	return d.getClient().AuthorizeSecurityGroup(groupId, portPermissions(ports, sourceRange))
 }
 
+// DeauthorizePort closes ports opened with AuthorizePort
 func (d *Driver) DeauthorizePort(ports []*drivers.Port) error {
-	return nil
+	if d.PortSecurityGroupId == "" {
+		log.Debugf("no ports were opened on %s", d.MachineName)
+		return nil
+	}
+	sourceRange, err := d.securityGroupSourceRange()
+	if err != nil {
+		return err
+	}
+	log.Debugf("revoking ports %v in security group %s", ports, d.PortSecurityGroupId)
+	return d.getClient().RevokeSecurityGroup(d.PortSecurityGroupId, portPermissions(ports, sourceRange))
+}
+
+// ownSecurityGroupName returns the name of the security group used by the
+// machine alone
+func (d *Driver) ownSecurityGroupName() string {
+	return fmt.Sprintf("%s-%s", machineSecurityGroupName, d.MachineName)
+}
+
+// portSecurityGroup returns the security group holding the ports opened on
+// the machine. The group is created and attached to the instance the first
+// time a port is opened.
+func (d *Driver) portSecurityGroup() (string, error) {
+	if d.PortSecurityGroupId != "" {
+		return d.PortSecurityGroupId, nil
+	}
+	if d.SecurityGroupNames[0] == d.ownSecurityGroupName() {
+		d.PortSecurityGroupId = d.SecurityGroupId
+		return d.PortSecurityGroupId, nil
+	}
+
+	name := d.ownSecurityGroupName()
+	log.Debugf("creating security group (%s) in %s", name, d.VpcId)
+	group, err := d.getClient().CreateSecurityGroup(name, "Docker Machine", d.VpcId)
+	if err != nil {
+		return "", err
+	}
+
+	created := group != nil
+	if created {
+		log.Debugf("waiting for group (%s) to become available", group.GroupId)
+		if err := utils.WaitFor(d.securityGroupAvailableFunc(group.GroupId)); err != nil {
+			return "", err
+		}
+	} else {
+		// left behind by an earlier machine of the same name
+		if group, err = d.waitForSecurityGroup(name); err != nil {
+			return "", err
+		}
+	}
+
+	groupIds := append(append([]string{}, d.SecurityGroupIds...), group.GroupId)
+	if err := d.getClient().SetSecurityGroups(d.InstanceId, groupIds); err != nil {
+		if created {
+			if err := d.getClient().DeleteSecurityGroup(group.GroupId); err != nil {
+				log.Warnf("unable to delete security group %s: %s", group.GroupId, err)
+			}
+		}
+		return "", fmt.Errorf("unable to attach security group %s: %s", name, err)
+	}
+
+	d.SecurityGroupIds = groupIds
+	d.PortSecurityGroupId = group.GroupId
+	if created {
+		d.CreatedSecurityGroupIds = append(d.CreatedSecurityGroupIds, group.GroupId)
+	}
+	return group.GroupId, nil
+}
+
+// portPermissions returns the permissions opening ports to their CIDR or,
+// by default, to sourceRange
+func portPermissions(ports []*drivers.Port, sourceRange string) []amz.IpPermission {
+	perms := []amz.IpPermission{}
+	for _, p := range ports {
+		cidr := p.CIDR
+		if cidr == "" {
+			cidr = sourceRange
+		}
+		perms = append(perms, amz.IpPermission{
+			IpProtocol: p.Protocol,
+			FromPort:   p.Port,
+			ToPort:     p.Port,
+			IpRange:    cidr,
+		})
+	}
+	return perms
 }
 
 func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
@@ -197,34 +380,76 @@ func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 	d.AccessKey = flags.String("amazonec2-access-key")
 	d.SecretKey = flags.String("amazonec2-secret-key")
 	d.SessionToken = flags.String("amazonec2-session-token")
+	d.Profile = flags.String("amazonec2-profile")
 	d.Region = region
 	d.AMI = image
 	d.InstanceType = flags.String("amazonec2-instance-type")
 	d.VpcId = flags.String("amazonec2-vpc-id")
 	d.SubnetId = flags.String("amazonec2-subnet-id")
-	d.SecurityGroupName = flags.String("amazonec2-security-group")
+	d.SecurityGroupReadOnly = flags.Bool("amazonec2-security-group-readonly")
+	d.SSHSourceRanges = flags.StringSlice("amazonec2-ssh-cidr")
+	d.DockerSourceRanges = flags.StringSlice("amazonec2-docker-cidr")
+	d.SecurityGroupNames = flags.StringSlice("amazonec2-security-group")
+	if len(d.SecurityGroupNames) == 0 {
+		// restricted sources need a group the other machines do not open
+		if len(d.SSHSourceRanges) > 0 || len(d.DockerSourceRanges) > 0 {
+			d.SecurityGroupNames = []string{d.ownSecurityGroupName()}
+		} else {
+			d.SecurityGroupNames = []string{machineSecurityGroupName}
+		}
+	}
 	zone := flags.String("amazonec2-zone")
 	d.Zone = zone[:]
 	d.RootSize = int64(flags.Int("amazonec2-root-size"))
+	d.VolumeType = flags.String("amazonec2-volume-type")
+	d.Iops = int64(flags.Int("amazonec2-iops"))
+	d.Encrypted = flags.Bool("amazonec2-encrypted")
+	d.DockerOnVolume = flags.Bool("amazonec2-docker-on-volume")
 	d.IamInstanceProfile = flags.String("amazonec2-iam-instance-profile")
+	d.RequestSpotInstance = flags.Bool("amazonec2-request-spot-instance")
+	d.SpotPrice = flags.String("amazonec2-spot-price")
+	d.PrivateAddressOnly = flags.Bool("amazonec2-private-address-only")
+	d.UsePrivateAddress = flags.Bool("amazonec2-use-private-address") || d.PrivateAddressOnly
 	d.SwarmMaster = flags.Bool("swarm-master")
 	d.SwarmHost = flags.String("swarm-host")
 	d.SwarmDiscovery = flags.String("swarm-discovery")
 	d.SSHUser = "ubuntu"
 	d.SSHPort = 22
 
-	if d.AccessKey == "" {
-		return fmt.Errorf("amazonec2 driver requires the --amazonec2-access-key option")
+	if d.AccessKey == "" && d.SecretKey != "" {
+		return fmt.Errorf("amazonec2 driver requires the --amazonec2-access-key option along with --amazonec2-secret-key")
+	}
+
+	if d.SecretKey == "" && d.AccessKey != "" {
+		return fmt.Errorf("amazonec2 driver requires the --amazonec2-secret-key option along with --amazonec2-access-key")
 	}
 
-	if d.SecretKey == "" {
-		return fmt.Errorf("amazonec2 driver requires the --amazonec2-secret-key option")
+	if d.AccessKey != "" && d.Profile != "" {
+		return fmt.Errorf("the --amazonec2-profile option cannot be used with --amazonec2-access-key")
 	}
 
 	if d.SubnetId == "" && d.VpcId == "" {
 		return fmt.Errorf("amazonec2 driver requires either the --amazonec2-subnet-id or --amazonec2-vpc-id option")
 	}
 
+	if d.RequestSpotInstance {
+		if price, err := strconv.ParseFloat(d.SpotPrice, 64); err != nil || price <= 0 {
+			return fmt.Errorf("invalid spot price %q: expected a price per hour in USD, e.g. %s", d.SpotPrice, defaultSpotPrice)
+		}
+	}
+
+	mappings, err := d.blockDeviceMappings(flags.StringSlice("amazonec2-volume"))
+	if err != nil {
+		return err
+	}
+	d.BlockDeviceMappings = mappings
+
+	for _, cidr := range append(append([]string{}, d.SSHSourceRanges...), d.DockerSourceRanges...) {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("invalid CIDR %q: %s", cidr, err)
+		}
+	}
+
 	if d.isSwarmMaster() {
 		u, err := url.Parse(d.SwarmHost)
 		if err != nil {
@@ -328,19 +553,30 @@ func (d *Driver) Create() error {
 		return fmt.Errorf("unable to create key pair: %s", err)
 	}
 
-	if err := d.configureSecurityGroup(d.SecurityGroupName); err != nil {
+	if err := d.configureSecurityGroups(d.SecurityGroupNames); err != nil {
 		return err
 	}
 
-	bdm := &amz.BlockDeviceMapping{
-		DeviceName:          "/dev/sda1",
-		VolumeSize:          d.RootSize,
-		DeleteOnTermination: true,
-		VolumeType:          "gp2",
+	bdms := d.BlockDeviceMappings
+	if len(bdms) == 0 {
+		bdms = []amz.BlockDeviceMapping{
+			{
+				DeviceName:          rootDeviceName,
+				VolumeSize:          d.RootSize,
+				DeleteOnTermination: true,
+				VolumeType:          defaultVolumeType,
+			},
+		}
 	}
 
 	log.Debugf("launching instance in subnet %s", d.SubnetId)
-	instance, err := d.getClient().RunInstance(d.AMI, d.InstanceType, d.Zone, 1, 1, d.SecurityGroupId, d.KeyName, d.SubnetId, bdm, d.IamInstanceProfile)
+	var instance amz.EC2Instance
+	var err error
+	if d.RequestSpotInstance {
+		instance, err = d.launchSpotInstance(bdms)
+	} else {
+		instance, err = d.getClient().RunInstance(d.AMI, d.InstanceType, d.Zone, 1, 1, d.SecurityGroupIds, d.KeyName, d.SubnetId, bdms, d.IamInstanceProfile, d.PrivateAddressOnly)
+	}
 
 	if err != nil {
 		return fmt.Errorf("Error launching instance: %s", err)
@@ -380,6 +616,282 @@ func (d *Driver) Create() error {
 		return err
 	}
 
+	if err := d.recordVolumeIds(); err != nil {
+		return err
+	}
+
+	if d.DockerOnVolume {
+		if err := d.mountDockerVolume(); err != nil {
+			return fmt.Errorf("unable to place the Docker data root on %s: %s", d.BlockDeviceMappings[1].DeviceName, err)
+		}
+	}
+
+	return nil
+}
+
+// blockDeviceMappings returns the root volume and the additional volumes
+// given as size[:type[:device]]. The volumes are deleted along with the
+// instance.
+func (d *Driver) blockDeviceMappings(volumes []string) ([]amz.BlockDeviceMapping, error) {
+	root := amz.BlockDeviceMapping{
+		DeviceName:          rootDeviceName,
+		VolumeSize:          d.RootSize,
+		DeleteOnTermination: true,
+		VolumeType:          d.VolumeType,
+	}
+	if root.VolumeType == "" {
+		root.VolumeType = defaultVolumeType
+	}
+	if err := validateVolumeType(root.VolumeType); err != nil {
+		return nil, err
+	}
+	mappings := []amz.BlockDeviceMapping{root}
+
+	devices := map[string]bool{rootDeviceName: true}
+	for i, volume := range volumes {
+		mapping, err := parseVolume(volume, i)
+		if err != nil {
+			return nil, err
+		}
+		if devices[mapping.DeviceName] {
+			return nil, fmt.Errorf("invalid volume %q: device %s is already used", volume, mapping.DeviceName)
+		}
+		devices[mapping.DeviceName] = true
+		mapping.Encrypted = d.Encrypted
+		mappings = append(mappings, mapping)
+	}
+
+	hasIo1 := false
+	for i := range mappings {
+		if mappings[i].VolumeType != "io1" {
+			continue
+		}
+		if d.Iops <= 0 {
+			return nil, fmt.Errorf("io1 volumes require the --amazonec2-iops option")
+		}
+		mappings[i].Iops = d.Iops
+		hasIo1 = true
+	}
+	if d.Iops > 0 && !hasIo1 {
+		return nil, fmt.Errorf("the --amazonec2-iops option requires an io1 volume")
+	}
+	if d.Encrypted && len(mappings) == 1 {
+		return nil, fmt.Errorf("the --amazonec2-encrypted option requires an additional volume; the root volume is encrypted by using an encrypted AMI")
+	}
+	if d.DockerOnVolume && len(mappings) == 1 {
+		return nil, fmt.Errorf("the --amazonec2-docker-on-volume option requires an additional volume")
+	}
+
+	return mappings, nil
+}
+
+// parseVolume parses an additional volume as size[:type[:device]]; the
+// devices of volumes without one start at /dev/sdf
+func parseVolume(volume string, index int) (amz.BlockDeviceMapping, error) {
+	parts := strings.Split(volume, ":")
+	if len(parts) > 3 {
+		return amz.BlockDeviceMapping{}, fmt.Errorf("invalid volume %q: expected size[:type[:device]]", volume)
+	}
+
+	size, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || size <= 0 {
+		return amz.BlockDeviceMapping{}, fmt.Errorf("invalid volume %q: expected a size in GB", volume)
+	}
+	mapping := amz.BlockDeviceMapping{
+		DeviceName:          fmt.Sprintf("/dev/sd%c", 'f'+index),
+		VolumeSize:          size,
+		DeleteOnTermination: true,
+		VolumeType:          defaultVolumeType,
+	}
+
+	if len(parts) > 1 && parts[1] != "" {
+		mapping.VolumeType = parts[1]
+	}
+	if err := validateVolumeType(mapping.VolumeType); err != nil {
+		return amz.BlockDeviceMapping{}, fmt.Errorf("invalid volume %q: %s", volume, err)
+	}
+
+	if len(parts) > 2 && parts[2] != "" {
+		mapping.DeviceName = parts[2]
+	}
+	if !strings.HasPrefix(mapping.DeviceName, "/dev/sd") && !strings.HasPrefix(mapping.DeviceName, "/dev/xvd") {
+		return amz.BlockDeviceMapping{}, fmt.Errorf("invalid volume %q: expected a device such as /dev/sdf", volume)
+	}
+
+	return mapping, nil
+}
+
+func validateVolumeType(volumeType string) error {
+	switch volumeType {
+	case "standard", "gp2", "io1":
+		return nil
+	}
+	return fmt.Errorf("invalid volume type %s: expected standard, gp2 or io1", volumeType)
+}
+
+// recordVolumeIds records the volumes of the mappings of the running
+// instance
+func (d *Driver) recordVolumeIds() error {
+	inst, err := d.getInstance()
+	if err != nil {
+		return err
+	}
+	for i := range d.BlockDeviceMappings {
+		for _, m := range inst.BlockDeviceMapping {
+			if m.DeviceName == d.BlockDeviceMappings[i].DeviceName {
+				d.BlockDeviceMappings[i].VolumeId = m.Ebs.VolumeId
+			}
+		}
+	}
+	return nil
+}
+
+// mountDockerVolume formats the first additional volume and mounts it on
+// the Docker data root before Docker is installed
+func (d *Driver) mountDockerVolume() error {
+	log.Debug("waiting for SSH to accept the key of the machine")
+	if err := utils.WaitFor(func() bool { return d.runSSHCommand("exit 0") == nil }); err != nil {
+		return err
+	}
+
+	device := d.BlockDeviceMappings[1].DeviceName
+	log.Infof("Placing the Docker data root on %s...", device)
+	return d.runSSHCommand(dockerVolumeCommand(device))
+}
+
+// dockerVolumeCommand returns the command formatting a volume and mounting
+// it on the Docker data root. Devices attached as /dev/sdX may be named
+// /dev/xvdX by the kernel and appear after the instance starts.
+func dockerVolumeCommand(device string) string {
+	alternate := "/dev/xvd" + strings.TrimPrefix(strings.TrimPrefix(device, "/dev/sd"), "/dev/xvd")
+	return strings.Join([]string{
+		fmt.Sprintf("for i in $(seq 60); do for d in %s %s; do [ -b $d ] && dev=$d; done; [ -n \"$dev\" ] && break; sleep 1; done", device, alternate),
+		"[ -n \"$dev\" ]",
+		"sudo mkfs.ext4 -q $dev",
+		fmt.Sprintf("sudo mkdir -p %s", dockerDataRoot),
+		fmt.Sprintf("echo \"$dev %s ext4 defaults,nofail 0 2\" | sudo tee -a /etc/fstab", dockerDataRoot),
+		fmt.Sprintf("sudo mount %s", dockerDataRoot),
+	}, " && ")
+}
+
+func (d *Driver) runSSHCommand(command string) error {
+	cmd, err := drivers.GetSSHCommandFromDriver(d, command)
+	if err != nil {
+		return err
+	}
+	return cmd.Run()
+}
+
+// launchSpotInstance requests a spot instance and waits for AWS to launch
+// it. A request which is not fulfilled in time, or whose instance cannot be
+// described, is cancelled.
+func (d *Driver) launchSpotInstance(bdms []amz.BlockDeviceMapping) (amz.EC2Instance, error) {
+	log.Infof("Requesting spot instance at a maximum price of $%s per hour...", d.SpotPrice)
+	request, err := d.getClient().RequestSpotInstance(d.SpotPrice, d.AMI, d.InstanceType, d.Zone, d.SecurityGroupIds, d.KeyName, d.SubnetId, bdms, d.IamInstanceProfile, d.PrivateAddressOnly)
+	if err != nil {
+		return amz.EC2Instance{}, err
+	}
+	d.SpotInstanceRequestId = request.SpotInstanceRequestId
+
+	log.Infof("Waiting for spot instance request %s to be fulfilled...", d.SpotInstanceRequestId)
+	if err := d.waitForSpotInstanceRequest(); err != nil {
+		d.abandonSpotInstanceRequest()
+		return amz.EC2Instance{}, err
+	}
+
+	instance, err := d.waitForSpotInstance()
+	if err != nil {
+		d.abandonSpotInstanceRequest()
+		return amz.EC2Instance{}, err
+	}
+	return instance, nil
+}
+
+// waitForSpotInstance returns the instance launched by the spot instance
+// request once EC2 describes it, which may take a while after the request
+// recorded it
+func (d *Driver) waitForSpotInstance() (amz.EC2Instance, error) {
+	deadline := time.Now().Add(spotRequestTimeout)
+	for {
+		instance, err := d.getClient().GetInstance(d.InstanceId)
+		if err == nil {
+			return instance, nil
+		}
+		if !time.Now().Before(deadline) {
+			return amz.EC2Instance{}, fmt.Errorf("unable to describe spot instance %s: %s", d.InstanceId, err)
+		}
+		log.Debugf("spot instance %s is not visible yet: %s", d.InstanceId, err)
+		time.Sleep(spotRequestInterval)
+	}
+}
+
+func (d *Driver) waitForSpotInstanceRequest() error {
+	deadline := time.Now().Add(spotRequestTimeout)
+	status := "unknown"
+	for time.Now().Before(deadline) {
+		request, err := d.getClient().GetSpotInstanceRequest(d.SpotInstanceRequestId)
+		if err != nil {
+			log.Debug(err)
+		} else if request == nil {
+			log.Debugf("spot instance request %s is not visible yet", d.SpotInstanceRequestId)
+		} else {
+			status = request.StatusMessage()
+			log.Debugf("spot instance request %s is %s: %s", d.SpotInstanceRequestId, request.State, status)
+			if request.InstanceId != "" {
+				d.InstanceId = request.InstanceId
+				return nil
+			}
+			if request.IsFinal() {
+				return fmt.Errorf("spot instance request %s is %s: %s", d.SpotInstanceRequestId, request.State, status)
+			}
+		}
+		time.Sleep(spotRequestInterval)
+	}
+	return fmt.Errorf("spot instance request %s was not fulfilled within %s: %s", d.SpotInstanceRequestId, spotRequestTimeout, status)
+}
+
+// abandonSpotInstanceRequest cancels a spot instance request whose launch
+// failed and terminates any instance it launched, as the machine is not
+// saved when its creation fails
+func (d *Driver) abandonSpotInstanceRequest() {
+	if err := d.cancelSpotInstanceRequest(); err != nil {
+		log.Warnf("unable to cancel spot instance request %s: %s", d.SpotInstanceRequestId, err)
+	}
+	if d.InstanceId == "" {
+		return
+	}
+	if err := d.terminate(); err != nil {
+		log.Warnf("unable to terminate spot instance %s, which must be terminated in AWS: %s", d.InstanceId, err)
+		return
+	}
+	d.InstanceId = ""
+}
+
+// cancelSpotInstanceRequest cancels the spot instance request of the
+// machine if it is still open, recording the instance it launched before
+// it was cancelled
+func (d *Driver) cancelSpotInstanceRequest() error {
+	request, err := d.getClient().GetSpotInstanceRequest(d.SpotInstanceRequestId)
+	if err != nil {
+		return err
+	}
+	// AWS purges requests some hours after they close
+	if request == nil || !request.IsOpen() {
+		return nil
+	}
+
+	log.Debugf("cancelling spot instance request: %s", d.SpotInstanceRequestId)
+	if err := d.getClient().CancelSpotInstanceRequest(d.SpotInstanceRequestId); err != nil {
+		return err
+	}
+
+	request, err = d.getClient().GetSpotInstanceRequest(d.SpotInstanceRequestId)
+	if err != nil {
+		return err
+	}
+	if request != nil && request.InstanceId != "" {
+		d.InstanceId = request.InstanceId
+	}
 	return nil
 }
 
@@ -396,10 +908,17 @@ func (d *Driver) GetIP() (string, error) {
 		return "", err
 	}
 
+	if d.UsePrivateAddress {
+		return inst.PrivateIpAddress, nil
+	}
 	return inst.IpAddress, nil
 }
 
 func (d *Driver) GetState() (state.State, error) {
+	if d.InstanceId == "" && d.SpotInstanceRequestId != "" {
+		return state.Error, fmt.Errorf("spot instance request %s was not fulfilled", d.SpotInstanceRequestId)
+	}
+
 	inst, err := d.getInstance()
 	if err != nil {
 		return state.Error, err
@@ -415,12 +934,32 @@ func (d *Driver) GetState() (state.State, error) {
 		return state.Stopping, nil
 	case "stopped":
 		return state.Stopped, nil
+	case "terminated":
+		if d.SpotInstanceRequestId != "" {
+			return state.Error, d.spotInstanceTerminatedError(inst)
+		}
+		return state.Error, nil
 	default:
 		return state.Error, nil
 	}
 	return state.None, nil
 }
 
+// spotInstanceTerminatedError tells whether AWS reclaimed the terminated
+// spot instance of the machine
+func (d *Driver) spotInstanceTerminatedError(inst *amz.EC2Instance) error {
+	request, err := d.getClient().GetSpotInstanceRequest(d.SpotInstanceRequestId)
+	if err != nil {
+		log.Debug(err)
+	} else if request != nil && request.Reclaimed() {
+		return fmt.Errorf("spot instance %s was reclaimed by AWS: %s", d.InstanceId, request.StatusMessage())
+	}
+	if inst.StateReason.Code == "Server.SpotInstanceTermination" {
+		return fmt.Errorf("spot instance %s was reclaimed by AWS: %s", d.InstanceId, inst.StateReason.Message)
+	}
+	return fmt.Errorf("spot instance %s was terminated", d.InstanceId)
+}
+
 func (d *Driver) GetSSHHostname() (string, error) {
 	// TODO: use @nathanleclaire retry func here (ehazlett)
 	return d.GetIP()
@@ -462,9 +1001,17 @@ func (d *Driver) Stop() error {
 }
 
 func (d *Driver) Remove() error {
+	if d.SpotInstanceRequestId != "" {
+		if err := d.cancelSpotInstanceRequest(); err != nil {
+			return fmt.Errorf("unable to cancel spot instance request: %s", err)
+		}
+	}
 
-	if err := d.terminate(); err != nil {
-		return fmt.Errorf("unable to terminate instance: %s", err)
+	// an unfulfilled spot instance request has no instance
+	if d.InstanceId != "" || d.SpotInstanceRequestId == "" {
+		if err := d.terminate(); err != nil {
+			return fmt.Errorf("unable to terminate instance: %s", err)
+		}
 	}
 
 	// remove keypair
@@ -472,6 +1019,8 @@ func (d *Driver) Remove() error {
 		return fmt.Errorf("unable to remove key pair: %s", err)
 	}
 
+	d.deleteSecurityGroups()
+
 	return nil
 }
 
@@ -489,9 +1038,35 @@ func (d *Driver) Kill() error {
 	return nil
 }
 
+// Resize changes the instance type of the stopped instance
+func (d *Driver) Resize(cpus int, memory int, size string) error {
+	if cpus > 0 || memory > 0 {
+		return fmt.Errorf("the CPUs and memory of EC2 instances are set by their type; use --size to choose an instance type")
+	}
+	if err := d.getClient().SetInstanceType(d.InstanceId, size); err != nil {
+		return err
+	}
+	d.InstanceType = size
+	return nil
+}
+
+// getClient returns a client using the keys given on creation or, without
+// them, the AWS credential chain, whose credentials are never saved
 func (d *Driver) getClient() *amz.EC2 {
-	auth := amz.GetAuth(d.AccessKey, d.SecretKey, d.SessionToken)
-	return amz.NewEC2(auth, d.Region)
+	var client *amz.EC2
+	if d.AccessKey != "" {
+		auth := amz.GetAuth(d.AccessKey, d.SecretKey, d.SessionToken)
+		client = amz.NewEC2(auth, d.Region)
+	} else {
+		if d.credentials == nil {
+			d.credentials = amz.NewChainCredentials(d.Profile)
+		}
+		client = amz.NewEC2WithCredentials(d.credentials, d.Region)
+	}
+	if d.endpoint != "" {
+		client.Endpoint = d.endpoint
+	}
+	return client
 }
 
 func (d *Driver) GetSSHKeyPath() string {
@@ -577,111 +1152,298 @@ func (d *Driver) securityGroupAvailableFunc(id string) func() bool {
 	}
 }
 
-func (d *Driver) configureSecurityGroup(groupName string) error {
-	log.Debugf("configuring security group in %s", d.VpcId)
-
-	var securityGroup *amz.SecurityGroup
+// configureSecurityGroups finds or creates the security groups of the
+// machine. The first group holds the rules Machine adds, unless it existed
+// and groups are read-only; the others are attached as they are.
+func (d *Driver) configureSecurityGroups(groupNames []string) error {
+	log.Debugf("configuring security groups in %s", d.VpcId)
 
 	groups, err := d.getClient().GetSecurityGroups()
 	if err != nil {
 		return err
 	}
 
-	for _, grp := range groups {
-		if grp.GroupName == groupName {
+	d.SecurityGroupIds = []string{}
+	for i, groupName := range groupNames {
+		securityGroup := findSecurityGroup(groups, groupName)
+		if securityGroup != nil {
 			log.Debugf("found existing security group (%s) in %s", groupName, d.VpcId)
-			securityGroup = &grp
-			break
 		}
-	}
 
-	// if not found, create
-	if securityGroup == nil {
-		log.Debugf("creating security group (%s) in %s", groupName, d.VpcId)
-		group, err := d.getClient().CreateSecurityGroup(groupName, "Docker Machine", d.VpcId)
+		if securityGroup == nil && i > 0 {
+			return fmt.Errorf("security group %s not found; only the first security group is created", groupName)
+		}
+
+		// if not found, create
+		created := false
+		if securityGroup == nil {
+			log.Debugf("creating security group (%s) in %s", groupName, d.VpcId)
+			group, err := d.getClient().CreateSecurityGroup(groupName, "Docker Machine", d.VpcId)
+			if err != nil {
+				return err
+			}
+			if group == nil {
+				// a machine created in parallel created the group first
+				log.Debugf("security group (%s) was created meanwhile", groupName)
+				if securityGroup, err = d.waitForSecurityGroup(groupName); err != nil {
+					return err
+				}
+			} else {
+				securityGroup = group
+				// wait until created (dat eventual consistency)
+				log.Debugf("waiting for group (%s) to become available", group.GroupId)
+				if err := utils.WaitFor(d.securityGroupAvailableFunc(group.GroupId)); err != nil {
+					return err
+				}
+				d.CreatedSecurityGroupIds = append(d.CreatedSecurityGroupIds, group.GroupId)
+				created = true
+			}
+		}
+
+		d.SecurityGroupIds = append(d.SecurityGroupIds, securityGroup.GroupId)
+		if i > 0 {
+			continue
+		}
+		d.SecurityGroupId = securityGroup.GroupId
+
+		if !created {
+			if err := d.checkSourceRanges(securityGroup); err != nil {
+				return err
+			}
+		}
+
+		if d.SecurityGroupReadOnly && !created {
+			log.Debugf("not modifying read-only security group %s", groupName)
+			continue
+		}
+
+		sshRanges, err := d.sourceRanges(d.SSHSourceRanges)
 		if err != nil {
 			return err
 		}
-		securityGroup = group
-		// wait until created (dat eventual consistency)
-		log.Debugf("waiting for group (%s) to become available", group.GroupId)
-		if err := utils.WaitFor(d.securityGroupAvailableFunc(group.GroupId)); err != nil {
+		dockerRanges, err := d.sourceRanges(d.DockerSourceRanges)
+		if err != nil {
 			return err
 		}
+		perms := d.configureSecurityGroupPermissions(securityGroup, sshRanges, dockerRanges)
+		if !created {
+			warnWidenedPermissions(securityGroup, perms)
+		}
+
+		if len(perms) != 0 {
+			log.Debugf("authorizing group %s with permissions: %v", securityGroup.GroupName, perms)
+			if err := d.getClient().AuthorizeSecurityGroup(d.SecurityGroupId, perms); err != nil {
+				// a machine created in parallel may have added some of them
+				group, getErr := d.getClient().GetSecurityGroupById(d.SecurityGroupId)
+				if getErr != nil || group == nil {
+					return err
+				}
+				if perms = d.configureSecurityGroupPermissions(group, sshRanges, dockerRanges); len(perms) != 0 {
+					if err := d.getClient().AuthorizeSecurityGroup(d.SecurityGroupId, perms); err != nil {
+						return err
+					}
+				}
+			}
+		}
 	}
 
-	d.SecurityGroupId = securityGroup.GroupId
+	return nil
+}
 
-	perms := d.configureSecurityGroupPermissions(securityGroup)
+func findSecurityGroup(groups []amz.SecurityGroup, name string) *amz.SecurityGroup {
+	for i := range groups {
+		if groups[i].GroupName == name {
+			return &groups[i]
+		}
+	}
+	return nil
+}
 
-	if len(perms) != 0 {
-		log.Debugf("authorizing group %s with permissions: %v", securityGroup.GroupName, perms)
-		if err := d.getClient().AuthorizeSecurityGroup(d.SecurityGroupId, perms); err != nil {
-			return err
+// waitForSecurityGroup returns the security group named name once it is
+// visible
+func (d *Driver) waitForSecurityGroup(name string) (*amz.SecurityGroup, error) {
+	var group *amz.SecurityGroup
+	err := utils.WaitFor(func() bool {
+		groups, err := d.getClient().GetSecurityGroups()
+		if err != nil {
+			log.Debug(err)
+			return false
 		}
+		group = findSecurityGroup(groups, name)
+		return group != nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("security group %s not found: %s", name, err)
+	}
+	return group, nil
+}
 
+// checkSourceRanges returns an error if an existing group lets the ports
+// restricted with --amazonec2-ssh-cidr or --amazonec2-docker-cidr be reached
+// from other sources, since adding rules cannot restrict them
+func (d *Driver) checkSourceRanges(group *amz.SecurityGroup) error {
+	ports := []int{22, dockerPort}
+	cidrs := [][]string{d.SSHSourceRanges, d.DockerSourceRanges}
+	if d.SwarmMaster {
+		ports = append(ports, swarmPort)
+		cidrs = append(cidrs, d.DockerSourceRanges)
 	}
 
+	for i, port := range ports {
+		if len(cidrs[i]) == 0 {
+			continue
+		}
+		for _, p := range group.IpPermissions {
+			for _, r := range p.AllowedRanges(port) {
+				if !cidrsContain(cidrs[i], r) {
+					return fmt.Errorf("security group %s already allows port %d from %s; use a security group of the machine alone to restrict it", group.GroupName, port, r)
+				}
+			}
+		}
+	}
 	return nil
 }
 
-func (d *Driver) configureSecurityGroupPermissions(group *amz.SecurityGroup) []amz.IpPermission {
-	hasSshPort := false
-	hasDockerPort := false
-	hasSwarmPort := false
-	for _, p := range group.IpPermissions {
-		switch p.FromPort {
-		case 22:
-			hasSshPort = true
-		case dockerPort:
-			hasDockerPort = true
-		case swarmPort:
-			hasSwarmPort = true
+// cidrsContain reports whether every address of cidr is in one of cidrs
+func cidrsContain(cidrs []string, cidr string) bool {
+	ip, inner, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return false
+	}
+	innerOnes, innerBits := inner.Mask.Size()
+	for _, c := range cidrs {
+		_, outer, err := net.ParseCIDR(c)
+		if err != nil {
+			continue
+		}
+		ones, bits := outer.Mask.Size()
+		if bits == innerBits && ones <= innerOnes && outer.Contains(ip) {
+			return true
 		}
 	}
+	return false
+}
 
-	perms := []amz.IpPermission{}
+// warnWidenedPermissions warns about the permissions opening a port of an
+// existing group to more sources than the other machines in it allowed
+func warnWidenedPermissions(group *amz.SecurityGroup, perms []amz.IpPermission) {
+	for _, perm := range perms {
+		allowed := []string{}
+		for _, p := range group.IpPermissions {
+			allowed = append(allowed, p.AllowedRanges(perm.FromPort)...)
+		}
+		if len(allowed) > 0 {
+			log.Warnf("security group %s only allows port %d from %s; allowing it from %s too", group.GroupName, perm.FromPort, strings.Join(allowed, ", "), perm.IpRange)
+		}
+	}
+}
 
-	if !hasSshPort {
-		perms = append(perms, amz.IpPermission{
-			IpProtocol: "tcp",
-			FromPort:   22,
-			ToPort:     22,
-			IpRange:    ipRange,
-		})
+// sourceRanges returns the given CIDRs or, by default, the CIDR the ports
+// of the machine are opened to
+func (d *Driver) sourceRanges(cidrs []string) ([]string, error) {
+	if len(cidrs) > 0 {
+		return cidrs, nil
 	}
+	sourceRange, err := d.securityGroupSourceRange()
+	if err != nil {
+		return nil, err
+	}
+	return []string{sourceRange}, nil
+}
 
-	if !hasDockerPort {
-		perms = append(perms, amz.IpPermission{
-			IpProtocol: "tcp",
-			FromPort:   dockerPort,
-			ToPort:     dockerPort,
-			IpRange:    ipRange,
-		})
+// securityGroupSourceRange returns the CIDR the ports of the machine are
+// opened to: anywhere, or only the VPC of the machine when it is reached on
+// its private address
+func (d *Driver) securityGroupSourceRange() (string, error) {
+	if !d.UsePrivateAddress {
+		return ipRange, nil
 	}
 
-	if !hasSwarmPort && d.SwarmMaster {
-		perms = append(perms, amz.IpPermission{
-			IpProtocol: "tcp",
-			FromPort:   swarmPort,
-			ToPort:     swarmPort,
-			IpRange:    ipRange,
-		})
+	vpcId := d.VpcId
+	if vpcId == "" {
+		subnets, err := d.getClient().GetSubnets([]amz.Filter{{Name: "subnet-id", Value: d.SubnetId}})
+		if err != nil {
+			return "", err
+		}
+		if len(subnets) == 0 {
+			return "", fmt.Errorf("unable to find the subnet %s", d.SubnetId)
+		}
+		vpcId = subnets[0].VpcId
+	}
+
+	vpc, err := d.getClient().GetVpc(vpcId)
+	if err != nil {
+		return "", err
+	}
+	return vpc.CidrBlock, nil
+}
+
+// configureSecurityGroupPermissions returns the permissions missing from
+// group to reach SSH from sshRanges and Docker and Swarm from dockerRanges
+func (d *Driver) configureSecurityGroupPermissions(group *amz.SecurityGroup, sshRanges []string, dockerRanges []string) []amz.IpPermission {
+	perms := []amz.IpPermission{}
+	perms = appendMissingPermissions(perms, group, 22, sshRanges)
+	perms = appendMissingPermissions(perms, group, dockerPort, dockerRanges)
+	if d.SwarmMaster {
+		perms = appendMissingPermissions(perms, group, swarmPort, dockerRanges)
 	}
 
-	log.Debugf("configuring security group authorization for %s", ipRange)
+	log.Debugf("configuring security group authorization for SSH from %v and Docker from %v", sshRanges, dockerRanges)
 
 	return perms
 }
 
-func (d *Driver) deleteSecurityGroup() error {
-	log.Debugf("deleting security group %s", d.SecurityGroupId)
+// appendMissingPermissions appends the permissions opening port to the
+// CIDRs group does not open it to
+func appendMissingPermissions(perms []amz.IpPermission, group *amz.SecurityGroup, port int, cidrs []string) []amz.IpPermission {
+	for _, cidr := range cidrs {
+		allowed := false
+		for _, p := range group.IpPermissions {
+			allowed = allowed || p.Allows(port, cidr)
+		}
+		if !allowed {
+			perms = append(perms, amz.IpPermission{
+				IpProtocol: "tcp",
+				FromPort:   port,
+				ToPort:     port,
+				IpRange:    cidr,
+			})
+		}
+	}
+	return perms
+}
 
-	if err := d.getClient().DeleteSecurityGroup(d.SecurityGroupId); err != nil {
-		return err
+// deleteSecurityGroups deletes the security groups created for the
+// machine once its instance is terminated. Groups still used by other
+// machines are kept.
+func (d *Driver) deleteSecurityGroups() {
+	if len(d.CreatedSecurityGroupIds) == 0 {
+		return
 	}
 
-	return nil
+	if d.InstanceId != "" {
+		log.Debugf("waiting for instance %s to terminate", d.InstanceId)
+		if err := utils.WaitFor(d.instanceIsTerminated); err != nil {
+			log.Warnf("unable to delete the security groups of %s before its instance terminates: %s", d.MachineName, err)
+			return
+		}
+	}
+
+	for _, id := range d.CreatedSecurityGroupIds {
+		log.Debugf("deleting security group %s", id)
+		if err := d.getClient().DeleteSecurityGroup(id); err != nil {
+			log.Warnf("unable to delete security group %s, which may be used by other machines: %s", id, err)
+		}
+	}
+}
+
+func (d *Driver) instanceIsTerminated() bool {
+	inst, err := d.getInstance()
+	if err != nil {
+		log.Debug(err)
+		return false
+	}
+	return inst.InstanceState.Name == "terminated"
 }
 
 func (d *Driver) deleteKeyPair() error {
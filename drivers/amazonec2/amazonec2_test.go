@@ -1,10 +1,18 @@
 package amazonec2
 
 import (
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/docker/machine/drivers"
 	"github.com/docker/machine/drivers/amazonec2/amz"
 )
 
@@ -35,6 +43,10 @@ func (d DriverOptionsMock) String(key string) string {
 	return d.Data[key].(string)
 }
 
+func (d DriverOptionsMock) StringSlice(key string) []string {
+	return d.Data[key].([]string)
+}
+
 func (d DriverOptionsMock) Int(key string) int {
 	return d.Data[key].(int)
 }
@@ -59,24 +71,37 @@ func getTestStorePath() (string, error) {
 func getDefaultTestDriverFlags() *DriverOptionsMock {
 	return &DriverOptionsMock{
 		Data: map[string]interface{}{
-			"name":                           "test",
-			"url":                            "unix:///var/run/docker.sock",
-			"swarm":                          false,
-			"swarm-host":                     "",
-			"swarm-master":                   false,
-			"swarm-discovery":                "",
-			"amazonec2-ami":                  "ami-12345",
-			"amazonec2-access-key":           "abcdefg",
-			"amazonec2-secret-key":           "12345",
-			"amazonec2-session-token":        "",
-			"amazonec2-instance-type":        "t1.micro",
-			"amazonec2-vpc-id":               "vpc-12345",
-			"amazonec2-subnet-id":            "subnet-12345",
-			"amazonec2-security-group":       "docker-machine-test",
-			"amazonec2-region":               "us-east-1",
-			"amazonec2-zone":                 "e",
-			"amazonec2-root-size":            10,
-			"amazonec2-iam-instance-profile": "",
+			"name":                              "test",
+			"url":                               "unix:///var/run/docker.sock",
+			"swarm":                             false,
+			"swarm-host":                        "",
+			"swarm-master":                      false,
+			"swarm-discovery":                   "",
+			"amazonec2-ami":                     "ami-12345",
+			"amazonec2-access-key":              "abcdefg",
+			"amazonec2-secret-key":              "12345",
+			"amazonec2-session-token":           "",
+			"amazonec2-profile":                 "",
+			"amazonec2-instance-type":           "t1.micro",
+			"amazonec2-vpc-id":                  "vpc-12345",
+			"amazonec2-subnet-id":               "subnet-12345",
+			"amazonec2-security-group":          []string{"docker-machine-test"},
+			"amazonec2-security-group-readonly": false,
+			"amazonec2-ssh-cidr":                []string{},
+			"amazonec2-docker-cidr":             []string{},
+			"amazonec2-region":                  "us-east-1",
+			"amazonec2-zone":                    "e",
+			"amazonec2-root-size":               10,
+			"amazonec2-volume-type":             "gp2",
+			"amazonec2-iops":                    0,
+			"amazonec2-encrypted":               false,
+			"amazonec2-volume":                  []string{},
+			"amazonec2-docker-on-volume":        false,
+			"amazonec2-iam-instance-profile":    "",
+			"amazonec2-request-spot-instance":   false,
+			"amazonec2-spot-price":              "0.50",
+			"amazonec2-private-address-only":    false,
+			"amazonec2-use-private-address":     false,
 		},
 	}
 }
@@ -105,7 +130,7 @@ func TestConfigureSecurityGroupPermissionsEmpty(t *testing.T) {
 	defer cleanup()
 
 	group := securityGroup
-	perms := d.configureSecurityGroupPermissions(&group)
+	perms := d.configureSecurityGroupPermissions(&group, []string{ipRange}, []string{ipRange})
 	if len(perms) != 2 {
 		t.Fatalf("expected 2 permissions; received %d", len(perms))
 	}
@@ -125,10 +150,11 @@ func TestConfigureSecurityGroupPermissionsSshOnly(t *testing.T) {
 			IpProtocol: "tcp",
 			FromPort:   testSshPort,
 			ToPort:     testSshPort,
+			IpRanges:   []string{ipRange},
 		},
 	}
 
-	perms := d.configureSecurityGroupPermissions(&group)
+	perms := d.configureSecurityGroupPermissions(&group, []string{ipRange}, []string{ipRange})
 	if len(perms) != 1 {
 		t.Fatalf("expected 1 permission; received %d", len(perms))
 	}
@@ -153,10 +179,11 @@ func TestConfigureSecurityGroupPermissionsDockerOnly(t *testing.T) {
 			IpProtocol: "tcp",
 			FromPort:   testDockerPort,
 			ToPort:     testDockerPort,
+			IpRanges:   []string{ipRange},
 		},
 	}
 
-	perms := d.configureSecurityGroupPermissions(&group)
+	perms := d.configureSecurityGroupPermissions(&group, []string{ipRange}, []string{ipRange})
 	if len(perms) != 1 {
 		t.Fatalf("expected 1 permission; received %d", len(perms))
 	}
@@ -181,20 +208,633 @@ func TestConfigureSecurityGroupPermissionsDockerAndSsh(t *testing.T) {
 			IpProtocol: "tcp",
 			FromPort:   testSshPort,
 			ToPort:     testSshPort,
+			IpRanges:   []string{ipRange},
 		},
 		{
 			IpProtocol: "tcp",
 			FromPort:   testDockerPort,
 			ToPort:     testDockerPort,
+			IpRanges:   []string{ipRange},
 		},
 	}
 
-	perms := d.configureSecurityGroupPermissions(&group)
+	perms := d.configureSecurityGroupPermissions(&group, []string{ipRange}, []string{ipRange})
 	if len(perms) != 0 {
 		t.Fatalf("expected 0 permissions; received %d", len(perms))
 	}
 }
 
+func TestConfigureSecurityGroupPermissionsPrivate(t *testing.T) {
+	d, err := getTestDriver()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	group := securityGroup
+	perms := d.configureSecurityGroupPermissions(&group, []string{"172.31.0.0/16"}, []string{"172.31.0.0/16"})
+	if len(perms) != 2 {
+		t.Fatalf("expected 2 permissions; received %d", len(perms))
+	}
+	for _, p := range perms {
+		if p.IpRange != "172.31.0.0/16" {
+			t.Fatalf("expected permissions scoped to the VPC; received %+v", p)
+		}
+	}
+
+	perms = portPermissions([]*drivers.Port{{Protocol: "tcp", Port: 80}}, "172.31.0.0/16")
+	if perms[0].IpRange != "172.31.0.0/16" {
+		t.Fatalf("expected the port scoped to the VPC; received %+v", perms[0])
+	}
+}
+
+func TestSetConfigFromFlagsPrivateAddress(t *testing.T) {
+	d, err := getTestDriver()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	if d.UsePrivateAddress || d.PrivateAddressOnly {
+		t.Fatal("expected the public address to be used by default")
+	}
+	if sourceRange, err := d.securityGroupSourceRange(); err != nil || sourceRange != ipRange {
+		t.Fatalf("expected ports opened to %s; received %s (%v)", ipRange, sourceRange, err)
+	}
+
+	flags := getDefaultTestDriverFlags()
+	flags.Data["amazonec2-use-private-address"] = true
+	if err := d.SetConfigFromFlags(flags); err != nil {
+		t.Fatal(err)
+	}
+	if !d.UsePrivateAddress || d.PrivateAddressOnly {
+		t.Fatal("expected the private address to be used along with a public one")
+	}
+
+	flags = getDefaultTestDriverFlags()
+	flags.Data["amazonec2-private-address-only"] = true
+	if err := d.SetConfigFromFlags(flags); err != nil {
+		t.Fatal(err)
+	}
+	if !d.UsePrivateAddress || !d.PrivateAddressOnly {
+		t.Fatal("expected only the private address to be used")
+	}
+}
+
+func TestConfigureSecurityGroupPermissionsCIDRs(t *testing.T) {
+	d, err := getTestDriver()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	group := securityGroup
+	group.IpPermissions = []amz.IpPermission{
+		{
+			IpProtocol: "tcp",
+			FromPort:   testSshPort,
+			ToPort:     testSshPort,
+			IpRanges:   []string{"10.0.0.0/8"},
+		},
+	}
+
+	perms := d.configureSecurityGroupPermissions(&group, []string{"10.0.0.0/8", "192.168.0.0/16"}, []string{"10.0.0.0/8"})
+	if len(perms) != 2 {
+		t.Fatalf("expected 2 permissions; received %d", len(perms))
+	}
+	if perms[0].FromPort != testSshPort || perms[0].IpRange != "192.168.0.0/16" {
+		t.Fatalf("expected SSH from 192.168.0.0/16; received %+v", perms[0])
+	}
+	if perms[1].FromPort != testDockerPort || perms[1].IpRange != "10.0.0.0/8" {
+		t.Fatalf("expected Docker from 10.0.0.0/8; received %+v", perms[1])
+	}
+}
+
+func TestSetConfigFromFlagsSecurityGroups(t *testing.T) {
+	d, err := getTestDriver()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	flags := getDefaultTestDriverFlags()
+	flags.Data["amazonec2-security-group"] = []string{}
+	if err := d.SetConfigFromFlags(flags); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.SecurityGroupNames) != 1 || d.SecurityGroupNames[0] != machineSecurityGroupName {
+		t.Fatalf("expected the default security group; received %v", d.SecurityGroupNames)
+	}
+
+	// restricted sources get a group of the machine instead of the shared one
+	flags.Data["amazonec2-docker-cidr"] = []string{"10.0.0.0/8"}
+	if err := d.SetConfigFromFlags(flags); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.SecurityGroupNames) != 1 || d.SecurityGroupNames[0] != "docker-machine-"+machineTestName {
+		t.Fatalf("expected the security group of the machine; received %v", d.SecurityGroupNames)
+	}
+	flags.Data["amazonec2-docker-cidr"] = []string{}
+
+	flags.Data["amazonec2-security-group"] = []string{"docker", "monitoring"}
+	flags.Data["amazonec2-ssh-cidr"] = []string{"10.0.0.0/8"}
+	if err := d.SetConfigFromFlags(flags); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.SecurityGroupNames) != 2 || len(d.SSHSourceRanges) != 1 {
+		t.Fatalf("unexpected security groups %v and SSH sources %v", d.SecurityGroupNames, d.SSHSourceRanges)
+	}
+	if ranges, err := d.sourceRanges(d.DockerSourceRanges); err != nil || len(ranges) != 1 || ranges[0] != ipRange {
+		t.Fatalf("expected Docker opened to %s by default; received %v (%v)", ipRange, ranges, err)
+	}
+
+	flags.Data["amazonec2-docker-cidr"] = []string{"10.0.0.0"}
+	if err := d.SetConfigFromFlags(flags); err == nil {
+		t.Fatal("expected an error for an invalid CIDR")
+	}
+}
+
+func TestConfigureSecurityGroupsCreatedInParallel(t *testing.T) {
+	d, err := getTestDriver()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.VpcId = "vpc-1"
+	described := 0
+	server, calls := testEC2Server(d, func(v url.Values) (int, string) {
+		switch v.Get("Action") {
+		case "DescribeSecurityGroups":
+			described++
+			// another machine creates the group after it was first listed
+			if described == 1 {
+				return http.StatusOK, `<DescribeSecurityGroupsResponse><securityGroupInfo/></DescribeSecurityGroupsResponse>`
+			}
+			return http.StatusOK, `<DescribeSecurityGroupsResponse><securityGroupInfo><item>
+  <groupName>docker-machine</groupName><groupId>sg-other</groupId><vpcId>vpc-1</vpcId>
+  <ipPermissions>
+    <item><ipProtocol>tcp</ipProtocol><fromPort>22</fromPort><toPort>22</toPort><ipRanges><item><cidrIp>0.0.0.0/0</cidrIp></item></ipRanges></item>
+    <item><ipProtocol>tcp</ipProtocol><fromPort>2376</fromPort><toPort>2376</toPort><ipRanges><item><cidrIp>0.0.0.0/0</cidrIp></item></ipRanges></item>
+  </ipPermissions>
+</item></securityGroupInfo></DescribeSecurityGroupsResponse>`
+		case "CreateSecurityGroup":
+			return http.StatusBadRequest, `<Response><Errors><Error><Code>InvalidGroup.Duplicate</Code><Message>The security group 'docker-machine' already exists</Message></Error></Errors></Response>`
+		}
+		return http.StatusOK, "<Response><return>true</return></Response>"
+	})
+	defer server.Close()
+
+	if err := d.configureSecurityGroups([]string{"docker-machine"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if d.SecurityGroupId != "sg-other" || len(d.SecurityGroupIds) != 1 {
+		t.Fatalf("expected the existing group sg-other to be used; received %s %v", d.SecurityGroupId, d.SecurityGroupIds)
+	}
+	if len(d.CreatedSecurityGroupIds) != 0 {
+		t.Fatalf("expected the existing group not to be recorded as created; received %v", d.CreatedSecurityGroupIds)
+	}
+	for _, v := range *calls {
+		if v.Get("Action") == "AuthorizeSecurityGroupIngress" {
+			t.Fatalf("expected no permissions to be added; received %v", v)
+		}
+	}
+}
+
+func TestConfigureSecurityGroupsWiderSourceRange(t *testing.T) {
+	d, err := getTestDriver()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.DockerSourceRanges = []string{"10.0.0.0/8"}
+	server, calls := testEC2Server(d, func(v url.Values) (int, string) {
+		if v.Get("Action") == "DescribeSecurityGroups" {
+			return http.StatusOK, `<DescribeSecurityGroupsResponse><securityGroupInfo><item>
+  <groupName>docker-machine-test</groupName><groupId>sg-1</groupId><vpcId>vpc-12345</vpcId>
+  <ipPermissions>
+    <item><ipProtocol>tcp</ipProtocol><fromPort>2376</fromPort><toPort>2376</toPort><ipRanges><item><cidrIp>0.0.0.0/0</cidrIp></item></ipRanges></item>
+  </ipPermissions>
+</item></securityGroupInfo></DescribeSecurityGroupsResponse>`
+		}
+		return http.StatusOK, "<Response><return>true</return></Response>"
+	})
+	defer server.Close()
+
+	// Docker would stay open to anywhere through the existing rule
+	if err := d.configureSecurityGroups([]string{"docker-machine-test"}); err == nil || !strings.Contains(err.Error(), "0.0.0.0/0") {
+		t.Fatalf("expected an error for the rule from 0.0.0.0/0; received %v", err)
+	}
+	for _, v := range *calls {
+		if v.Get("Action") == "AuthorizeSecurityGroupIngress" {
+			t.Fatalf("expected no permissions to be added; received %v", v)
+		}
+	}
+
+	// rules within the given ranges are fine
+	d.DockerSourceRanges = []string{"0.0.0.0/0"}
+	if err := d.configureSecurityGroups([]string{"docker-machine-test"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCidrsContain(t *testing.T) {
+	cidrs := []string{"10.0.0.0/8", "192.168.1.0/24"}
+	for _, cidr := range []string{"10.0.0.0/8", "10.1.0.0/16", "192.168.1.128/25"} {
+		if !cidrsContain(cidrs, cidr) {
+			t.Fatalf("expected %s to be contained in %v", cidr, cidrs)
+		}
+	}
+	for _, cidr := range []string{"0.0.0.0/0", "192.168.0.0/16", "172.16.0.0/12"} {
+		if cidrsContain(cidrs, cidr) {
+			t.Fatalf("expected %s not to be contained in %v", cidr, cidrs)
+		}
+	}
+}
+
+func TestParseVolume(t *testing.T) {
+	expected := map[string]amz.BlockDeviceMapping{
+		"100":                  {DeviceName: "/dev/sdg", VolumeSize: 100, VolumeType: "gp2", DeleteOnTermination: true},
+		"500:io1":              {DeviceName: "/dev/sdg", VolumeSize: 500, VolumeType: "io1", DeleteOnTermination: true},
+		"50:standard:/dev/sdh": {DeviceName: "/dev/sdh", VolumeSize: 50, VolumeType: "standard", DeleteOnTermination: true},
+		"50::/dev/xvdk":        {DeviceName: "/dev/xvdk", VolumeSize: 50, VolumeType: "gp2", DeleteOnTermination: true},
+	}
+	for volume, mapping := range expected {
+		received, err := parseVolume(volume, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if received != mapping {
+			t.Fatalf("expected %+v for %s; received %+v", mapping, volume, received)
+		}
+	}
+
+	for _, volume := range []string{"", "big", "0", "10:sc1", "10:gp2:sdf", "10:gp2:/dev/sdf:x"} {
+		if _, err := parseVolume(volume, 0); err == nil {
+			t.Fatalf("expected an error for volume %q", volume)
+		}
+	}
+}
+
+func TestBlockDeviceMappings(t *testing.T) {
+	d := &Driver{RootSize: 16, VolumeType: "gp2", Iops: 4000, Encrypted: true}
+	mappings, err := d.blockDeviceMappings([]string{"500:io1", "100"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mappings) != 3 {
+		t.Fatalf("expected 3 volumes; received %d", len(mappings))
+	}
+	if root := mappings[0]; root.DeviceName != rootDeviceName || root.VolumeSize != 16 || root.Encrypted || root.Iops != 0 {
+		t.Fatalf("unexpected root volume %+v", root)
+	}
+	if data := mappings[1]; data.DeviceName != "/dev/sdf" || data.Iops != 4000 || !data.Encrypted {
+		t.Fatalf("unexpected io1 volume %+v", data)
+	}
+	if extra := mappings[2]; extra.DeviceName != "/dev/sdg" || extra.Iops != 0 || !extra.Encrypted {
+		t.Fatalf("unexpected gp2 volume %+v", extra)
+	}
+
+	invalid := map[string]struct {
+		driver  Driver
+		volumes []string
+	}{
+		"io1 without IOPS":      {Driver{RootSize: 16, VolumeType: "io1"}, nil},
+		"IOPS without io1":      {Driver{RootSize: 16, Iops: 100}, []string{"100"}},
+		"unknown root type":     {Driver{RootSize: 16, VolumeType: "sc1"}, nil},
+		"duplicate device":      {Driver{RootSize: 16}, []string{"100:gp2:/dev/sdg", "100"}},
+		"encrypted root only":   {Driver{RootSize: 16, Encrypted: true}, nil},
+		"Docker without volume": {Driver{RootSize: 16, DockerOnVolume: true}, nil},
+	}
+	for name, c := range invalid {
+		if _, err := c.driver.blockDeviceMappings(c.volumes); err == nil {
+			t.Fatalf("expected an error for %s", name)
+		}
+	}
+}
+
+func TestSetConfigFromFlagsVolumes(t *testing.T) {
+	d, err := getTestDriver()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	flags := getDefaultTestDriverFlags()
+	flags.Data["amazonec2-volume"] = []string{"500:io1"}
+	flags.Data["amazonec2-iops"] = 4000
+	flags.Data["amazonec2-docker-on-volume"] = true
+	if err := d.SetConfigFromFlags(flags); err != nil {
+		t.Fatal(err)
+	}
+
+	// the volumes are saved with the machine
+	data, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := Driver{}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if len(saved.BlockDeviceMappings) != 2 || saved.BlockDeviceMappings[1].VolumeSize != 500 || saved.BlockDeviceMappings[1].Iops != 4000 || !saved.DockerOnVolume {
+		t.Fatalf("unexpected saved volumes %+v", saved.BlockDeviceMappings)
+	}
+}
+
+func TestDockerVolumeCommand(t *testing.T) {
+	command := dockerVolumeCommand("/dev/sdf")
+	for _, expected := range []string{"/dev/sdf /dev/xvdf", "sudo mkfs.ext4 -q $dev", "/var/lib/docker ext4", "sudo mount /var/lib/docker"} {
+		if !strings.Contains(command, expected) {
+			t.Fatalf("expected %q in %s", expected, command)
+		}
+	}
+}
+
+func TestPortPermissions(t *testing.T) {
+	perms := portPermissions([]*drivers.Port{
+		{Protocol: "tcp", Port: 80},
+		{Protocol: "udp", Port: 53, CIDR: "10.0.0.0/8"},
+	}, ipRange)
+	if len(perms) != 2 {
+		t.Fatalf("expected 2 permissions; received %d", len(perms))
+	}
+	if perms[0].IpProtocol != "tcp" || perms[0].FromPort != 80 || perms[0].ToPort != 80 || perms[0].IpRange != ipRange {
+		t.Fatalf("unexpected permission %+v", perms[0])
+	}
+	if perms[1].IpProtocol != "udp" || perms[1].FromPort != 53 || perms[1].IpRange != "10.0.0.0/8" {
+		t.Fatalf("unexpected permission %+v", perms[1])
+	}
+}
+
+// testEC2Server answers the EC2 API calls of d with the responses of
+// respond, keyed by action, and records their parameters
+func testEC2Server(d *Driver, respond func(v url.Values) (int, string)) (*httptest.Server, *[]url.Values) {
+	calls := []url.Values{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v := r.URL.Query()
+		calls = append(calls, v)
+		code, body := respond(v)
+		w.WriteHeader(code)
+		fmt.Fprint(w, body)
+	}))
+	d.AccessKey, d.SecretKey = "access", "secret"
+	d.endpoint = server.URL
+	return server, &calls
+}
+
+func TestOpenAndClosePortWithCIDR(t *testing.T) {
+	d, err := getTestDriver()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.InstanceId = "i-1"
+	d.SecurityGroupId = "sg-1"
+	d.SecurityGroupIds = []string{"sg-1"}
+	server, calls := testEC2Server(d, func(v url.Values) (int, string) {
+		switch v.Get("Action") {
+		case "CreateSecurityGroup":
+			return http.StatusOK, `<CreateSecurityGroupResponse><groupId>sg-port</groupId></CreateSecurityGroupResponse>`
+		case "DescribeSecurityGroups":
+			return http.StatusOK, `<DescribeSecurityGroupsResponse><securityGroupInfo><item>
+  <groupName>docker-machine-test</groupName><groupId>sg-port</groupId>
+</item></securityGroupInfo></DescribeSecurityGroupsResponse>`
+		}
+		return http.StatusOK, "<Response><return>true</return></Response>"
+	})
+	defer server.Close()
+
+	// closing ports before any was opened leaves the groups alone
+	port := &drivers.Port{Protocol: "tcp", Port: 8080, CIDR: "10.0.0.0/8"}
+	if err := d.DeauthorizePort([]*drivers.Port{port}); err != nil {
+		t.Fatal(err)
+	}
+	if len(*calls) != 0 {
+		t.Fatalf("expected no calls; received %v", *calls)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := d.AuthorizePort([]*drivers.Port{port}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.DeauthorizePort([]*drivers.Port{port}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the group of the machine is created and attached once
+	expected := []string{"CreateSecurityGroup", "DescribeSecurityGroups", "ModifyInstanceAttribute", "AuthorizeSecurityGroupIngress", "AuthorizeSecurityGroupIngress", "RevokeSecurityGroupIngress"}
+	if len(*calls) != len(expected) {
+		t.Fatalf("expected %d calls; received %v", len(expected), *calls)
+	}
+	for i, v := range *calls {
+		if v.Get("Action") != expected[i] {
+			t.Fatalf("expected %s; received %v", expected[i], v)
+		}
+	}
+
+	create, attach := (*calls)[0], (*calls)[2]
+	if create.Get("GroupName") != "docker-machine-"+d.MachineName {
+		t.Fatalf("expected a group of the machine; received %v", create)
+	}
+	if attach.Get("InstanceId") != "i-1" || attach.Get("GroupId.1") != "sg-1" || attach.Get("GroupId.2") != "sg-port" {
+		t.Fatalf("expected sg-port to be attached along with sg-1; received %v", attach)
+	}
+	for _, v := range (*calls)[3:] {
+		if v.Get("GroupId") != "sg-port" {
+			t.Fatalf("expected the rule to be changed in sg-port; received %v", v)
+		}
+		if v.Get("IpPermissions.1.FromPort") != "8080" || v.Get("IpPermissions.1.IpRanges.1.CidrIp") != "10.0.0.0/8" {
+			t.Fatalf("expected 8080/tcp from 10.0.0.0/8; received %v", v)
+		}
+	}
+
+	if d.PortSecurityGroupId != "sg-port" || len(d.CreatedSecurityGroupIds) != 1 || d.CreatedSecurityGroupIds[0] != "sg-port" {
+		t.Fatalf("expected sg-port to be recorded and deleted with the machine; received %s %v", d.PortSecurityGroupId, d.CreatedSecurityGroupIds)
+	}
+}
+
+func TestLaunchSpotInstanceTerminatesAbandonedInstance(t *testing.T) {
+	savedTimeout, savedInterval := spotRequestTimeout, spotRequestInterval
+	spotRequestTimeout, spotRequestInterval = time.Millisecond, time.Millisecond
+	defer func() { spotRequestTimeout, spotRequestInterval = savedTimeout, savedInterval }()
+
+	d, err := getTestDriver()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancelled := false
+	server, calls := testEC2Server(d, func(v url.Values) (int, string) {
+		switch v.Get("Action") {
+		case "RequestSpotInstances":
+			return http.StatusOK, `<RequestSpotInstancesResponse><spotInstanceRequestSet><item>
+  <spotInstanceRequestId>sir-1</spotInstanceRequestId><state>open</state>
+</item></spotInstanceRequestSet></RequestSpotInstancesResponse>`
+		case "DescribeSpotInstanceRequests":
+			// the request launches an instance while it is cancelled
+			if cancelled {
+				return http.StatusOK, `<DescribeSpotInstanceRequestsResponse><spotInstanceRequestSet><item>
+  <spotInstanceRequestId>sir-1</spotInstanceRequestId><state>cancelled</state><instanceId>i-1</instanceId>
+</item></spotInstanceRequestSet></DescribeSpotInstanceRequestsResponse>`
+			}
+			return http.StatusOK, `<DescribeSpotInstanceRequestsResponse><spotInstanceRequestSet><item>
+  <spotInstanceRequestId>sir-1</spotInstanceRequestId><state>open</state>
+</item></spotInstanceRequestSet></DescribeSpotInstanceRequestsResponse>`
+		case "CancelSpotInstanceRequests":
+			cancelled = true
+		}
+		return http.StatusOK, "<Response><return>true</return></Response>"
+	})
+	defer server.Close()
+
+	if _, err := d.launchSpotInstance(nil); err == nil {
+		t.Fatal("expected an error for an unfulfilled spot instance request")
+	}
+
+	last := (*calls)[len(*calls)-1]
+	if last.Get("Action") != "TerminateInstances" || last.Get("InstanceId.1") != "i-1" {
+		t.Fatalf("expected instance i-1 to be terminated; last call was %v", last)
+	}
+	if d.InstanceId != "" {
+		t.Fatalf("expected the terminated instance to be forgotten; received %s", d.InstanceId)
+	}
+}
+
+func TestLaunchSpotInstanceTerminatesUndescribedInstance(t *testing.T) {
+	savedTimeout, savedInterval := spotRequestTimeout, spotRequestInterval
+	spotRequestTimeout, spotRequestInterval = 10*time.Millisecond, time.Millisecond
+	defer func() { spotRequestTimeout, spotRequestInterval = savedTimeout, savedInterval }()
+
+	d, err := getTestDriver()
+	if err != nil {
+		t.Fatal(err)
+	}
+	described := 0
+	server, calls := testEC2Server(d, func(v url.Values) (int, string) {
+		switch v.Get("Action") {
+		case "RequestSpotInstances":
+			return http.StatusOK, `<RequestSpotInstancesResponse><spotInstanceRequestSet><item>
+  <spotInstanceRequestId>sir-1</spotInstanceRequestId><state>open</state>
+</item></spotInstanceRequestSet></RequestSpotInstancesResponse>`
+		case "DescribeSpotInstanceRequests":
+			return http.StatusOK, `<DescribeSpotInstanceRequestsResponse><spotInstanceRequestSet><item>
+  <spotInstanceRequestId>sir-1</spotInstanceRequestId><state>active</state><instanceId>i-1</instanceId>
+</item></spotInstanceRequestSet></DescribeSpotInstanceRequestsResponse>`
+		case "DescribeInstances":
+			// the instance never becomes visible
+			described++
+			return http.StatusBadRequest, `<Response><Errors><Error><Code>InvalidInstanceID.NotFound</Code><Message>The instance ID 'i-1' does not exist</Message></Error></Errors></Response>`
+		}
+		return http.StatusOK, "<Response><return>true</return></Response>"
+	})
+	defer server.Close()
+
+	if _, err := d.launchSpotInstance(nil); err == nil {
+		t.Fatal("expected an error for an instance which cannot be described")
+	}
+	if described < 2 {
+		t.Fatalf("expected the instance to be described until the timeout; described %d times", described)
+	}
+
+	last := (*calls)[len(*calls)-1]
+	if last.Get("Action") != "TerminateInstances" || last.Get("InstanceId.1") != "i-1" {
+		t.Fatalf("expected instance i-1 to be terminated; last call was %v", last)
+	}
+}
+
+func TestRemovePurgedSpotInstanceRequest(t *testing.T) {
+	d, err := getTestDriver()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.SpotInstanceRequestId, d.InstanceId, d.KeyName = "sir-1", "i-1", "test-host"
+	server, calls := testEC2Server(d, func(v url.Values) (int, string) {
+		if v.Get("Action") == "DescribeSpotInstanceRequests" {
+			return http.StatusBadRequest, `<Response><Errors><Error><Code>InvalidSpotInstanceRequestID.NotFound</Code><Message>The spot instance request ID 'sir-1' does not exist</Message></Error></Errors></Response>`
+		}
+		return http.StatusOK, "<Response><return>true</return></Response>"
+	})
+	defer server.Close()
+
+	if err := d.Remove(); err != nil {
+		t.Fatal(err)
+	}
+
+	actions := []string{}
+	for _, v := range *calls {
+		actions = append(actions, v.Get("Action"))
+	}
+	if strings.Join(actions, ",") != "DescribeSpotInstanceRequests,TerminateInstances,DeleteKeyPair" {
+		t.Fatalf("expected the instance and key pair to be removed; received calls %v", actions)
+	}
+}
+
+func TestSetConfigFromFlagsSpotPrice(t *testing.T) {
+	d, err := getTestDriver()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	flags := getDefaultTestDriverFlags()
+	flags.Data["amazonec2-request-spot-instance"] = true
+	if err := d.SetConfigFromFlags(flags); err != nil {
+		t.Fatal(err)
+	}
+	if !d.RequestSpotInstance || d.SpotPrice != "0.50" {
+		t.Fatalf("expected a spot instance at 0.50; received %v at %q", d.RequestSpotInstance, d.SpotPrice)
+	}
+
+	for _, price := range []string{"", "cheap", "0", "-1"} {
+		flags.Data["amazonec2-spot-price"] = price
+		if err := d.SetConfigFromFlags(flags); err == nil {
+			t.Fatalf("expected an error for spot price %q", price)
+		}
+	}
+
+	flags.Data["amazonec2-request-spot-instance"] = false
+	if err := d.SetConfigFromFlags(flags); err != nil {
+		t.Fatalf("expected the spot price to be ignored without a spot instance; received %s", err)
+	}
+}
+
+func TestSetConfigFromFlagsCredentials(t *testing.T) {
+	d, err := getTestDriver()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	if d.getClient().Credentials != nil {
+		t.Fatal("expected the client to use the given keys")
+	}
+
+	flags := getDefaultTestDriverFlags()
+	flags.Data["amazonec2-access-key"] = ""
+	flags.Data["amazonec2-secret-key"] = ""
+	flags.Data["amazonec2-profile"] = "ci"
+	if err := d.SetConfigFromFlags(flags); err != nil {
+		t.Fatal(err)
+	}
+	if d.getClient().Credentials == nil {
+		t.Fatal("expected the client to use the credential chain")
+	}
+	data, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"AccessKey":""`) || !strings.Contains(string(data), `"Profile":"ci"`) {
+		t.Fatalf("expected the profile and no keys in the configuration; received %s", data)
+	}
+
+	flags.Data["amazonec2-access-key"] = "abcdefg"
+	if err := d.SetConfigFromFlags(flags); err == nil {
+		t.Fatal("expected an error for an access key without a secret key")
+	}
+	flags.Data["amazonec2-secret-key"] = "12345"
+	if err := d.SetConfigFromFlags(flags); err == nil {
+		t.Fatal("expected an error for keys along with a profile")
+	}
+}
+
 func TestAwsRegionList(t *testing.T) {
 }
 
@@ -1,9 +1,14 @@
 package amz
 
+// BlockDeviceMapping describes an EBS volume of an instance to launch.
+// VolumeId is only known once the instance runs.
 type BlockDeviceMapping struct {
 	DeviceName          string
 	VirtualName         string
 	VolumeSize          int64
 	DeleteOnTermination bool
 	VolumeType          string
+	Iops                int64
+	Encrypted           bool
+	VolumeId            string
 }
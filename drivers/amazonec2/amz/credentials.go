@@ -0,0 +1,269 @@
+package amz
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/machine/utils"
+)
+
+const (
+	// DefaultMetadataEndpoint lists the IAM roles of the EC2 instance
+	// Machine runs on
+	DefaultMetadataEndpoint = "http://169.254.169.254/latest/meta-data/iam/security-credentials/"
+
+	// expiring credentials are refreshed this long before they expire
+	expiryWindow = 5 * time.Minute
+
+	// outside EC2 the metadata address does not answer
+	metadataTimeout = 2 * time.Second
+)
+
+// metadataClient talks to the metadata address of the instance directly, as
+// a proxy from the environment could neither reach it nor be trusted with
+// the credentials it returns
+var metadataClient = &http.Client{
+	Timeout:   metadataTimeout,
+	Transport: &http.Transport{Proxy: nil},
+}
+
+// Provider retrieves AWS credentials along with the time they expire,
+// which is zero for credentials which do not expire
+type Provider interface {
+	Retrieve() (Auth, time.Time, error)
+}
+
+// Credentials caches the credentials of a provider until shortly before
+// they expire
+type Credentials struct {
+	provider   Provider
+	auth       Auth
+	expiration time.Time
+	retrieved  bool
+	mu         sync.Mutex
+}
+
+func NewCredentials(provider Provider) *Credentials {
+	return &Credentials{provider: provider}
+}
+
+// NewChainCredentials returns the credentials of the environment, of the
+// shared credentials file or of the IAM role of the instance, whichever is
+// found first. A profile of the shared credentials file is used alone.
+func NewChainCredentials(profile string) *Credentials {
+	if profile != "" {
+		return NewCredentials(&SharedCredentialsProvider{Profile: profile})
+	}
+	return NewCredentials(&ChainProvider{Providers: []Provider{
+		&EnvProvider{},
+		&SharedCredentialsProvider{},
+		&InstanceMetadataProvider{},
+	}})
+}
+
+// Get returns the cached credentials, retrieving them again when they are
+// about to expire
+func (c *Credentials) Get() (Auth, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.retrieved || c.isExpired() {
+		auth, expiration, err := c.provider.Retrieve()
+		if err != nil {
+			return Auth{}, err
+		}
+		c.auth, c.expiration, c.retrieved = auth, expiration, true
+	}
+	return c.auth, nil
+}
+
+func (c *Credentials) isExpired() bool {
+	return !c.expiration.IsZero() && time.Now().Add(expiryWindow).After(c.expiration)
+}
+
+// ChainProvider returns the credentials of the first of its providers
+// which has some
+type ChainProvider struct {
+	Providers []Provider
+}
+
+func (p *ChainProvider) Retrieve() (Auth, time.Time, error) {
+	errs := []string{}
+	for _, provider := range p.Providers {
+		auth, expiration, err := provider.Retrieve()
+		if err == nil {
+			return auth, expiration, nil
+		}
+		errs = append(errs, err.Error())
+	}
+	return Auth{}, time.Time{}, fmt.Errorf("no AWS credentials found: %s", strings.Join(errs, "; "))
+}
+
+// EnvProvider reads the credentials of the standard environment variables
+type EnvProvider struct{}
+
+func (p *EnvProvider) Retrieve() (Auth, time.Time, error) {
+	auth := Auth{
+		AccessKey:    firstEnv("AWS_ACCESS_KEY_ID", "AWS_ACCESS_KEY"),
+		SecretKey:    firstEnv("AWS_SECRET_ACCESS_KEY", "AWS_SECRET_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if auth.AccessKey == "" || auth.SecretKey == "" {
+		return Auth{}, time.Time{}, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are not set")
+	}
+	return auth, time.Time{}, nil
+}
+
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// SharedCredentialsProvider reads a profile of the credentials file shared
+// by the AWS tools. The file defaults to AWS_SHARED_CREDENTIALS_FILE or
+// ~/.aws/credentials and the profile to AWS_PROFILE or default.
+type SharedCredentialsProvider struct {
+	Filename string
+	Profile  string
+}
+
+func (p *SharedCredentialsProvider) Retrieve() (Auth, time.Time, error) {
+	filename := p.Filename
+	if filename == "" {
+		filename = firstEnv("AWS_SHARED_CREDENTIALS_FILE")
+	}
+	if filename == "" {
+		filename = filepath.Join(utils.GetHomeDir(), ".aws", "credentials")
+	}
+	profile := p.Profile
+	if profile == "" {
+		profile = firstEnv("AWS_PROFILE")
+	}
+	if profile == "" {
+		profile = "default"
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return Auth{}, time.Time{}, fmt.Errorf("unable to read the shared credentials file: %s", err)
+	}
+	defer f.Close()
+
+	values, found, err := readProfile(bufio.NewScanner(f), profile)
+	if err != nil {
+		return Auth{}, time.Time{}, fmt.Errorf("error reading %s: %s", filename, err)
+	}
+	if !found {
+		return Auth{}, time.Time{}, fmt.Errorf("profile %s not found in %s", profile, filename)
+	}
+
+	auth := Auth{
+		AccessKey:    values["aws_access_key_id"],
+		SecretKey:    values["aws_secret_access_key"],
+		SessionToken: values["aws_session_token"],
+	}
+	if auth.AccessKey == "" || auth.SecretKey == "" {
+		return Auth{}, time.Time{}, fmt.Errorf("profile %s of %s has no aws_access_key_id or aws_secret_access_key", profile, filename)
+	}
+	return auth, time.Time{}, nil
+}
+
+// readProfile reads the keys of a section of an INI file
+func readProfile(scanner *bufio.Scanner, profile string) (map[string]string, bool, error) {
+	values := map[string]string{}
+	found, inProfile := false, false
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			inProfile = strings.TrimSpace(line[1:len(line)-1]) == profile
+			found = found || inProfile
+		case inProfile:
+			parts := strings.SplitN(line, "=", 2)
+			if len(parts) != 2 {
+				return nil, false, fmt.Errorf("invalid line %q", line)
+			}
+			values[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+	return values, found, scanner.Err()
+}
+
+// InstanceMetadataProvider retrieves the temporary credentials of the IAM
+// role of the EC2 instance Machine runs on. They expire within hours and
+// are retrieved again by Credentials before they do.
+type InstanceMetadataProvider struct {
+	Endpoint string
+}
+
+type metadataCredentials struct {
+	Code            string
+	Message         string
+	AccessKeyId     string
+	SecretAccessKey string
+	Token           string
+	Expiration      time.Time
+}
+
+func (p *InstanceMetadataProvider) Retrieve() (Auth, time.Time, error) {
+	endpoint := p.Endpoint
+	if endpoint == "" {
+		endpoint = DefaultMetadataEndpoint
+	}
+	if !strings.HasSuffix(endpoint, "/") {
+		endpoint += "/"
+	}
+	client := metadataClient
+
+	roles, err := metadataGet(client, endpoint)
+	if err != nil {
+		return Auth{}, time.Time{}, fmt.Errorf("unable to get the IAM role of the instance: %s", err)
+	}
+	role := strings.TrimSpace(strings.SplitN(strings.TrimSpace(string(roles)), "\n", 2)[0])
+	if role == "" {
+		return Auth{}, time.Time{}, fmt.Errorf("the instance has no IAM role")
+	}
+
+	data, err := metadataGet(client, endpoint+role)
+	if err != nil {
+		return Auth{}, time.Time{}, fmt.Errorf("unable to get the credentials of the IAM role %s: %s", role, err)
+	}
+	creds := metadataCredentials{}
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return Auth{}, time.Time{}, fmt.Errorf("error decoding the credentials of the IAM role %s: %s", role, err)
+	}
+	if creds.Code != "Success" {
+		return Auth{}, time.Time{}, fmt.Errorf("unable to get the credentials of the IAM role %s: %s %s", role, creds.Code, creds.Message)
+	}
+
+	return Auth{
+		AccessKey:    creds.AccessKeyId,
+		SecretKey:    creds.SecretAccessKey,
+		SessionToken: creds.Token,
+	}, creds.Expiration, nil
+}
+
+func metadataGet(client *http.Client, url string) ([]byte, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
@@ -0,0 +1,235 @@
+package amz
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testSharedCredentials = `# comment
+[default]
+aws_access_key_id = default-key
+aws_secret_access_key = default-secret
+
+[ci]
+aws_access_key_id=ci-key
+aws_secret_access_key=ci-secret
+aws_session_token=ci-token
+
+[empty]
+`
+
+// testMetadataServer stands in for the instance metadata of an instance
+// with a role whose credentials expire after ttl
+func testMetadataServer(ttl time.Duration) (*httptest.Server, *int) {
+	count := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/latest/meta-data/iam/security-credentials/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ci-role")
+	})
+	mux.HandleFunc("/latest/meta-data/iam/security-credentials/ci-role", func(w http.ResponseWriter, r *http.Request) {
+		count++
+		fmt.Fprintf(w, `{
+  "Code" : "Success",
+  "LastUpdated" : "2015-03-01T10:00:00Z",
+  "Type" : "AWS-HMAC",
+  "AccessKeyId" : "role-key",
+  "SecretAccessKey" : "role-secret",
+  "Token" : "role-token-%d",
+  "Expiration" : "%s"
+}`, count, time.Now().Add(ttl).UTC().Format(time.RFC3339))
+	})
+	return httptest.NewServer(mux), &count
+}
+
+func setEnv(t *testing.T, values map[string]string) func() {
+	saved := map[string]string{}
+	for name, value := range values {
+		saved[name] = os.Getenv(name)
+		if err := os.Setenv(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return func() {
+		for name, value := range saved {
+			os.Setenv(name, value)
+		}
+	}
+}
+
+func TestEnvProvider(t *testing.T) {
+	defer setEnv(t, map[string]string{
+		"AWS_ACCESS_KEY_ID":     "env-key",
+		"AWS_SECRET_ACCESS_KEY": "env-secret",
+		"AWS_SESSION_TOKEN":     "",
+	})()
+
+	auth, expiration, err := (&EnvProvider{}).Retrieve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth != (Auth{AccessKey: "env-key", SecretKey: "env-secret"}) || !expiration.IsZero() {
+		t.Fatalf("unexpected credentials %+v expiring at %s", auth, expiration)
+	}
+
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	if _, _, err := (&EnvProvider{}).Retrieve(); err == nil {
+		t.Fatal("expected an error without a secret key")
+	}
+}
+
+func TestSharedCredentialsProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "credentials")
+	if err := ioutil.WriteFile(filename, []byte(testSharedCredentials), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer setEnv(t, map[string]string{"AWS_PROFILE": ""})()
+
+	expected := map[string]Auth{
+		"":   {AccessKey: "default-key", SecretKey: "default-secret"},
+		"ci": {AccessKey: "ci-key", SecretKey: "ci-secret", SessionToken: "ci-token"},
+	}
+	for profile, auth := range expected {
+		received, _, err := (&SharedCredentialsProvider{Filename: filename, Profile: profile}).Retrieve()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if received != auth {
+			t.Fatalf("expected %+v for profile %q; received %+v", auth, profile, received)
+		}
+	}
+
+	for _, profile := range []string{"empty", "missing"} {
+		if _, _, err := (&SharedCredentialsProvider{Filename: filename, Profile: profile}).Retrieve(); err == nil {
+			t.Fatalf("expected an error for profile %s", profile)
+		}
+	}
+	if _, _, err := (&SharedCredentialsProvider{Filename: filepath.Join(dir, "missing")}).Retrieve(); err == nil {
+		t.Fatal("expected an error for a missing file")
+	}
+}
+
+func TestInstanceMetadataProvider(t *testing.T) {
+	server, _ := testMetadataServer(time.Hour)
+	defer server.Close()
+
+	provider := &InstanceMetadataProvider{Endpoint: server.URL + "/latest/meta-data/iam/security-credentials"}
+	auth, expiration, err := provider.Retrieve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth != (Auth{AccessKey: "role-key", SecretKey: "role-secret", SessionToken: "role-token-1"}) {
+		t.Fatalf("unexpected credentials %+v", auth)
+	}
+	if expiration.Before(time.Now().Add(50 * time.Minute)) {
+		t.Fatalf("expected the credentials to expire in an hour; received %s", expiration)
+	}
+
+	provider.Endpoint = server.URL + "/missing/"
+	if _, _, err := provider.Retrieve(); err == nil {
+		t.Fatal("expected an error without a role")
+	}
+}
+
+func TestMetadataClientBypassesProxy(t *testing.T) {
+	transport, ok := metadataClient.Transport.(*http.Transport)
+	if !ok || transport.Proxy != nil {
+		t.Fatal("expected the metadata client not to use a proxy")
+	}
+}
+
+func TestCredentialsRefresh(t *testing.T) {
+	server, count := testMetadataServer(time.Hour)
+	defer server.Close()
+	endpoint := server.URL + "/latest/meta-data/iam/security-credentials/"
+
+	credentials := NewCredentials(&InstanceMetadataProvider{Endpoint: endpoint})
+	for i := 0; i < 3; i++ {
+		if _, err := credentials.Get(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if *count != 1 {
+		t.Fatalf("expected the credentials to be retrieved once; retrieved %d times", *count)
+	}
+
+	// credentials expiring within the window are refreshed on each use
+	expiring, expiringCount := testMetadataServer(time.Minute)
+	defer expiring.Close()
+	credentials = NewCredentials(&InstanceMetadataProvider{Endpoint: expiring.URL + "/latest/meta-data/iam/security-credentials/"})
+	for i := 1; i <= 2; i++ {
+		auth, err := credentials.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if auth.SessionToken != fmt.Sprintf("role-token-%d", i) {
+			t.Fatalf("expected a refreshed session token; received %s", auth.SessionToken)
+		}
+	}
+	if *expiringCount != 2 {
+		t.Fatalf("expected the credentials to be retrieved twice; retrieved %d times", *expiringCount)
+	}
+}
+
+func TestChainProvider(t *testing.T) {
+	server, _ := testMetadataServer(time.Hour)
+	defer server.Close()
+	defer setEnv(t, map[string]string{
+		"AWS_ACCESS_KEY_ID":     "",
+		"AWS_SECRET_ACCESS_KEY": "",
+	})()
+
+	chain := &ChainProvider{Providers: []Provider{
+		&EnvProvider{},
+		&SharedCredentialsProvider{Filename: filepath.Join(os.TempDir(), "machine-test-missing")},
+		&InstanceMetadataProvider{Endpoint: server.URL + "/latest/meta-data/iam/security-credentials/"},
+	}}
+	auth, _, err := chain.Retrieve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth.AccessKey != "role-key" {
+		t.Fatalf("expected the credentials of the role; received %+v", auth)
+	}
+
+	os.Setenv("AWS_ACCESS_KEY_ID", "env-key")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "env-secret")
+	if auth, _, err = chain.Retrieve(); err != nil {
+		t.Fatal(err)
+	}
+	if auth.AccessKey != "env-key" {
+		t.Fatalf("expected the credentials of the environment; received %+v", auth)
+	}
+
+	chain.Providers = chain.Providers[1:2]
+	if _, _, err := chain.Retrieve(); err == nil {
+		t.Fatal("expected an error without credentials")
+	}
+}
+
+func TestCredentialsError(t *testing.T) {
+	e := NewEC2WithCredentials(NewCredentials(&ChainProvider{}), "us-east-1")
+
+	if _, err := e.GetSubnets(nil); err == nil {
+		t.Fatal("expected an error without credentials")
+	}
+	if err := e.CreateTags("i-1a2b3c4d", map[string]string{"Name": "test"}); err == nil {
+		t.Fatal("expected an error without credentials")
+	}
+	if _, err := e.CreateSecurityGroup("test", "test", "vpc-12345"); err == nil {
+		t.Fatal("expected an error without credentials")
+	}
+	if err := e.AuthorizeSecurityGroup("sg-123", []IpPermission{{IpProtocol: "tcp", FromPort: 22, ToPort: 22}}); err == nil {
+		t.Fatal("expected an error without credentials")
+	}
+}
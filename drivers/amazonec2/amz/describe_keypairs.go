@@ -3,4 +3,5 @@ package amz
 type DescribeKeyPairsResponse struct {
 	RequestId string    `xml:"requestId"`
 	KeySet    []KeyPair `xml:"keySet>item"`
+	NextToken string    `xml:"nextToken"`
 }
@@ -3,4 +3,5 @@ package amz
 type DescribeSecurityGroupsResponse struct {
 	RequestId         string          `xml:"requestId"`
 	SecurityGroupInfo []SecurityGroup `xml:"securityGroupInfo>item"`
+	NextToken         string          `xml:"nextToken"`
 }
@@ -3,6 +3,7 @@ package amz
 type DescribeSubnetsResponse struct {
 	RequestId string   `xml:"requestId"`
 	SubnetSet []Subnet `xml:"subnetSet>item"`
+	NextToken string   `xml:"nextToken"`
 }
 
 type Subnet struct {
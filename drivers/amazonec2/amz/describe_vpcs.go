@@ -0,0 +1,13 @@
+package amz
+
+type DescribeVpcsResponse struct {
+	RequestId string `xml:"requestId"`
+	VpcSet    []Vpc  `xml:"vpcSet>item"`
+}
+
+type Vpc struct {
+	VpcId     string `xml:"vpcId"`
+	State     string `xml:"state"`
+	CidrBlock string `xml:"cidrBlock"`
+	IsDefault bool   `xml:"isDefault"`
+}
@@ -1,22 +1,43 @@
 package amz
 
 import (
+	"crypto/rand"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/xml"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strconv"
+	"time"
 
+	log "github.com/Sirupsen/logrus"
+	"github.com/cenkalti/backoff"
 	awsauth "github.com/smartystreets/go-aws-auth"
 )
 
+var (
+	// apiClient bounds the time of each attempt of an API call
+	apiClient = &http.Client{Timeout: 30 * time.Second}
+
+	// newBackOff returns the policy retrying throttled and failed API calls;
+	// its jitter spreads the calls of machines created in parallel
+	newBackOff = func() backoff.BackOff {
+		b := backoff.NewExponentialBackOff()
+		b.InitialInterval = time.Second
+		b.MaxInterval = 20 * time.Second
+		b.MaxElapsedTime = 5 * time.Minute
+		return b
+	}
+)
+
 type (
 	EC2 struct {
-		Endpoint string
-		Auth     Auth
-		Region   string
+		Endpoint    string
+		Auth        Auth
+		Credentials *Credentials
+		Region      string
 	}
 
 	Instance struct {
@@ -59,10 +80,17 @@ type (
 			Code    string `xml:"code"`
 			Message string `xml:"message"`
 		} `xml:"stateReason"`
-		Architecture        string `xml:"architecture"`
-		RootDeviceType      string `xml:"rootDeviceType"`
-		RootDeviceName      string `xml:"rootDeviceName"`
-		BlockDeviceMapping  string `xml:"blockDeviceMapping"`
+		Architecture       string `xml:"architecture"`
+		RootDeviceType     string `xml:"rootDeviceType"`
+		RootDeviceName     string `xml:"rootDeviceName"`
+		BlockDeviceMapping []struct {
+			DeviceName string `xml:"deviceName"`
+			Ebs        struct {
+				VolumeId            string `xml:"volumeId"`
+				Status              string `xml:"status"`
+				DeleteOnTermination bool   `xml:"deleteOnTermination"`
+			} `xml:"ebs"`
+		} `xml:"blockDeviceMapping>item"`
 		VirtualizationType  string `xml:"virtualizationType"`
 		ClientToken         string `xml:"clientToken"`
 		Hypervisor          string `xml:"hypervisor"`
@@ -110,11 +138,7 @@ func newAwsApiResponseError(r http.Response) error {
 	if err := getDecodedResponse(r, &errorResponse); err != nil {
 		return fmt.Errorf("Error decoding error response: %s", err)
 	}
-	msg := ""
-	for _, e := range errorResponse.Errors {
-		msg += fmt.Sprintf("%s\n", e.Message)
-	}
-	return fmt.Errorf("Non-200 API response: code=%d message=%s", r.StatusCode, msg)
+	return newApiError(r.StatusCode, errorResponse)
 }
 
 func newAwsApiCallError(err error) error {
@@ -138,9 +162,58 @@ func NewEC2(auth Auth, region string) *EC2 {
 	}
 }
 
+// NewEC2WithCredentials returns a client signing its calls with credentials
+// which are retrieved when needed instead of fixed keys
+func NewEC2WithCredentials(credentials *Credentials, region string) *EC2 {
+	e := NewEC2(Auth{}, region)
+	e.Credentials = credentials
+	return e
+}
+
+// awsApiCall makes an API call, retrying it with an exponential backoff
+// while it is throttled or fails transiently
 func (e *EC2) awsApiCall(v url.Values) (*http.Response, error) {
 	v.Set("Version", "2014-06-15")
-	client := &http.Client{}
+
+	b := newBackOff()
+	b.Reset()
+	for {
+		resp, err := e.doApiCall(v)
+		if err == nil {
+			return resp, nil
+		}
+
+		fields := log.Fields{"action": v.Get("Action")}
+		if apiError, ok := err.(*ApiError); ok {
+			fields["code"] = apiError.Code
+			fields["requestId"] = apiError.RequestID
+		}
+
+		if isRetryableError(err, v) {
+			if wait := b.NextBackOff(); wait != backoff.Stop {
+				log.WithFields(fields).Debugf("AWS API call failed, retrying in %s: %s", wait, err)
+				time.Sleep(wait)
+				continue
+			}
+		}
+
+		log.WithFields(fields).Debugf("AWS API call failed: %s", err)
+		if _, ok := err.(*url.Error); ok {
+			err = fmt.Errorf("client encountered error while doing the request: %s", err)
+		}
+		return resp, err
+	}
+}
+
+func (e *EC2) doApiCall(v url.Values) (*http.Response, error) {
+	auth := e.Auth
+	if e.Credentials != nil {
+		var err error
+		if auth, err = e.Credentials.Get(); err != nil {
+			return &http.Response{}, err
+		}
+	}
+
 	finalEndpoint := fmt.Sprintf("%s?%s", e.Endpoint, v.Encode())
 	req, err := http.NewRequest("GET", finalEndpoint, nil)
 	if err != nil {
@@ -149,14 +222,13 @@ func (e *EC2) awsApiCall(v url.Values) (*http.Response, error) {
 	req.Header.Add("Content-type", "application/json")
 
 	awsauth.Sign4(req, awsauth.Credentials{
-		AccessKeyID:     e.Auth.AccessKey,
-		SecretAccessKey: e.Auth.SecretKey,
-		SecurityToken:   e.Auth.SessionToken,
+		AccessKeyID:     auth.AccessKey,
+		SecretAccessKey: auth.SecretKey,
+		SecurityToken:   auth.SessionToken,
 	})
-	resp, err := client.Do(req)
+	resp, err := apiClient.Do(req)
 	if err != nil {
-		fmt.Printf("client encountered error while doing the request: %s", err.Error())
-		return resp, fmt.Errorf("client encountered error while doing the request: %s", err)
+		return resp, err
 	}
 	if resp.StatusCode != http.StatusOK {
 		return resp, newAwsApiResponseError(*resp)
@@ -164,36 +236,43 @@ func (e *EC2) awsApiCall(v url.Values) (*http.Response, error) {
 	return resp, nil
 }
 
-func (e *EC2) RunInstance(amiId string, instanceType string, zone string, minCount int, maxCount int, securityGroup string, keyName string, subnetId string, bdm *BlockDeviceMapping, role string) (EC2Instance, error) {
+// describe makes a Describe call and the calls for the next pages of its
+// results; page decodes each response and returns its next token
+func (e *EC2) describe(v url.Values, page func(resp http.Response) (string, error)) error {
+	for {
+		resp, err := e.awsApiCall(v)
+		if err != nil {
+			return newAwsApiCallError(err)
+		}
+		nextToken, err := page(*resp)
+		if err != nil {
+			return err
+		}
+		if nextToken == "" {
+			return nil
+		}
+		v.Set("NextToken", nextToken)
+	}
+}
+
+// newClientToken returns a unique token making the retries of a call
+// which launches instances idempotent
+func newClientToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+func (e *EC2) RunInstance(amiId string, instanceType string, zone string, minCount int, maxCount int, securityGroups []string, keyName string, subnetId string, bdms []BlockDeviceMapping, role string, privateAddressOnly bool) (EC2Instance, error) {
 	instance := Instance{}
 	v := url.Values{}
 	v.Set("Action", "RunInstances")
-	v.Set("ImageId", amiId)
-	v.Set("Placement.AvailabilityZone", e.Region+zone)
 	v.Set("MinCount", strconv.Itoa(minCount))
 	v.Set("MaxCount", strconv.Itoa(maxCount))
-	v.Set("KeyName", keyName)
-	v.Set("InstanceType", instanceType)
-	v.Set("NetworkInterface.0.DeviceIndex", "0")
-	v.Set("NetworkInterface.0.SecurityGroupId.0", securityGroup)
-	v.Set("NetworkInterface.0.SubnetId", subnetId)
-	v.Set("NetworkInterface.0.AssociatePublicIpAddress", "1")
-
-	if len(role) > 0 {
-		v.Set("IamInstanceProfile.Name", role)
-	}
-
-	if bdm != nil {
-		v.Set("BlockDeviceMapping.0.DeviceName", bdm.DeviceName)
-		v.Set("BlockDeviceMapping.0.VirtualName", bdm.VirtualName)
-		v.Set("BlockDeviceMapping.0.Ebs.VolumeSize", strconv.FormatInt(bdm.VolumeSize, 10))
-		v.Set("BlockDeviceMapping.0.Ebs.VolumeType", bdm.VolumeType)
-		deleteOnTerm := 0
-		if bdm.DeleteOnTermination {
-			deleteOnTerm = 1
-		}
-		v.Set("BlockDeviceMapping.0.Ebs.DeleteOnTermination", strconv.Itoa(deleteOnTerm))
-	}
+	v.Set("ClientToken", newClientToken())
+	e.setLaunchSpecification(v, "", amiId, instanceType, zone, securityGroups, keyName, subnetId, bdms, role, privateAddressOnly)
 
 	resp, err := e.awsApiCall(v)
 
@@ -216,6 +295,123 @@ func (e *EC2) RunInstance(amiId string, instanceType string, zone string, minCou
 	return instance.info, nil
 }
 
+// setLaunchSpecification sets the parameters describing the instance to
+// launch, which are prefixed for spot instance requests. Instances with a
+// private address only get no public IP.
+func (e *EC2) setLaunchSpecification(v url.Values, prefix string, amiId string, instanceType string, zone string, securityGroups []string, keyName string, subnetId string, bdms []BlockDeviceMapping, role string, privateAddressOnly bool) {
+	v.Set(prefix+"ImageId", amiId)
+	v.Set(prefix+"Placement.AvailabilityZone", e.Region+zone)
+	v.Set(prefix+"KeyName", keyName)
+	v.Set(prefix+"InstanceType", instanceType)
+	v.Set(prefix+"NetworkInterface.0.DeviceIndex", "0")
+	for i, securityGroup := range securityGroups {
+		v.Set(fmt.Sprintf("%sNetworkInterface.0.SecurityGroupId.%d", prefix, i), securityGroup)
+	}
+	v.Set(prefix+"NetworkInterface.0.SubnetId", subnetId)
+	if privateAddressOnly {
+		v.Set(prefix+"NetworkInterface.0.AssociatePublicIpAddress", "0")
+	} else {
+		v.Set(prefix+"NetworkInterface.0.AssociatePublicIpAddress", "1")
+	}
+
+	if len(role) > 0 {
+		v.Set(prefix+"IamInstanceProfile.Name", role)
+	}
+
+	for i, bdm := range bdms {
+		p := fmt.Sprintf("%sBlockDeviceMapping.%d.", prefix, i)
+		v.Set(p+"DeviceName", bdm.DeviceName)
+		v.Set(p+"VirtualName", bdm.VirtualName)
+		v.Set(p+"Ebs.VolumeSize", strconv.FormatInt(bdm.VolumeSize, 10))
+		v.Set(p+"Ebs.VolumeType", bdm.VolumeType)
+		if bdm.Iops > 0 {
+			v.Set(p+"Ebs.Iops", strconv.FormatInt(bdm.Iops, 10))
+		}
+		if bdm.Encrypted {
+			v.Set(p+"Ebs.Encrypted", "true")
+		}
+		deleteOnTerm := 0
+		if bdm.DeleteOnTermination {
+			deleteOnTerm = 1
+		}
+		v.Set(p+"Ebs.DeleteOnTermination", strconv.Itoa(deleteOnTerm))
+	}
+}
+
+// RequestSpotInstance requests a one-time spot instance at the given
+// maximum price per hour. The instance is launched once AWS fulfills the
+// request.
+func (e *EC2) RequestSpotInstance(spotPrice string, amiId string, instanceType string, zone string, securityGroups []string, keyName string, subnetId string, bdms []BlockDeviceMapping, role string, privateAddressOnly bool) (*SpotInstanceRequest, error) {
+	v := url.Values{}
+	v.Set("Action", "RequestSpotInstances")
+	v.Set("SpotPrice", spotPrice)
+	v.Set("InstanceCount", "1")
+	v.Set("Type", "one-time")
+	v.Set("ClientToken", newClientToken())
+	e.setLaunchSpecification(v, "LaunchSpecification.", amiId, instanceType, zone, securityGroups, keyName, subnetId, bdms, role, privateAddressOnly)
+
+	resp, err := e.awsApiCall(v)
+	if err != nil {
+		return nil, newAwsApiCallError(err)
+	}
+
+	requestSpotInstancesResponse := RequestSpotInstancesResponse{}
+	if err := getDecodedResponse(*resp, &requestSpotInstancesResponse); err != nil {
+		return nil, fmt.Errorf("Error decoding request spot instances response: %s", err)
+	}
+
+	if len(requestSpotInstancesResponse.SpotInstanceRequestSet) == 0 {
+		return nil, fmt.Errorf("no spot instance request was created")
+	}
+	return &requestSpotInstancesResponse.SpotInstanceRequestSet[0], nil
+}
+
+// GetSpotInstanceRequest returns nil for a spot instance request which is
+// not found, e.g. because AWS purged it hours after it closed
+func (e *EC2) GetSpotInstanceRequest(requestId string) (*SpotInstanceRequest, error) {
+	v := url.Values{}
+	v.Set("Action", "DescribeSpotInstanceRequests")
+	v.Set("SpotInstanceRequestId.1", requestId)
+
+	resp, err := e.awsApiCall(v)
+	if err != nil {
+		if apiError, ok := err.(*ApiError); ok && apiError.Code == ErrorSpotInstanceRequestIdNotFound {
+			return nil, nil
+		}
+		return nil, newAwsApiCallError(err)
+	}
+
+	describeSpotInstanceRequestsResponse := DescribeSpotInstanceRequestsResponse{}
+	if err := getDecodedResponse(*resp, &describeSpotInstanceRequestsResponse); err != nil {
+		return nil, fmt.Errorf("Error decoding describe spot instance requests response: %s", err)
+	}
+
+	if len(describeSpotInstanceRequestsResponse.SpotInstanceRequestSet) == 0 {
+		return nil, nil
+	}
+	return &describeSpotInstanceRequestsResponse.SpotInstanceRequestSet[0], nil
+}
+
+// CancelSpotInstanceRequest cancels a spot instance request; an instance
+// launched by the request keeps running
+func (e *EC2) CancelSpotInstanceRequest(requestId string) error {
+	v := url.Values{}
+	v.Set("Action", "CancelSpotInstanceRequests")
+	v.Set("SpotInstanceRequestId.1", requestId)
+
+	resp, err := e.awsApiCall(v)
+	if err != nil {
+		return fmt.Errorf("Error making API call to cancel spot instance request: %s", err)
+	}
+
+	cancelSpotInstanceRequestsResponse := CancelSpotInstanceRequestsResponse{}
+	if err := getDecodedResponse(*resp, &cancelSpotInstanceRequestsResponse); err != nil {
+		return fmt.Errorf("Error decoding cancel spot instance requests response: %s", err)
+	}
+
+	return nil
+}
+
 func (e *EC2) DeleteKeyPair(name string) error {
 	v := url.Values{}
 	v.Set("Action", "DeleteKeyPair")
@@ -293,10 +489,10 @@ func (e *EC2) CreateTags(id string, tags map[string]string) error {
 	}
 
 	resp, err := e.awsApiCall(v)
-	defer resp.Body.Close()
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 
 	createTagsResponse := &CreateTagsResponse{}
 
@@ -307,6 +503,238 @@ func (e *EC2) CreateTags(id string, tags map[string]string) error {
 	return nil
 }
 
+// RootVolumeId returns the ID of the EBS volume at the root device
+func (i EC2Instance) RootVolumeId() string {
+	for _, m := range i.BlockDeviceMapping {
+		if m.DeviceName == i.RootDeviceName {
+			return m.Ebs.VolumeId
+		}
+	}
+	return ""
+}
+
+func (e *EC2) CreateSnapshot(volumeId string, description string) (*Snapshot, error) {
+	v := url.Values{}
+	v.Set("Action", "CreateSnapshot")
+	v.Set("VolumeId", volumeId)
+	v.Set("Description", description)
+
+	resp, err := e.awsApiCall(v)
+	if err != nil {
+		return nil, newAwsApiCallError(err)
+	}
+
+	createSnapshotResponse := CreateSnapshotResponse{}
+	if err := getDecodedResponse(*resp, &createSnapshotResponse); err != nil {
+		return nil, fmt.Errorf("Error decoding create snapshot response: %s", err)
+	}
+
+	return &createSnapshotResponse.Snapshot, nil
+}
+
+func (e *EC2) GetSnapshots(filters []Filter) ([]Snapshot, error) {
+	snapshots := []Snapshot{}
+	v := url.Values{}
+	v.Set("Action", "DescribeSnapshots")
+	v.Set("Owner.1", "self")
+	setFilters(v, filters)
+
+	err := e.describe(v, func(resp http.Response) (string, error) {
+		describeSnapshotsResponse := DescribeSnapshotsResponse{}
+		if err := getDecodedResponse(resp, &describeSnapshotsResponse); err != nil {
+			return "", fmt.Errorf("Error decoding describe snapshots response: %s", err)
+		}
+		snapshots = append(snapshots, describeSnapshotsResponse.SnapshotSet...)
+		return describeSnapshotsResponse.NextToken, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshots, nil
+}
+
+func (e *EC2) GetSnapshot(snapshotId string) (*Snapshot, error) {
+	snapshots, err := e.GetSnapshots([]Filter{{Name: "snapshot-id", Value: snapshotId}})
+	if err != nil {
+		return nil, err
+	}
+	if len(snapshots) == 0 {
+		return nil, fmt.Errorf("snapshot %s not found", snapshotId)
+	}
+	return &snapshots[0], nil
+}
+
+func (e *EC2) DeleteSnapshot(snapshotId string) error {
+	v := url.Values{}
+	v.Set("Action", "DeleteSnapshot")
+	v.Set("SnapshotId", snapshotId)
+
+	resp, err := e.awsApiCall(v)
+	if err != nil {
+		return fmt.Errorf("Error making API call to delete snapshot: %s", err)
+	}
+
+	deleteSnapshotResponse := DeleteSnapshotResponse{}
+	if err := getDecodedResponse(*resp, &deleteSnapshotResponse); err != nil {
+		return fmt.Errorf("Error decoding delete snapshot response: %s", err)
+	}
+
+	return nil
+}
+
+func (e *EC2) CreateVolume(snapshotId string, availabilityZone string, volumeType string, iops int64) (*Volume, error) {
+	v := url.Values{}
+	v.Set("Action", "CreateVolume")
+	v.Set("SnapshotId", snapshotId)
+	v.Set("AvailabilityZone", availabilityZone)
+	if volumeType != "" {
+		v.Set("VolumeType", volumeType)
+	}
+	if iops > 0 {
+		v.Set("Iops", strconv.FormatInt(iops, 10))
+	}
+
+	resp, err := e.awsApiCall(v)
+	if err != nil {
+		return nil, newAwsApiCallError(err)
+	}
+
+	createVolumeResponse := CreateVolumeResponse{}
+	if err := getDecodedResponse(*resp, &createVolumeResponse); err != nil {
+		return nil, fmt.Errorf("Error decoding create volume response: %s", err)
+	}
+
+	return &createVolumeResponse.Volume, nil
+}
+
+func (e *EC2) GetVolume(volumeId string) (*Volume, error) {
+	v := url.Values{}
+	v.Set("Action", "DescribeVolumes")
+	v.Set("VolumeId.1", volumeId)
+
+	resp, err := e.awsApiCall(v)
+	if err != nil {
+		return nil, newAwsApiCallError(err)
+	}
+
+	describeVolumesResponse := DescribeVolumesResponse{}
+	if err := getDecodedResponse(*resp, &describeVolumesResponse); err != nil {
+		return nil, fmt.Errorf("Error decoding describe volumes response: %s", err)
+	}
+
+	if len(describeVolumesResponse.VolumeSet) == 0 {
+		return nil, fmt.Errorf("volume %s not found", volumeId)
+	}
+	return &describeVolumesResponse.VolumeSet[0], nil
+}
+
+func (e *EC2) AttachVolume(volumeId string, instanceId string, device string) error {
+	v := url.Values{}
+	v.Set("Action", "AttachVolume")
+	v.Set("VolumeId", volumeId)
+	v.Set("InstanceId", instanceId)
+	v.Set("Device", device)
+
+	return e.volumeAttachmentCall(v)
+}
+
+func (e *EC2) DetachVolume(volumeId string) error {
+	v := url.Values{}
+	v.Set("Action", "DetachVolume")
+	v.Set("VolumeId", volumeId)
+
+	return e.volumeAttachmentCall(v)
+}
+
+func (e *EC2) volumeAttachmentCall(v url.Values) error {
+	resp, err := e.awsApiCall(v)
+	if err != nil {
+		return newAwsApiCallError(err)
+	}
+
+	volumeAttachmentResponse := VolumeAttachmentResponse{}
+	if err := getDecodedResponse(*resp, &volumeAttachmentResponse); err != nil {
+		return fmt.Errorf("Error decoding %s response: %s", v.Get("Action"), err)
+	}
+
+	return nil
+}
+
+func (e *EC2) DeleteVolume(volumeId string) error {
+	v := url.Values{}
+	v.Set("Action", "DeleteVolume")
+	v.Set("VolumeId", volumeId)
+
+	resp, err := e.awsApiCall(v)
+	if err != nil {
+		return fmt.Errorf("Error making API call to delete volume: %s", err)
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// SetDeleteOnTermination marks the volume attached at device to be deleted
+// along with the instance
+func (e *EC2) SetDeleteOnTermination(instanceId string, device string) error {
+	v := url.Values{}
+	v.Set("Action", "ModifyInstanceAttribute")
+	v.Set("InstanceId", instanceId)
+	v.Set("BlockDeviceMapping.1.DeviceName", device)
+	v.Set("BlockDeviceMapping.1.Ebs.DeleteOnTermination", "true")
+
+	resp, err := e.awsApiCall(v)
+	if err != nil {
+		return newAwsApiCallError(err)
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// SetInstanceType changes the type of a stopped instance
+func (e *EC2) SetInstanceType(instanceId string, instanceType string) error {
+	v := url.Values{}
+	v.Set("Action", "ModifyInstanceAttribute")
+	v.Set("InstanceId", instanceId)
+	v.Set("InstanceType.Value", instanceType)
+
+	resp, err := e.awsApiCall(v)
+	if err != nil {
+		return newAwsApiCallError(err)
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// SetSecurityGroups replaces the security groups of a VPC instance
+func (e *EC2) SetSecurityGroups(instanceId string, groupIds []string) error {
+	v := url.Values{}
+	v.Set("Action", "ModifyInstanceAttribute")
+	v.Set("InstanceId", instanceId)
+	for index, id := range groupIds {
+		v.Set(fmt.Sprintf("GroupId.%d", index+1), id)
+	}
+
+	resp, err := e.awsApiCall(v)
+	if err != nil {
+		return newAwsApiCallError(err)
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+func setFilters(v url.Values, filters []Filter) {
+	for idx, filter := range filters {
+		n := idx + 1 // amazon starts counting from 1 not 0
+		v.Set(fmt.Sprintf("Filter.%d.Name", n), filter.Name)
+		v.Set(fmt.Sprintf("Filter.%d.Value", n), filter.Value)
+	}
+}
+
 func (e *EC2) CreateSecurityGroup(name string, description string, vpcId string) (*SecurityGroup, error) {
 	v := url.Values{}
 	v.Set("Action", "CreateSecurityGroup")
@@ -315,20 +743,14 @@ func (e *EC2) CreateSecurityGroup(name string, description string, vpcId string)
 	v.Set("VpcId", vpcId)
 
 	resp, err := e.awsApiCall(v)
-	defer resp.Body.Close()
 	if err != nil {
-		// ugly hack since API has no way to check if SG already exists
-		if resp.StatusCode == http.StatusBadRequest {
-			var errorResponse ErrorResponse
-			if err := getDecodedResponse(*resp, &errorResponse); err != nil {
-				return nil, fmt.Errorf("Error decoding error response: %s", err)
-			}
-			if errorResponse.Errors[0].Code == ErrorDuplicateGroup {
-				return nil, nil
-			}
+		// the API has no way to check if SG already exists
+		if apiError, ok := err.(*ApiError); ok && apiError.Code == ErrorDuplicateGroup {
+			return nil, nil
 		}
 		return nil, fmt.Errorf("Error making API call to create security group: %s", err)
 	}
+	defer resp.Body.Close()
 
 	createSecurityGroupResponse := CreateSecurityGroupResponse{}
 
@@ -344,8 +766,28 @@ func (e *EC2) CreateSecurityGroup(name string, description string, vpcId string)
 }
 
 func (e *EC2) AuthorizeSecurityGroup(groupId string, permissions []IpPermission) error {
+	v := securityGroupIngressValues("AuthorizeSecurityGroupIngress", groupId, permissions)
+	resp, err := e.awsApiCall(v)
+	if err != nil {
+		return fmt.Errorf("Error making API call to authorize security group ingress: %s", err)
+	}
+	defer resp.Body.Close()
+	return nil
+}
+
+func (e *EC2) RevokeSecurityGroup(groupId string, permissions []IpPermission) error {
+	v := securityGroupIngressValues("RevokeSecurityGroupIngress", groupId, permissions)
+	resp, err := e.awsApiCall(v)
+	if err != nil {
+		return fmt.Errorf("Error making API call to revoke security group ingress: %s", err)
+	}
+	defer resp.Body.Close()
+	return nil
+}
+
+func securityGroupIngressValues(action string, groupId string, permissions []IpPermission) url.Values {
 	v := url.Values{}
-	v.Set("Action", "AuthorizeSecurityGroupIngress")
+	v.Set("Action", action)
 	v.Set("GroupId", groupId)
 
 	for index, perm := range permissions {
@@ -355,12 +797,7 @@ func (e *EC2) AuthorizeSecurityGroup(groupId string, permissions []IpPermission)
 		v.Set(fmt.Sprintf("IpPermissions.%d.ToPort", n), strconv.Itoa(perm.ToPort))
 		v.Set(fmt.Sprintf("IpPermissions.%d.IpRanges.1.CidrIp", n), perm.IpRange)
 	}
-	resp, err := e.awsApiCall(v)
-	defer resp.Body.Close()
-	if err != nil {
-		return fmt.Errorf("Error making API call to authorize security group ingress: %s", err)
-	}
-	return nil
+	return v
 }
 
 func (e *EC2) DeleteSecurityGroup(groupId string) error {
@@ -369,10 +806,10 @@ func (e *EC2) DeleteSecurityGroup(groupId string) error {
 	v.Set("GroupId", groupId)
 
 	resp, err := e.awsApiCall(v)
-	defer resp.Body.Close()
 	if err != nil {
 		return fmt.Errorf("Error making API call to delete security group: %s", err)
 	}
+	defer resp.Body.Close()
 
 	deleteSecurityGroupResponse := DeleteSecurityGroupResponse{}
 
@@ -385,24 +822,19 @@ func (e *EC2) DeleteSecurityGroup(groupId string) error {
 
 func (e *EC2) GetSecurityGroups() ([]SecurityGroup, error) {
 	sgs := []SecurityGroup{}
-	resp, err := e.performStandardAction("DescribeSecurityGroups")
-	if err != nil {
-		return sgs, err
-	}
-	defer resp.Body.Close()
-	contents, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return sgs, fmt.Errorf("Error reading AWS response body: %s", err)
-	}
-
-	unmarshalledResponse := DescribeSecurityGroupsResponse{}
-	if err = xml.Unmarshal(contents, &unmarshalledResponse); err != nil {
-		return sgs, fmt.Errorf("Error unmarshalling AWS response XML: %s", err)
-	}
+	v := url.Values{}
+	v.Set("Action", "DescribeSecurityGroups")
 
-	sgs = unmarshalledResponse.SecurityGroupInfo
+	err := e.describe(v, func(resp http.Response) (string, error) {
+		describeSecurityGroupsResponse := DescribeSecurityGroupsResponse{}
+		if err := getDecodedResponse(resp, &describeSecurityGroupsResponse); err != nil {
+			return "", fmt.Errorf("Error decoding describe security groups response: %s", err)
+		}
+		sgs = append(sgs, describeSecurityGroupsResponse.SecurityGroupInfo...)
+		return describeSecurityGroupsResponse.NextToken, nil
+	})
 
-	return sgs, nil
+	return sgs, err
 }
 
 func (e *EC2) GetSecurityGroupById(id string) (*SecurityGroup, error) {
@@ -423,51 +855,56 @@ func (e *EC2) GetSubnets(filters []Filter) ([]Subnet, error) {
 	subnets := []Subnet{}
 	v := url.Values{}
 	v.Set("Action", "DescribeSubnets")
+	setFilters(v, filters)
 
-	for idx, filter := range filters {
-		n := idx + 1 // amazon starts counting from 1 not 0
-		v.Set(fmt.Sprintf("Filter.%d.Name", n), filter.Name)
-		v.Set(fmt.Sprintf("Filter.%d.Value", n), filter.Value)
-	}
+	err := e.describe(v, func(resp http.Response) (string, error) {
+		describeSubnetsResponse := DescribeSubnetsResponse{}
+		if err := getDecodedResponse(resp, &describeSubnetsResponse); err != nil {
+			return "", fmt.Errorf("Error decoding describe subnets response: %s", err)
+		}
+		subnets = append(subnets, describeSubnetsResponse.SubnetSet...)
+		return describeSubnetsResponse.NextToken, nil
+	})
 
-	resp, err := e.awsApiCall(v)
-	defer resp.Body.Close()
+	return subnets, err
+}
 
-	contents, err := ioutil.ReadAll(resp.Body)
+func (e *EC2) GetVpc(vpcId string) (*Vpc, error) {
+	v := url.Values{}
+	v.Set("Action", "DescribeVpcs")
+	v.Set("VpcId.1", vpcId)
+
+	resp, err := e.awsApiCall(v)
 	if err != nil {
-		return subnets, fmt.Errorf("Error reading AWS response body: %s", err)
+		return nil, newAwsApiCallError(err)
 	}
 
-	unmarshalledResponse := DescribeSubnetsResponse{}
-	if err = xml.Unmarshal(contents, &unmarshalledResponse); err != nil {
-		return subnets, fmt.Errorf("Error unmarshalling AWS response XML: %s", err)
+	describeVpcsResponse := DescribeVpcsResponse{}
+	if err := getDecodedResponse(*resp, &describeVpcsResponse); err != nil {
+		return nil, fmt.Errorf("Error decoding describe vpcs response: %s", err)
 	}
 
-	subnets = unmarshalledResponse.SubnetSet
-
-	return subnets, nil
+	if len(describeVpcsResponse.VpcSet) == 0 {
+		return nil, fmt.Errorf("vpc %s not found", vpcId)
+	}
+	return &describeVpcsResponse.VpcSet[0], nil
 }
 
 func (e *EC2) GetKeyPairs() ([]KeyPair, error) {
 	keyPairs := []KeyPair{}
-	resp, err := e.performStandardAction("DescribeKeyPairs")
-	if err != nil {
-		return keyPairs, err
-	}
-	defer resp.Body.Close()
-	contents, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return keyPairs, fmt.Errorf("Error reading AWS response body: %s", err)
-	}
-
-	unmarshalledResponse := DescribeKeyPairsResponse{}
-	if err = xml.Unmarshal(contents, &unmarshalledResponse); err != nil {
-		return keyPairs, fmt.Errorf("Error unmarshalling AWS response XML: %s", err)
-	}
+	v := url.Values{}
+	v.Set("Action", "DescribeKeyPairs")
 
-	keyPairs = unmarshalledResponse.KeySet
+	err := e.describe(v, func(resp http.Response) (string, error) {
+		describeKeyPairsResponse := DescribeKeyPairsResponse{}
+		if err := getDecodedResponse(resp, &describeKeyPairsResponse); err != nil {
+			return "", fmt.Errorf("Error decoding describe key pairs response: %s", err)
+		}
+		keyPairs = append(keyPairs, describeKeyPairsResponse.KeySet...)
+		return describeKeyPairsResponse.NextToken, nil
+	})
 
-	return keyPairs, nil
+	return keyPairs, err
 }
 
 func (e *EC2) GetKeyPair(name string) (*KeyPair, error) {
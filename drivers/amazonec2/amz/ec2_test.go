@@ -1 +1,192 @@
 package amz
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff"
+)
+
+func TestSecurityGroupIngressValues(t *testing.T) {
+	v := securityGroupIngressValues("RevokeSecurityGroupIngress", "sg-123", []IpPermission{
+		{IpProtocol: "tcp", FromPort: 80, ToPort: 80, IpRange: "0.0.0.0/0"},
+		{IpProtocol: "udp", FromPort: 53, ToPort: 53, IpRange: "10.0.0.0/8"},
+	})
+
+	expected := map[string]string{
+		"Action":                            "RevokeSecurityGroupIngress",
+		"GroupId":                           "sg-123",
+		"IpPermissions.1.IpProtocol":        "tcp",
+		"IpPermissions.1.FromPort":          "80",
+		"IpPermissions.1.ToPort":            "80",
+		"IpPermissions.1.IpRanges.1.CidrIp": "0.0.0.0/0",
+		"IpPermissions.2.IpProtocol":        "udp",
+		"IpPermissions.2.FromPort":          "53",
+		"IpPermissions.2.IpRanges.1.CidrIp": "10.0.0.0/8",
+	}
+	for key, value := range expected {
+		if v.Get(key) != value {
+			t.Fatalf("expected %s=%s; received %q", key, value, v.Get(key))
+		}
+	}
+}
+
+func TestRootVolumeId(t *testing.T) {
+	instance := EC2Instance{}
+	if err := xml.Unmarshal([]byte(`<item>
+  <rootDeviceName>/dev/sda1</rootDeviceName>
+  <blockDeviceMapping>
+    <item>
+      <deviceName>/dev/sdb</deviceName>
+      <ebs><volumeId>vol-data</volumeId><status>attached</status></ebs>
+    </item>
+    <item>
+      <deviceName>/dev/sda1</deviceName>
+      <ebs><volumeId>vol-root</volumeId><status>attached</status></ebs>
+    </item>
+  </blockDeviceMapping>
+</item>`), &instance); err != nil {
+		t.Fatal(err)
+	}
+
+	if id := instance.RootVolumeId(); id != "vol-root" {
+		t.Fatalf("expected root volume vol-root; received %q", id)
+	}
+}
+
+func testBackOff() func() {
+	saved := newBackOff
+	newBackOff = func() backoff.BackOff {
+		return &backoff.ExponentialBackOff{
+			InitialInterval: time.Millisecond,
+			Multiplier:      1,
+			MaxInterval:     time.Millisecond,
+			MaxElapsedTime:  100 * time.Millisecond,
+			Clock:           backoff.SystemClock,
+		}
+	}
+	return func() { newBackOff = saved }
+}
+
+const throttledResponse = `<Response><Errors><Error><Code>RequestLimitExceeded</Code><Message>Request limit exceeded.</Message></Error></Errors><RequestID>req-1</RequestID></Response>`
+
+func TestAwsApiCallRetriesThrottledCalls(t *testing.T) {
+	defer testBackOff()()
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, throttledResponse)
+			return
+		}
+		fmt.Fprint(w, `<DeleteKeyPairResponse><return>true</return></DeleteKeyPairResponse>`)
+	}))
+	defer server.Close()
+
+	e := NewEC2(Auth{AccessKey: "access", SecretKey: "secret"}, "us-east-1")
+	e.Endpoint = server.URL
+	if err := e.DeleteKeyPair("machine"); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 {
+		t.Fatalf("expected 3 calls; received %d", calls)
+	}
+}
+
+func TestAwsApiCallStopsRetrying(t *testing.T) {
+	defer testBackOff()()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, throttledResponse)
+	}))
+	defer server.Close()
+
+	e := NewEC2(Auth{AccessKey: "access", SecretKey: "secret"}, "us-east-1")
+	e.Endpoint = server.URL
+	_, err := e.awsApiCall(url.Values{"Action": {"DescribeKeyPairs"}})
+	apiError, ok := err.(*ApiError)
+	if !ok {
+		t.Fatalf("expected an API error; received %v", err)
+	}
+	if apiError.Code != ErrorRequestLimitExceeded || apiError.RequestID != "req-1" {
+		t.Fatalf("unexpected API error %+v", apiError)
+	}
+}
+
+func TestAwsApiCallDoesNotRetryClientErrors(t *testing.T) {
+	defer testBackOff()()
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `<Response><Errors><Error><Code>InvalidGroup.Duplicate</Code><Message>The security group already exists</Message></Error></Errors></Response>`)
+	}))
+	defer server.Close()
+
+	e := NewEC2(Auth{AccessKey: "access", SecretKey: "secret"}, "us-east-1")
+	e.Endpoint = server.URL
+	group, err := e.CreateSecurityGroup("docker-machine", "Docker Machine", "vpc-123")
+	if err != nil || group != nil {
+		t.Fatalf("expected a duplicate group to be ignored; received %v, %v", group, err)
+	}
+	if calls != 1 {
+		t.Fatalf("expected 1 call; received %d", calls)
+	}
+}
+
+func TestAwsApiCallDoesNotRetryFailedMutations(t *testing.T) {
+	defer testBackOff()()
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, `<Response><Errors><Error><Code>InternalError</Code><Message>An internal error has occurred</Message></Error></Errors></Response>`)
+	}))
+	defer server.Close()
+
+	// the key may have been imported, so importing it again could fail
+	e := NewEC2(Auth{AccessKey: "access", SecretKey: "secret"}, "us-east-1")
+	e.Endpoint = server.URL
+	if err := e.ImportKeyPair("machine", "ssh-rsa AAAA"); err == nil {
+		t.Fatal("expected an error")
+	}
+	if calls != 1 {
+		t.Fatalf("expected 1 call; received %d", calls)
+	}
+}
+
+func TestGetSecurityGroupsPages(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("NextToken") == "" {
+			fmt.Fprint(w, `<DescribeSecurityGroupsResponse>
+  <securityGroupInfo><item><groupId>sg-1</groupId></item></securityGroupInfo>
+  <nextToken>page-2</nextToken>
+</DescribeSecurityGroupsResponse>`)
+			return
+		}
+		fmt.Fprint(w, `<DescribeSecurityGroupsResponse>
+  <securityGroupInfo><item><groupId>sg-2</groupId></item></securityGroupInfo>
+</DescribeSecurityGroupsResponse>`)
+	}))
+	defer server.Close()
+
+	e := NewEC2(Auth{AccessKey: "access", SecretKey: "secret"}, "us-east-1")
+	e.Endpoint = server.URL
+	groups, err := e.GetSecurityGroups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 2 || groups[0].GroupId != "sg-1" || groups[1].GroupId != "sg-2" {
+		t.Fatalf("expected the groups of both pages; received %+v", groups)
+	}
+}
@@ -1,5 +1,10 @@
 package amz
 
+import (
+	"fmt"
+	"strings"
+)
+
 type ErrorResponse struct {
 	Errors []struct {
 		Code    string
@@ -7,3 +12,32 @@ type ErrorResponse struct {
 	} `xml:"Errors>Error"`
 	RequestID string
 }
+
+// ApiError is a non-200 response of the EC2 API; Code is the code of its
+// first error, e.g. RequestLimitExceeded
+type ApiError struct {
+	StatusCode int
+	Code       string
+	Message    string
+	RequestID  string
+}
+
+func newApiError(statusCode int, errorResponse ErrorResponse) *ApiError {
+	apiError := &ApiError{
+		StatusCode: statusCode,
+		RequestID:  errorResponse.RequestID,
+	}
+	messages := []string{}
+	for _, e := range errorResponse.Errors {
+		if apiError.Code == "" {
+			apiError.Code = e.Code
+		}
+		messages = append(messages, e.Message)
+	}
+	apiError.Message = strings.Join(messages, "\n")
+	return apiError
+}
+
+func (e *ApiError) Error() string {
+	return fmt.Sprintf("Non-200 API response: code=%d error=%s message=%s", e.StatusCode, e.Code, e.Message)
+}
@@ -1,5 +1,57 @@
 package amz
 
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
 const (
-	ErrorDuplicateGroup = "InvalidGroup.Duplicate"
+	ErrorDuplicateGroup                = "InvalidGroup.Duplicate"
+	ErrorSpotInstanceRequestIdNotFound = "InvalidSpotInstanceRequestID.NotFound"
+
+	ErrorRequestLimitExceeded = "RequestLimitExceeded"
+	ErrorThrottling           = "Throttling"
+	ErrorInternalError        = "InternalError"
+	ErrorUnavailable          = "Unavailable"
+	ErrorServiceUnavailable   = "ServiceUnavailable"
 )
+
+// isRetryableError reports whether the API call v which failed with err may
+// succeed if made again. Throttled calls and calls which did not reach AWS
+// were not performed and are always retried. Other failures may happen
+// after AWS performed the call, so only the calls which can be made twice
+// are retried then.
+func isRetryableError(err error, v url.Values) bool {
+	switch err := err.(type) {
+	case *ApiError:
+		switch err.Code {
+		case ErrorRequestLimitExceeded, ErrorThrottling:
+			return true
+		case ErrorInternalError, ErrorUnavailable, ErrorServiceUnavailable:
+			return isIdempotent(v)
+		}
+		return err.StatusCode >= 500 && isIdempotent(v)
+	case *url.Error:
+		if opError, ok := err.Err.(*net.OpError); ok && opError.Op == "dial" {
+			return true
+		}
+		return isIdempotent(v)
+	}
+	return false
+}
+
+// isIdempotent reports whether making the API call v again has no other
+// effect than making it once: describing, setting attributes and states,
+// and launching instances with a client token
+func isIdempotent(v url.Values) bool {
+	action := v.Get("Action")
+	if strings.HasPrefix(action, "Describe") || v.Get("ClientToken") != "" {
+		return true
+	}
+	switch action {
+	case "CreateTags", "ModifyInstanceAttribute", "StartInstances", "StopInstances", "RebootInstances", "DeleteKeyPair":
+		return true
+	}
+	return false
+}
@@ -1 +1,41 @@
 package amz
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"testing"
+)
+
+func TestIsRetryableError(t *testing.T) {
+	describe := url.Values{"Action": {"DescribeInstances"}}
+	importKey := url.Values{"Action": {"ImportKeyPair"}}
+	runInstances := url.Values{"Action": {"RunInstances"}, "ClientToken": {"token"}}
+	reset := &url.Error{Op: "Get", URL: "https://ec2.us-east-1.amazonaws.com", Err: errors.New("connection reset")}
+	refused := &url.Error{Op: "Get", URL: "https://ec2.us-east-1.amazonaws.com", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}
+
+	cases := []struct {
+		err       error
+		v         url.Values
+		retryable bool
+	}{
+		{&ApiError{StatusCode: 503, Code: ErrorRequestLimitExceeded}, importKey, true},
+		{&ApiError{StatusCode: 400, Code: ErrorThrottling}, importKey, true},
+		{&ApiError{StatusCode: 500, Code: ErrorInternalError}, describe, true},
+		{&ApiError{StatusCode: 500, Code: ErrorInternalError}, importKey, false},
+		{&ApiError{StatusCode: 502}, runInstances, true},
+		{&ApiError{StatusCode: 502}, importKey, false},
+		{&ApiError{StatusCode: 400, Code: ErrorDuplicateGroup}, describe, false},
+		{&ApiError{StatusCode: 401, Code: "AuthFailure"}, describe, false},
+		{reset, describe, true},
+		{reset, importKey, false},
+		{refused, importKey, true},
+		{errors.New("no AWS credentials found"), describe, false},
+	}
+
+	for _, c := range cases {
+		if retryable := isRetryableError(c.err, c.v); retryable != c.retryable {
+			t.Fatalf("expected isRetryableError(%v) of %s to be %t", c.err, c.v.Get("Action"), c.retryable)
+		}
+	}
+}
@@ -1,8 +1,36 @@
 package amz
 
+// IpPermission is an ingress rule of a security group. Rules are added with
+// a single IpRange and described with all their IpRanges.
 type IpPermission struct {
-	IpProtocol string `xml:"ipProtocol"`
-	FromPort   int    `xml:"fromPort"`
-	ToPort     int    `xml:"toPort"`
-	IpRange    string `xml:"ipRanges"`
+	IpProtocol string   `xml:"ipProtocol"`
+	FromPort   int      `xml:"fromPort"`
+	ToPort     int      `xml:"toPort"`
+	IpRange    string   `xml:"-"`
+	IpRanges   []string `xml:"ipRanges>item>cidrIp"`
+}
+
+// Allows reports whether the rule opens a TCP port to a CIDR
+func (p IpPermission) Allows(port int, cidr string) bool {
+	for _, r := range p.AllowedRanges(port) {
+		if r == cidr || r == "0.0.0.0/0" {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowedRanges returns the CIDRs the rule opens a TCP port to
+func (p IpPermission) AllowedRanges(port int) []string {
+	if p.IpProtocol != "tcp" && p.IpProtocol != "-1" {
+		return nil
+	}
+	if p.IpProtocol == "tcp" && (port < p.FromPort || port > p.ToPort) {
+		return nil
+	}
+	ranges := append([]string{}, p.IpRanges...)
+	if p.IpRange != "" {
+		ranges = append(ranges, p.IpRange)
+	}
+	return ranges
 }
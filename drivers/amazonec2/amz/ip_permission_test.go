@@ -1 +1,64 @@
 package amz
+
+import (
+	"encoding/xml"
+	"testing"
+)
+
+func TestIpPermissionAllows(t *testing.T) {
+	group := SecurityGroup{}
+	if err := xml.Unmarshal([]byte(`<item>
+  <groupName>docker-machine</groupName>
+  <ipPermissions>
+    <item>
+      <ipProtocol>tcp</ipProtocol>
+      <fromPort>22</fromPort>
+      <toPort>22</toPort>
+      <ipRanges>
+        <item><cidrIp>10.0.0.0/8</cidrIp></item>
+        <item><cidrIp>192.168.0.0/16</cidrIp></item>
+      </ipRanges>
+    </item>
+    <item>
+      <ipProtocol>tcp</ipProtocol>
+      <fromPort>2000</fromPort>
+      <toPort>3000</toPort>
+      <ipRanges>
+        <item><cidrIp>0.0.0.0/0</cidrIp></item>
+      </ipRanges>
+    </item>
+  </ipPermissions>
+</item>`), &group); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(group.IpPermissions) != 2 {
+		t.Fatalf("expected 2 permissions; received %d", len(group.IpPermissions))
+	}
+	ssh, docker := group.IpPermissions[0], group.IpPermissions[1]
+	if len(ssh.IpRanges) != 2 || ssh.IpRanges[1] != "192.168.0.0/16" {
+		t.Fatalf("unexpected ranges %v", ssh.IpRanges)
+	}
+	if !ssh.Allows(22, "192.168.0.0/16") || ssh.Allows(22, "172.16.0.0/12") || ssh.Allows(2376, "10.0.0.0/8") {
+		t.Fatalf("unexpected ports allowed by %+v", ssh)
+	}
+	if !docker.Allows(2376, "172.16.0.0/12") || docker.Allows(22, "172.16.0.0/12") {
+		t.Fatalf("unexpected ports allowed by %+v", docker)
+	}
+	if (IpPermission{IpProtocol: "udp", FromPort: 22, ToPort: 22, IpRange: "0.0.0.0/0"}).Allows(22, "10.0.0.0/8") {
+		t.Fatal("expected a UDP rule not to allow a TCP port")
+	}
+	if !(IpPermission{IpProtocol: "-1", IpRange: "10.0.0.0/8"}).Allows(22, "10.0.0.0/8") {
+		t.Fatal("expected a rule for all protocols to allow any port")
+	}
+}
+
+func TestIpPermissionAllowedRanges(t *testing.T) {
+	p := IpPermission{IpProtocol: "tcp", FromPort: 2376, ToPort: 2377, IpRanges: []string{"0.0.0.0/0", "10.0.0.0/8"}}
+	if ranges := p.AllowedRanges(2376); len(ranges) != 2 || ranges[0] != "0.0.0.0/0" {
+		t.Fatalf("unexpected ranges %v", ranges)
+	}
+	if ranges := p.AllowedRanges(22); len(ranges) != 0 {
+		t.Fatalf("expected no ranges for port 22; received %v", ranges)
+	}
+}
@@ -0,0 +1,39 @@
+package amz
+
+type CreateSnapshotResponse struct {
+	RequestId string `xml:"requestId"`
+	Snapshot
+}
+
+type DescribeSnapshotsResponse struct {
+	RequestId   string     `xml:"requestId"`
+	SnapshotSet []Snapshot `xml:"snapshotSet>item"`
+	NextToken   string     `xml:"nextToken"`
+}
+
+type DeleteSnapshotResponse struct {
+	RequestId string `xml:"requestId"`
+	Return    bool   `xml:"return"`
+}
+
+type Snapshot struct {
+	SnapshotId  string `xml:"snapshotId"`
+	VolumeId    string `xml:"volumeId"`
+	Status      string `xml:"status"`
+	StartTime   string `xml:"startTime"`
+	Progress    string `xml:"progress"`
+	OwnerId     string `xml:"ownerId"`
+	VolumeSize  int64  `xml:"volumeSize"`
+	Description string `xml:"description"`
+	TagSet      []Tag  `xml:"tagSet>item"`
+}
+
+// Tag returns the value of the tag with the given key
+func (s Snapshot) Tag(key string) string {
+	for _, t := range s.TagSet {
+		if t.Key == key {
+			return t.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,53 @@
+package amz
+
+import (
+	"encoding/xml"
+	"testing"
+)
+
+const testDescribeSnapshots = `<DescribeSnapshotsResponse xmlns="http://ec2.amazonaws.com/doc/2014-06-15/">
+  <requestId>59dbff89-35bd-4eac-99ed-be587EXAMPLE</requestId>
+  <snapshotSet>
+    <item>
+      <snapshotId>snap-1a2b3c4d</snapshotId>
+      <volumeId>vol-1a2b3c4d</volumeId>
+      <status>pending</status>
+      <startTime>2015-03-01T10:00:00.000Z</startTime>
+      <progress>80%</progress>
+      <ownerId>111122223333</ownerId>
+      <volumeSize>16</volumeSize>
+      <description>Docker Machine snapshot clean of dev</description>
+      <tagSet>
+        <item>
+          <key>docker-machine</key>
+          <value>dev</value>
+        </item>
+        <item>
+          <key>docker-machine-snapshot</key>
+          <value>clean</value>
+        </item>
+      </tagSet>
+    </item>
+  </snapshotSet>
+</DescribeSnapshotsResponse>`
+
+func TestDescribeSnapshotsResponse(t *testing.T) {
+	response := DescribeSnapshotsResponse{}
+	if err := xml.Unmarshal([]byte(testDescribeSnapshots), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(response.SnapshotSet) != 1 {
+		t.Fatalf("expected 1 snapshot; received %d", len(response.SnapshotSet))
+	}
+	snapshot := response.SnapshotSet[0]
+	if snapshot.SnapshotId != "snap-1a2b3c4d" || snapshot.VolumeId != "vol-1a2b3c4d" || snapshot.VolumeSize != 16 {
+		t.Fatalf("unexpected snapshot %+v", snapshot)
+	}
+	if snapshot.Tag("docker-machine-snapshot") != "clean" {
+		t.Fatalf("expected snapshot tag clean; received %q", snapshot.Tag("docker-machine-snapshot"))
+	}
+	if snapshot.Tag("missing") != "" {
+		t.Fatal("expected no value for a missing tag")
+	}
+}
@@ -0,0 +1,76 @@
+package amz
+
+import "strings"
+
+type RequestSpotInstancesResponse struct {
+	RequestId              string                `xml:"requestId"`
+	SpotInstanceRequestSet []SpotInstanceRequest `xml:"spotInstanceRequestSet>item"`
+}
+
+type DescribeSpotInstanceRequestsResponse struct {
+	RequestId              string                `xml:"requestId"`
+	SpotInstanceRequestSet []SpotInstanceRequest `xml:"spotInstanceRequestSet>item"`
+}
+
+type CancelSpotInstanceRequestsResponse struct {
+	RequestId              string `xml:"requestId"`
+	SpotInstanceRequestSet []struct {
+		SpotInstanceRequestId string `xml:"spotInstanceRequestId"`
+		State                 string `xml:"state"`
+	} `xml:"spotInstanceRequestSet>item"`
+}
+
+type SpotInstanceRequest struct {
+	SpotInstanceRequestId string `xml:"spotInstanceRequestId"`
+	SpotPrice             string `xml:"spotPrice"`
+	Type                  string `xml:"type"`
+	State                 string `xml:"state"`
+	Fault                 struct {
+		Code    string `xml:"code"`
+		Message string `xml:"message"`
+	} `xml:"fault"`
+	Status struct {
+		Code       string `xml:"code"`
+		UpdateTime string `xml:"updateTime"`
+		Message    string `xml:"message"`
+	} `xml:"status"`
+	InstanceId               string `xml:"instanceId"`
+	CreateTime               string `xml:"createTime"`
+	LaunchedAvailabilityZone string `xml:"launchedAvailabilityZone"`
+}
+
+// IsOpen reports whether the request may still launch an instance
+func (r SpotInstanceRequest) IsOpen() bool {
+	return r.State == "open"
+}
+
+// IsFinal reports whether the request can no longer launch an instance
+// without having launched one
+func (r SpotInstanceRequest) IsFinal() bool {
+	switch r.State {
+	case "cancelled", "failed":
+		return true
+	case "closed":
+		return r.InstanceId == ""
+	}
+	return false
+}
+
+// Reclaimed reports whether AWS terminated the instance of the request,
+// e.g. because the spot price went above the bid; instances terminated
+// by their owner are not reclaimed
+func (r SpotInstanceRequest) Reclaimed() bool {
+	return strings.HasPrefix(r.Status.Code, "instance-terminated-") &&
+		r.Status.Code != "instance-terminated-by-user"
+}
+
+// StatusMessage describes the status of the request
+func (r SpotInstanceRequest) StatusMessage() string {
+	if r.Status.Message != "" {
+		return r.Status.Message
+	}
+	if r.Fault.Message != "" {
+		return r.Fault.Message
+	}
+	return r.Status.Code
+}
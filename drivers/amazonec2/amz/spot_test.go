@@ -0,0 +1,109 @@
+package amz
+
+import (
+	"encoding/xml"
+	"net/url"
+	"testing"
+)
+
+const testDescribeSpotInstanceRequests = `<DescribeSpotInstanceRequestsResponse xmlns="http://ec2.amazonaws.com/doc/2014-06-15/">
+  <requestId>d9da716e-1c3e-4ba3-8a41-07a2aEXAMPLE</requestId>
+  <spotInstanceRequestSet>
+    <item>
+      <spotInstanceRequestId>sir-1a2b3c4d</spotInstanceRequestId>
+      <spotPrice>0.500000</spotPrice>
+      <type>one-time</type>
+      <state>closed</state>
+      <status>
+        <code>instance-terminated-by-price</code>
+        <updateTime>2015-03-01T10:00:00.000Z</updateTime>
+        <message>Your Spot Instance was terminated because your Spot request price is lower than the Spot price.</message>
+      </status>
+      <instanceId>i-1a2b3c4d</instanceId>
+      <createTime>2015-03-01T09:00:00.000Z</createTime>
+      <launchedAvailabilityZone>us-east-1e</launchedAvailabilityZone>
+    </item>
+  </spotInstanceRequestSet>
+</DescribeSpotInstanceRequestsResponse>`
+
+func TestDescribeSpotInstanceRequestsResponse(t *testing.T) {
+	response := DescribeSpotInstanceRequestsResponse{}
+	if err := xml.Unmarshal([]byte(testDescribeSpotInstanceRequests), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(response.SpotInstanceRequestSet) != 1 {
+		t.Fatalf("expected 1 spot instance request; received %d", len(response.SpotInstanceRequestSet))
+	}
+	request := response.SpotInstanceRequestSet[0]
+	if request.SpotInstanceRequestId != "sir-1a2b3c4d" || request.InstanceId != "i-1a2b3c4d" || request.State != "closed" {
+		t.Fatalf("unexpected spot instance request %+v", request)
+	}
+	if !request.Reclaimed() {
+		t.Fatal("expected the instance to be reclaimed")
+	}
+	if request.IsOpen() || request.IsFinal() {
+		t.Fatal("expected a closed request with an instance to be neither open nor final")
+	}
+}
+
+func TestSpotInstanceRequestStates(t *testing.T) {
+	request := SpotInstanceRequest{State: "open"}
+	request.Status.Code = "price-too-low"
+	if !request.IsOpen() || request.IsFinal() || request.Reclaimed() {
+		t.Fatalf("unexpected states of %+v", request)
+	}
+	if request.StatusMessage() != "price-too-low" {
+		t.Fatalf("expected the status code as message; received %q", request.StatusMessage())
+	}
+
+	request = SpotInstanceRequest{State: "closed"}
+	request.Status.Code = "instance-terminated-by-user"
+	request.InstanceId = "i-1a2b3c4d"
+	if request.Reclaimed() {
+		t.Fatal("expected an instance terminated by its owner not to be reclaimed")
+	}
+
+	for _, s := range []string{"cancelled", "failed", "closed"} {
+		request = SpotInstanceRequest{State: s}
+		if !request.IsFinal() {
+			t.Fatalf("expected a %s request without instance to be final", s)
+		}
+	}
+}
+
+func TestSetLaunchSpecification(t *testing.T) {
+	e := NewEC2(Auth{}, "us-east-1")
+	v := url.Values{}
+	bdms := []BlockDeviceMapping{
+		{DeviceName: "/dev/sda1", VolumeSize: 16, VolumeType: "gp2", DeleteOnTermination: true},
+		{DeviceName: "/dev/sdf", VolumeSize: 500, VolumeType: "io1", Iops: 4000, Encrypted: true},
+	}
+	e.setLaunchSpecification(v, "LaunchSpecification.", "ami-123", "t2.micro", "e", []string{"sg-123", "sg-456"}, "test", "subnet-123", bdms, "", true)
+
+	expected := map[string]string{
+		"LaunchSpecification.ImageId":                                      "ami-123",
+		"LaunchSpecification.InstanceType":                                 "t2.micro",
+		"LaunchSpecification.Placement.AvailabilityZone":                   "us-east-1e",
+		"LaunchSpecification.NetworkInterface.0.SecurityGroupId.0":         "sg-123",
+		"LaunchSpecification.NetworkInterface.0.SubnetId":                  "subnet-123",
+		"LaunchSpecification.BlockDeviceMapping.0.Ebs.VolumeSize":          "16",
+		"LaunchSpecification.BlockDeviceMapping.0.Ebs.DeleteOnTermination": "1",
+		"LaunchSpecification.BlockDeviceMapping.1.DeviceName":              "/dev/sdf",
+		"LaunchSpecification.BlockDeviceMapping.1.Ebs.Iops":                "4000",
+		"LaunchSpecification.BlockDeviceMapping.1.Ebs.Encrypted":           "true",
+		"LaunchSpecification.BlockDeviceMapping.1.Ebs.DeleteOnTermination": "0",
+		"LaunchSpecification.NetworkInterface.0.AssociatePublicIpAddress":  "0",
+	}
+	for key, value := range expected {
+		if v.Get(key) != value {
+			t.Fatalf("expected %s=%s; received %q", key, value, v.Get(key))
+		}
+	}
+	if _, ok := v["LaunchSpecification.IamInstanceProfile.Name"]; ok {
+		t.Fatal("expected no instance profile")
+	}
+	if _, ok := v["LaunchSpecification.BlockDeviceMapping.0.Ebs.Iops"]; ok {
+		t.Fatal("expected no IOPS for a gp2 volume")
+	}
+}
@@ -4,3 +4,8 @@ type CreateTagsResponse struct {
 	RequestId string `xml:"requestId"`
 	Return    bool   `xml:"return"`
 }
+
+type Tag struct {
+	Key   string `xml:"key"`
+	Value string `xml:"value"`
+}
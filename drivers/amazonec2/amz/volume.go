@@ -0,0 +1,35 @@
+package amz
+
+type CreateVolumeResponse struct {
+	RequestId string `xml:"requestId"`
+	Volume
+}
+
+type DescribeVolumesResponse struct {
+	RequestId string   `xml:"requestId"`
+	VolumeSet []Volume `xml:"volumeSet>item"`
+}
+
+type VolumeAttachmentResponse struct {
+	RequestId  string `xml:"requestId"`
+	VolumeId   string `xml:"volumeId"`
+	InstanceId string `xml:"instanceId"`
+	Device     string `xml:"device"`
+	Status     string `xml:"status"`
+}
+
+type Volume struct {
+	VolumeId         string `xml:"volumeId"`
+	Size             int64  `xml:"size"`
+	SnapshotId       string `xml:"snapshotId"`
+	AvailabilityZone string `xml:"availabilityZone"`
+	Status           string `xml:"status"`
+	CreateTime       string `xml:"createTime"`
+	VolumeType       string `xml:"volumeType"`
+	AttachmentSet    []struct {
+		InstanceId          string `xml:"instanceId"`
+		Device              string `xml:"device"`
+		Status              string `xml:"status"`
+		DeleteOnTermination bool   `xml:"deleteOnTermination"`
+	} `xml:"attachmentSet>item"`
+}
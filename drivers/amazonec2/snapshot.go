@@ -0,0 +1,220 @@
+package amazonec2
+
+import (
+	"fmt"
+	"sort"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/machine/drivers"
+	"github.com/docker/machine/drivers/amazonec2/amz"
+	"github.com/docker/machine/utils"
+)
+
+const (
+	machineTag  = "docker-machine"
+	snapshotTag = "docker-machine-snapshot"
+)
+
+// CreateSnapshot takes an EBS snapshot of the root volume of the instance,
+// tagged with the machine and snapshot names
+func (d *Driver) CreateSnapshot(name string) error {
+	if _, err := d.getSnapshot(name); err == nil {
+		return fmt.Errorf("snapshot %s of %s already exists", name, d.MachineName)
+	}
+
+	inst, err := d.getInstance()
+	if err != nil {
+		return err
+	}
+	volumeId := inst.RootVolumeId()
+	if volumeId == "" {
+		return fmt.Errorf("instance %s has no EBS root volume", d.InstanceId)
+	}
+
+	log.Debugf("creating snapshot of volume %s", volumeId)
+	snapshot, err := d.getClient().CreateSnapshot(volumeId, fmt.Sprintf("Docker Machine snapshot %s of %s", name, d.MachineName))
+	if err != nil {
+		return err
+	}
+
+	tags := map[string]string{
+		"Name":      fmt.Sprintf("%s-%s", d.MachineName, name),
+		machineTag:  d.MachineName,
+		snapshotTag: name,
+	}
+	return d.getClient().CreateTags(snapshot.SnapshotId, tags)
+}
+
+// ListSnapshots returns the snapshots of the machine, oldest first. The
+// current snapshot is the one the root volume was restored from.
+func (d *Driver) ListSnapshots() ([]*drivers.Snapshot, error) {
+	snapshots, err := d.getClient().GetSnapshots([]amz.Filter{{Name: "tag:" + machineTag, Value: d.MachineName}})
+	if err != nil {
+		return nil, err
+	}
+
+	currentId := ""
+	inst, err := d.getInstance()
+	if err != nil {
+		return nil, err
+	}
+	if volumeId := inst.RootVolumeId(); volumeId != "" {
+		volume, err := d.getClient().GetVolume(volumeId)
+		if err != nil {
+			return nil, err
+		}
+		currentId = volume.SnapshotId
+	}
+
+	return machineSnapshots(snapshots, currentId), nil
+}
+
+// RestoreSnapshot replaces the root volume of the stopped instance with a
+// new volume created from the snapshot and deletes the old volume
+func (d *Driver) RestoreSnapshot(name string) error {
+	snapshot, err := d.getSnapshot(name)
+	if err != nil {
+		return err
+	}
+
+	inst, err := d.getInstance()
+	if err != nil {
+		return err
+	}
+	if inst.InstanceState.Name != "stopped" {
+		return fmt.Errorf("instance %s must be stopped to restore a snapshot", d.InstanceId)
+	}
+	oldVolumeId := inst.RootVolumeId()
+
+	log.Debugf("waiting for snapshot %s to complete", snapshot.SnapshotId)
+	if err := utils.WaitFor(d.snapshotCompletedFunc(snapshot.SnapshotId)); err != nil {
+		return err
+	}
+
+	client := d.getClient()
+
+	// the new volume keeps the type of the root volume, which is only
+	// recorded for machines created with volume options
+	volumeType, iops := defaultVolumeType, int64(0)
+	root := d.rootBlockDeviceMapping(inst.RootDeviceName)
+	if root != nil && root.VolumeType != "" {
+		volumeType, iops = root.VolumeType, root.Iops
+	}
+
+	volume, err := client.CreateVolume(snapshot.SnapshotId, inst.Placement.AvailabilityZone, volumeType, iops)
+	if err != nil {
+		return err
+	}
+	log.Debugf("waiting for volume %s to become available", volume.VolumeId)
+	if err := utils.WaitFor(d.volumeInStatusFunc(volume.VolumeId, "available")); err != nil {
+		return err
+	}
+
+	if oldVolumeId != "" {
+		log.Debugf("detaching volume %s", oldVolumeId)
+		if err := client.DetachVolume(oldVolumeId); err != nil {
+			return err
+		}
+		if err := utils.WaitFor(d.volumeInStatusFunc(oldVolumeId, "available")); err != nil {
+			return err
+		}
+	}
+
+	log.Debugf("attaching volume %s at %s", volume.VolumeId, inst.RootDeviceName)
+	if err := client.AttachVolume(volume.VolumeId, d.InstanceId, inst.RootDeviceName); err != nil {
+		return err
+	}
+	if err := utils.WaitFor(d.volumeInStatusFunc(volume.VolumeId, "in-use")); err != nil {
+		return err
+	}
+	if err := client.SetDeleteOnTermination(d.InstanceId, inst.RootDeviceName); err != nil {
+		return err
+	}
+	if root != nil {
+		root.VolumeId = volume.VolumeId
+	}
+
+	if oldVolumeId != "" {
+		log.Debugf("deleting volume %s", oldVolumeId)
+		if err := client.DeleteVolume(oldVolumeId); err != nil {
+			log.Warnf("Error deleting the previous root volume %s: %s", oldVolumeId, err)
+		}
+	}
+	return nil
+}
+
+// rootBlockDeviceMapping returns the recorded mapping of the root device
+func (d *Driver) rootBlockDeviceMapping(deviceName string) *amz.BlockDeviceMapping {
+	for i := range d.BlockDeviceMappings {
+		if d.BlockDeviceMappings[i].DeviceName == deviceName {
+			return &d.BlockDeviceMappings[i]
+		}
+	}
+	return nil
+}
+
+// RemoveSnapshot deletes the EBS snapshot
+func (d *Driver) RemoveSnapshot(name string) error {
+	snapshot, err := d.getSnapshot(name)
+	if err != nil {
+		return err
+	}
+	return d.getClient().DeleteSnapshot(snapshot.SnapshotId)
+}
+
+func (d *Driver) getSnapshot(name string) (*amz.Snapshot, error) {
+	snapshots, err := d.getClient().GetSnapshots([]amz.Filter{
+		{Name: "tag:" + machineTag, Value: d.MachineName},
+		{Name: "tag:" + snapshotTag, Value: name},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(snapshots) == 0 {
+		return nil, fmt.Errorf("%s has no snapshot %s", d.MachineName, name)
+	}
+	return &snapshots[0], nil
+}
+
+func (d *Driver) snapshotCompletedFunc(id string) func() bool {
+	return func() bool {
+		snapshot, err := d.getClient().GetSnapshot(id)
+		if err != nil {
+			log.Debug(err)
+			return false
+		}
+		return snapshot.Status == "completed"
+	}
+}
+
+func (d *Driver) volumeInStatusFunc(id string, status string) func() bool {
+	return func() bool {
+		volume, err := d.getClient().GetVolume(id)
+		if err != nil {
+			log.Debug(err)
+			return false
+		}
+		return volume.Status == status
+	}
+}
+
+type snapshotsByStartTime []amz.Snapshot
+
+func (s snapshotsByStartTime) Len() int           { return len(s) }
+func (s snapshotsByStartTime) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s snapshotsByStartTime) Less(i, j int) bool { return s[i].StartTime < s[j].StartTime }
+
+// machineSnapshots converts EBS snapshots to machine snapshots, oldest first
+func machineSnapshots(snapshots []amz.Snapshot, currentId string) []*drivers.Snapshot {
+	sort.Sort(snapshotsByStartTime(snapshots))
+
+	result := []*drivers.Snapshot{}
+	for _, s := range snapshots {
+		result = append(result, &drivers.Snapshot{
+			Name:    s.Tag(snapshotTag),
+			ID:      s.SnapshotId,
+			Current: s.SnapshotId == currentId,
+		})
+	}
+	return result
+}
@@ -0,0 +1,82 @@
+package amazonec2
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/docker/machine/drivers/amazonec2/amz"
+)
+
+func TestMachineSnapshots(t *testing.T) {
+	snapshots := machineSnapshots([]amz.Snapshot{
+		{SnapshotId: "snap-2", StartTime: "2015-03-02T10:00:00.000Z", TagSet: []amz.Tag{{Key: snapshotTag, Value: "images"}}},
+		{SnapshotId: "snap-1", StartTime: "2015-03-01T10:00:00.000Z", TagSet: []amz.Tag{{Key: snapshotTag, Value: "clean"}}},
+	}, "snap-2")
+
+	if len(snapshots) != 2 {
+		t.Fatalf("expected 2 snapshots; received %d", len(snapshots))
+	}
+	if snapshots[0].Name != "clean" || snapshots[0].ID != "snap-1" || snapshots[0].Current {
+		t.Fatalf("unexpected first snapshot %+v", *snapshots[0])
+	}
+	if snapshots[1].Name != "images" || snapshots[1].ID != "snap-2" || !snapshots[1].Current {
+		t.Fatalf("unexpected second snapshot %+v", *snapshots[1])
+	}
+}
+
+func TestRestoreSnapshotKeepsRootVolume(t *testing.T) {
+	d, err := getTestDriver()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.InstanceId = "i-1"
+	d.BlockDeviceMappings = []amz.BlockDeviceMapping{
+		{DeviceName: rootDeviceName, VolumeType: "io1", Iops: 1000, VolumeId: "vol-root"},
+	}
+
+	attached := false
+	server, calls := testEC2Server(d, func(v url.Values) (int, string) {
+		switch v.Get("Action") {
+		case "DescribeSnapshots":
+			return http.StatusOK, `<DescribeSnapshotsResponse><snapshotSet><item>
+  <snapshotId>snap-1</snapshotId><status>completed</status>
+</item></snapshotSet></DescribeSnapshotsResponse>`
+		case "DescribeInstances":
+			return http.StatusOK, `<DescribeInstancesResponse><reservationSet><item><instancesSet><item>
+  <instanceId>i-1</instanceId><instanceState><name>stopped</name></instanceState>
+  <placement><availabilityZone>us-east-1a</availabilityZone></placement>
+  <rootDeviceName>/dev/sda1</rootDeviceName>
+  <blockDeviceMapping><item><deviceName>/dev/sda1</deviceName><ebs><volumeId>vol-root</volumeId></ebs></item></blockDeviceMapping>
+</item></instancesSet></item></reservationSet></DescribeInstancesResponse>`
+		case "CreateVolume":
+			return http.StatusOK, `<CreateVolumeResponse><volumeId>vol-new</volumeId><status>creating</status></CreateVolumeResponse>`
+		case "DescribeVolumes":
+			status := "available"
+			if v.Get("VolumeId.1") == "vol-new" && attached {
+				status = "in-use"
+			}
+			return http.StatusOK, fmt.Sprintf(`<DescribeVolumesResponse><volumeSet><item>
+  <volumeId>%s</volumeId><status>%s</status>
+</item></volumeSet></DescribeVolumesResponse>`, v.Get("VolumeId.1"), status)
+		case "AttachVolume":
+			attached = true
+		}
+		return http.StatusOK, "<Response><return>true</return></Response>"
+	})
+	defer server.Close()
+
+	if err := d.RestoreSnapshot("clean"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range *calls {
+		if v.Get("Action") == "CreateVolume" && (v.Get("VolumeType") != "io1" || v.Get("Iops") != "1000") {
+			t.Fatalf("expected an io1 volume with 1000 IOPS; received %v", v)
+		}
+	}
+	if id := d.BlockDeviceMappings[0].VolumeId; id != "vol-new" {
+		t.Fatalf("expected the root volume vol-new to be recorded; received %s", id)
+	}
+}
@@ -1,6 +1,7 @@
 package azure
 
 import (
+	"encoding/xml"
 	"errors"
 	"fmt"
 	"net"
@@ -24,6 +25,8 @@ import (
 
 const (
 	dockerConfigDir = "/etc/docker"
+	azureRoleURL    = "services/hostedservices/%s/deployments/%s/roles/%s"
+	azureXmlns      = "http://schemas.microsoft.com/windowsazure"
 )
 
 type Driver struct {
@@ -117,12 +120,43 @@ func NewDriver(machineName string, storePath string, caCert string, privateKey s
 	return d, nil
 }
 
+// AuthorizePort adds an endpoint for each port to the VM. Endpoint ACLs are
+// not supported by the SDK, so ports can not be restricted to a CIDR.
 func (d *Driver) AuthorizePort(ports []*drivers.Port) error {
-	return nil
+	for _, p := range ports {
+		if p.CIDR != "" {
+			return fmt.Errorf("azure endpoints can not be restricted to %s", p.CIDR)
+		}
+	}
+	return d.updateEndpoints(func(configSet *vmClient.ConfigurationSet) {
+		for _, p := range ports {
+			ep := vmClient.InputEndpoint{
+				Name:      endpointName(p),
+				Protocol:  p.Protocol,
+				Port:      p.Port,
+				LocalPort: p.Port,
+			}
+			configSet.InputEndpoints.InputEndpoint = append(configSet.InputEndpoints.InputEndpoint, ep)
+		}
+	})
 }
 
 func (d *Driver) DeauthorizePort(ports []*drivers.Port) error {
-	return nil
+	return d.updateEndpoints(func(configSet *vmClient.ConfigurationSet) {
+		endpoints := []vmClient.InputEndpoint{}
+		for _, ep := range configSet.InputEndpoints.InputEndpoint {
+			keep := true
+			for _, p := range ports {
+				if ep.Name == endpointName(p) {
+					keep = false
+				}
+			}
+			if keep {
+				endpoints = append(endpoints, ep)
+			}
+		}
+		configSet.InputEndpoints.InputEndpoint = endpoints
+	})
 }
 
 func (d *Driver) GetMachineName() string {
@@ -428,6 +462,64 @@ func (d *Driver) addDockerEndpoint(vmConfig *vmClient.Role) error {
 	return nil
 }
 
+func endpointName(p *drivers.Port) string {
+	return fmt.Sprintf("%s%d", p.Protocol, p.Port)
+}
+
+// persistentVMRole is the body of an Update Role request, which the SDK
+// does not implement
+type persistentVMRole struct {
+	XMLName             xml.Name `xml:"PersistentVMRole"`
+	Xmlns               string   `xml:"xmlns,attr"`
+	RoleName            string
+	RoleType            string
+	ConfigurationSets   vmClient.ConfigurationSets
+	OSVirtualHardDisk   vmClient.OSVirtualHardDisk
+	RoleSize            string
+	ProvisionGuestAgent bool
+}
+
+// updateEndpoints applies update to the network configuration of the VM's
+// role and sends the role back to Azure
+func (d *Driver) updateEndpoints(update func(*vmClient.ConfigurationSet)) error {
+	if err := d.setUserSubscription(); err != nil {
+		return err
+	}
+
+	role, err := vmClient.GetRole(d.MachineName, d.MachineName, d.MachineName)
+	if err != nil {
+		return err
+	}
+
+	configSets := role.ConfigurationSets.ConfigurationSet
+	for i := range configSets {
+		if configSets[i].ConfigurationSetType == "NetworkConfiguration" {
+			update(&configSets[i])
+		}
+	}
+
+	data, err := xml.Marshal(persistentVMRole{
+		Xmlns:               azureXmlns,
+		RoleName:            role.RoleName,
+		RoleType:            role.RoleType,
+		ConfigurationSets:   role.ConfigurationSets,
+		OSVirtualHardDisk:   role.OSVirtualHardDisk,
+		RoleSize:            role.RoleSize,
+		ProvisionGuestAgent: role.ProvisionGuestAgent,
+	})
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf(azureRoleURL, d.MachineName, d.MachineName, d.MachineName)
+	resp, err := azure.SendAzureRequest(url, "PUT", data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return azure.WaitAsyncOperation(resp.Header.Get("x-ms-request-id"))
+}
+
 func (d *Driver) waitForSSH() error {
 	log.Infof("Waiting for SSH...")
 	return ssh.WaitForTCP(fmt.Sprintf("%s:%v", d.getHostname(), d.SSHPort))
@@ -354,6 +354,23 @@ func (d *Driver) Kill() error {
 	return err
 }
 
+// Resize changes the size of the droplet, which must be off. The disk is
+// not resized, so the droplet can be resized down again.
+func (d *Driver) Resize(cpus int, memory int, size string) error {
+	if cpus > 0 || memory > 0 {
+		return fmt.Errorf("the CPUs and memory of droplets are set by their size; use --size to choose a droplet size")
+	}
+	action, _, err := d.getClient().DropletActions.Resize(d.DropletID, size)
+	if err != nil {
+		return err
+	}
+	if err := d.waitForAction(action); err != nil {
+		return err
+	}
+	d.Size = size
+	return nil
+}
+
 func (d *Driver) StartDocker() error {
 	log.Debug("Starting Docker...")
 
@@ -0,0 +1,170 @@
+package digitalocean
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/digitalocean/godo"
+	"github.com/docker/machine/drivers"
+	"github.com/docker/machine/state"
+	"github.com/docker/machine/utils"
+)
+
+// dropletSnapshot is an image in the list of snapshots of a droplet, which
+// godo does not provide
+type dropletSnapshot struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// CreateSnapshot takes a snapshot of the droplet. The droplet is shut down
+// for the snapshot and powered on again afterwards.
+func (d *Driver) CreateSnapshot(name string) error {
+	if _, err := d.getSnapshot(name); err == nil {
+		return fmt.Errorf("snapshot %s of %s already exists", name, d.MachineName)
+	}
+
+	currentState, err := d.GetState()
+	if err != nil {
+		return err
+	}
+	if currentState == state.Running {
+		log.Infof("Shutting down %s for the snapshot...", d.MachineName)
+		action, _, err := d.getClient().DropletActions.Shutdown(d.DropletID)
+		if err != nil {
+			return err
+		}
+		if err := d.waitForAction(action); err != nil {
+			return err
+		}
+	}
+
+	client := d.getClient()
+	req, err := client.NewRequest("POST", fmt.Sprintf("v2/droplets/%d/actions", d.DropletID), &godo.ActionRequest{
+		Type:   "snapshot",
+		Params: map[string]interface{}{"name": name},
+	})
+	if err != nil {
+		return err
+	}
+	root := struct {
+		Action godo.Action `json:"action"`
+	}{}
+	if _, err := client.Do(req, &root); err != nil {
+		return err
+	}
+
+	log.Infof("Waiting for snapshot %s of %s...", name, d.MachineName)
+	if err := d.waitForAction(&root.Action); err != nil {
+		return err
+	}
+
+	if currentState == state.Running {
+		action, _, err := d.getClient().DropletActions.PowerOn(d.DropletID)
+		if err != nil {
+			return err
+		}
+		return d.waitForAction(action)
+	}
+	return nil
+}
+
+// ListSnapshots returns the snapshots of the droplet, oldest first
+func (d *Driver) ListSnapshots() ([]*drivers.Snapshot, error) {
+	snapshots, err := d.getSnapshots()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []*drivers.Snapshot{}
+	for _, s := range snapshots {
+		result = append(result, &drivers.Snapshot{Name: s.Name, ID: fmt.Sprintf("%d", s.ID)})
+	}
+	return result, nil
+}
+
+// RestoreSnapshot rebuilds the droplet from the snapshot
+func (d *Driver) RestoreSnapshot(name string) error {
+	snapshot, err := d.getSnapshot(name)
+	if err != nil {
+		return err
+	}
+
+	action, _, err := d.getClient().DropletActions.Restore(d.DropletID, snapshot.ID)
+	if err != nil {
+		return err
+	}
+	return d.waitForAction(action)
+}
+
+// RemoveSnapshot deletes the snapshot image
+func (d *Driver) RemoveSnapshot(name string) error {
+	snapshot, err := d.getSnapshot(name)
+	if err != nil {
+		return err
+	}
+
+	client := d.getClient()
+	req, err := client.NewRequest("DELETE", fmt.Sprintf("v2/images/%d", snapshot.ID), nil)
+	if err != nil {
+		return err
+	}
+	_, err = client.Do(req, nil)
+	return err
+}
+
+func (d *Driver) getSnapshots() ([]dropletSnapshot, error) {
+	client := d.getClient()
+	req, err := client.NewRequest("GET", fmt.Sprintf("v2/droplets/%d/snapshots", d.DropletID), nil)
+	if err != nil {
+		return nil, err
+	}
+	root := struct {
+		Snapshots []dropletSnapshot `json:"snapshots"`
+	}{}
+	if _, err := client.Do(req, &root); err != nil {
+		return nil, err
+	}
+	return root.Snapshots, nil
+}
+
+func (d *Driver) getSnapshot(name string) (*dropletSnapshot, error) {
+	snapshots, err := d.getSnapshots()
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range snapshots {
+		if s.Name == name {
+			return &s, nil
+		}
+	}
+	return nil, fmt.Errorf("%s has no snapshot %s", d.MachineName, name)
+}
+
+// waitForAction waits for a droplet action to complete; snapshots can take
+// several minutes
+func (d *Driver) waitForAction(action *godo.Action) error {
+	var lastErr error
+	completed := func() bool {
+		a, _, err := d.getClient().DropletActions.Get(d.DropletID, action.ID)
+		if err != nil {
+			log.Debugf("Error getting action %d: %s", action.ID, err)
+			return false
+		}
+		switch a.Status {
+		case "completed":
+			lastErr = nil
+			return true
+		case "errored":
+			lastErr = fmt.Errorf("%s of %s failed", a.Type, d.MachineName)
+			return true
+		}
+		return false
+	}
+
+	if err := utils.WaitForSpecific(completed, 120, 5*time.Second); err != nil {
+		return err
+	}
+	return lastErr
+}
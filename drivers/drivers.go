@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os/exec"
 	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/codegangsta/cli"
 	"github.com/docker/machine/provider"
@@ -15,6 +17,84 @@ import (
 type Port struct {
 	Protocol string
 	Port     int
+	// CIDR restricts access to the port to a source range; empty means
+	// anywhere
+	CIDR string
+}
+
+func (p *Port) String() string {
+	return fmt.Sprintf("%d/%s", p.Port, p.Protocol)
+}
+
+// ParsePort parses a port such as "80/tcp" or "53/udp"; the protocol
+// defaults to tcp
+func ParsePort(value string) (*Port, error) {
+	parts := strings.SplitN(value, "/", 2)
+	protocol := "tcp"
+	if len(parts) == 2 {
+		protocol = strings.ToLower(parts[1])
+	}
+	if protocol != "tcp" && protocol != "udp" {
+		return nil, fmt.Errorf("invalid protocol %q in port %q: must be tcp or udp", protocol, value)
+	}
+
+	port, err := strconv.Atoi(parts[0])
+	if err != nil || port < 1 || port > 65535 {
+		return nil, fmt.Errorf("invalid port %q", value)
+	}
+
+	return &Port{Protocol: protocol, Port: port}, nil
+}
+
+// Share is a host directory shared with a machine under Name
+type Share struct {
+	HostPath string
+	Name     string
+}
+
+// Sharer is implemented by drivers which can share host directories with
+// the machine. Shares can only be changed while the machine is stopped.
+type Sharer interface {
+	// AddShare shares hostPath at guestPath, which defaults to hostPath
+	AddShare(hostPath string, guestPath string) error
+
+	// RemoveShare stops sharing the directory at the given guest or host path
+	RemoveShare(path string) error
+
+	// ListShares returns the shared directories
+	ListShares() []*Share
+}
+
+// Snapshot is a saved state of a machine's disk
+type Snapshot struct {
+	Name    string
+	ID      string
+	Current bool
+}
+
+// Snapshotter is implemented by drivers which can save and restore the
+// state of a machine, e.g. as VM snapshots, volume snapshots or images.
+// Snapshots are restored while the machine is stopped.
+type Snapshotter interface {
+	// CreateSnapshot saves the state of the machine under name
+	CreateSnapshot(name string) error
+
+	// ListSnapshots returns the snapshots of the machine, oldest first
+	ListSnapshots() ([]*Snapshot, error)
+
+	// RestoreSnapshot returns the machine to the snapshot with the given name
+	RestoreSnapshot(name string) error
+
+	// RemoveSnapshot deletes the snapshot with the given name
+	RemoveSnapshot(name string) error
+}
+
+// Resizer is implemented by drivers which can change the resources of an
+// existing machine. Machines are resized while they are stopped.
+type Resizer interface {
+	// Resize sets the number of CPUs, the memory in MB or the instance size,
+	// e.g. an instance type or flavor; zero values are left unchanged
+	Resize(cpus int, memory int, size string) error
 }
 
 // Driver defines how a host is created and controlled. Different types of
@@ -92,9 +172,12 @@ type Driver interface {
 //   configuration in
 // - RegisterCreateFlags: a function that takes the FlagSet for
 //   "docker hosts create" and returns an object to pass to SetConfigFromFlags
+// - Plugin: whether the driver is served by a plugin executable; built-in
+//   drivers replace plugins of the same name
 type RegisteredDriver struct {
 	New            func(machineName string, storePath string, caCert string, privateKey string) (Driver, error)
 	GetCreateFlags func() []cli.Flag
+	Plugin         bool
 }
 
 var ErrHostIsNotRunning = errors.New("host is not running")
@@ -109,7 +192,7 @@ func init() {
 
 // Register a driver
 func Register(name string, registeredDriver *RegisteredDriver) error {
-	if _, exists := drivers[name]; exists {
+	if existing, exists := drivers[name]; exists && (!existing.Plugin || registeredDriver.Plugin) {
 		return fmt.Errorf("Name already registered %s", name)
 	}
 
@@ -126,13 +209,27 @@ func NewDriver(name string, machineName string, storePath string, caCert string,
 	return driver.New(machineName, storePath, caCert, privateKey)
 }
 
-// GetCreateFlags runs GetCreateFlags for all of the drivers and
-// returns their return values indexed by the driver name
+// GetCreateFlags runs GetCreateFlags for all of the built-in drivers and
+// returns their return values indexed by the driver name. Plugins are left
+// out since asking them for their flags starts them; see
+// GetPluginCreateFlags.
 func GetCreateFlags() []cli.Flag {
+	return getCreateFlags(false)
+}
+
+// GetPluginCreateFlags returns the flags of the drivers served by plugins
+func GetPluginCreateFlags() []cli.Flag {
+	return getCreateFlags(true)
+}
+
+func getCreateFlags(plugins bool) []cli.Flag {
 	flags := []cli.Flag{}
 
 	for driverName := range drivers {
 		driver := drivers[driverName]
+		if driver.Plugin != plugins {
+			continue
+		}
 		for _, f := range driver.GetCreateFlags() {
 			flags = append(flags, f)
 		}
@@ -155,6 +252,7 @@ func GetDriverNames() []string {
 
 type DriverOptions interface {
 	String(key string) string
+	StringSlice(key string) []string
 	Int(key string) int
 	Bool(key string) bool
 }
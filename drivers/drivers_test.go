@@ -1,6 +1,7 @@
 package drivers
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/codegangsta/cli"
@@ -75,3 +76,80 @@ func TestGetCreateFlags(t *testing.T) {
 		}
 	}
 }
+
+func TestRegisterPlugin(t *testing.T) {
+	newDriver := func(machineName string, storePath string, caCert string, privateKey string) (Driver, error) {
+		return nil, nil
+	}
+	noFlags := func() []cli.Flag { return []cli.Flag{} }
+	plugin := &RegisteredDriver{New: newDriver, GetCreateFlags: noFlags, Plugin: true}
+	builtIn := &RegisteredDriver{New: newDriver, GetCreateFlags: noFlags}
+	defer delete(drivers, "plugged")
+
+	if err := Register("plugged", plugin); err != nil {
+		t.Fatal(err)
+	}
+	if err := Register("plugged", plugin); err == nil {
+		t.Fatal("expected an error registering a plugin twice")
+	}
+	if err := Register("plugged", builtIn); err != nil {
+		t.Fatalf("expected a built-in driver to replace a plugin; received %s", err)
+	}
+	if drivers["plugged"] != builtIn {
+		t.Fatal("expected the built-in driver to be registered")
+	}
+	if err := Register("plugged", plugin); err == nil {
+		t.Fatal("expected an error registering a plugin over a built-in driver")
+	}
+}
+
+func TestGetPluginCreateFlags(t *testing.T) {
+	newDriver := func(machineName string, storePath string, caCert string, privateKey string) (Driver, error) {
+		return nil, nil
+	}
+	pluginFlags := func() []cli.Flag { return []cli.Flag{cli.StringFlag{Name: "plugged-region"}} }
+	builtInFlags := func() []cli.Flag { return []cli.Flag{cli.StringFlag{Name: "built-in-region"}} }
+	defer delete(drivers, "plugged")
+	defer delete(drivers, "built-in")
+
+	if err := Register("plugged", &RegisteredDriver{New: newDriver, GetCreateFlags: pluginFlags, Plugin: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Register("built-in", &RegisteredDriver{New: newDriver, GetCreateFlags: builtInFlags}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range GetCreateFlags() {
+		if strings.Contains(f.String(), "plugged-region") {
+			t.Fatal("expected the flags of plugins to be left out")
+		}
+	}
+	flags := GetPluginCreateFlags()
+	if len(flags) != 1 || !strings.Contains(flags[0].String(), "plugged-region") {
+		t.Fatalf("expected the flags of the plugin only; received %v", flags)
+	}
+}
+
+func TestParsePort(t *testing.T) {
+	expected := map[string]Port{
+		"80":       {Protocol: "tcp", Port: 80},
+		"80/tcp":   {Protocol: "tcp", Port: 80},
+		"53/UDP":   {Protocol: "udp", Port: 53},
+		"8080/tcp": {Protocol: "tcp", Port: 8080},
+	}
+	for value, port := range expected {
+		p, err := ParsePort(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *p != port {
+			t.Fatalf("%s: expected %v; received %v", value, port, *p)
+		}
+	}
+
+	for _, value := range []string{"", "http", "0", "65536", "80/icmp"} {
+		if _, err := ParsePort(value); err == nil {
+			t.Fatalf("expected error for %q", value)
+		}
+	}
+}
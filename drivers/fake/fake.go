@@ -0,0 +1,256 @@
+package fake
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/codegangsta/cli"
+	"github.com/docker/machine/drivers"
+	"github.com/docker/machine/provider"
+	"github.com/docker/machine/ssh"
+	"github.com/docker/machine/state"
+)
+
+// enableEnvVar registers the driver when set; the driver is meant for
+// testing tools built on Machine and is not listed otherwise
+const enableEnvVar = "MACHINE_FAKE_DRIVER"
+
+// Driver simulates a machine without any cloud or hypervisor. Its state is
+// kept in the machine directory so that it is shared by Machine processes,
+// its SSH server runs in the Machine process and faults can be injected
+// into its methods.
+type Driver struct {
+	MachineName    string
+	IPAddress      string
+	Faults         []string
+	CaCertPath     string
+	PrivateKeyPath string
+	SwarmMaster    bool
+	SwarmHost      string
+	SwarmDiscovery string
+	storePath      string
+	sshServer      *sshServer
+}
+
+func init() {
+	if os.Getenv(enableEnvVar) != "" {
+		Register()
+	}
+}
+
+// Register registers the fake driver, e.g. from the tests of a package
+// using Machine
+func Register() error {
+	return drivers.Register("fake", &drivers.RegisteredDriver{
+		New:            NewDriver,
+		GetCreateFlags: GetCreateFlags,
+	})
+}
+
+// GetCreateFlags registers the flags this driver adds to
+// "docker hosts create"
+func GetCreateFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringSliceFlag{
+			Name:  "fake-fault",
+			Usage: fmt.Sprintf("Fault to inject as method[:error][:delay], e.g. Create:error:3s; methods are %s", strings.Join(faultMethods, ", ")),
+			Value: &cli.StringSlice{},
+		},
+	}
+}
+
+func NewDriver(machineName string, storePath string, caCert string, privateKey string) (drivers.Driver, error) {
+	return &Driver{MachineName: machineName, storePath: storePath, CaCertPath: caCert, PrivateKeyPath: privateKey}, nil
+}
+
+func (d *Driver) AuthorizePort(ports []*drivers.Port) error {
+	return nil
+}
+
+func (d *Driver) DeauthorizePort(ports []*drivers.Port) error {
+	return nil
+}
+
+func (d *Driver) DriverName() string {
+	return "fake"
+}
+
+func (d *Driver) GetMachineName() string {
+	return d.MachineName
+}
+
+func (d *Driver) GetSSHHostname() (string, error) {
+	return "127.0.0.1", nil
+}
+
+func (d *Driver) GetSSHKeyPath() string {
+	return filepath.Join(d.storePath, "id_rsa")
+}
+
+// GetSSHPort returns the port of the SSH server of the machine, which is
+// started on first use
+func (d *Driver) GetSSHPort() (int, error) {
+	if d.sshServer == nil {
+		server, err := startSSHServer(d)
+		if err != nil {
+			return 0, err
+		}
+		d.sshServer = server
+	}
+	return d.sshServer.port(), nil
+}
+
+func (d *Driver) GetSSHUsername() string {
+	return "docker"
+}
+
+func (d *Driver) GetProviderType() provider.ProviderType {
+	return provider.Remote
+}
+
+func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
+	d.Faults = flags.StringSlice("fake-fault")
+	d.SwarmMaster = flags.Bool("swarm-master")
+	d.SwarmHost = flags.String("swarm-host")
+	d.SwarmDiscovery = flags.String("swarm-discovery")
+
+	_, err := parseFaults(d.Faults)
+	return err
+}
+
+func (d *Driver) PreCreateCheck() error {
+	return d.inject("PreCreateCheck")
+}
+
+func (d *Driver) Create() error {
+	d.IPAddress = fakeIP(d.MachineName)
+
+	if err := ssh.GenerateSSHKey(d.GetSSHKeyPath()); err != nil {
+		return err
+	}
+
+	if err := d.setState(state.Starting); err != nil {
+		return err
+	}
+	if err := d.inject("Create"); err != nil {
+		d.setState(state.Error)
+		return err
+	}
+	return d.setState(state.Running)
+}
+
+func (d *Driver) GetURL() (string, error) {
+	if err := d.inject("GetURL"); err != nil {
+		return "", err
+	}
+	ip, err := d.GetIP()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("tcp://%s:2376", ip), nil
+}
+
+func (d *Driver) GetIP() (string, error) {
+	if err := d.inject("GetIP"); err != nil {
+		return "", err
+	}
+	s, err := d.readState()
+	if err != nil {
+		return "", err
+	}
+	if s != state.Running {
+		return "", drivers.ErrHostIsNotRunning
+	}
+	return d.IPAddress, nil
+}
+
+func (d *Driver) GetState() (state.State, error) {
+	if err := d.inject("GetState"); err != nil {
+		return state.Error, err
+	}
+	return d.readState()
+}
+
+func (d *Driver) Start() error {
+	return d.transition("Start", state.Starting, state.Running)
+}
+
+func (d *Driver) Stop() error {
+	return d.transition("Stop", state.Stopping, state.Stopped)
+}
+
+func (d *Driver) Restart() error {
+	return d.transition("Restart", state.Stopping, state.Running)
+}
+
+func (d *Driver) Kill() error {
+	return d.transition("Kill", state.Stopping, state.Stopped)
+}
+
+func (d *Driver) Remove() error {
+	if err := d.inject("Remove"); err != nil {
+		return err
+	}
+	if d.sshServer != nil {
+		d.sshServer.close()
+		d.sshServer = nil
+	}
+	return nil
+}
+
+// transition goes through an intermediate state while a method runs,
+// which is seen by other Machine processes when the method is delayed. A
+// failure restores the previous state.
+func (d *Driver) transition(method string, during state.State, after state.State) error {
+	before, err := d.readState()
+	if err != nil {
+		return err
+	}
+	if err := d.setState(during); err != nil {
+		return err
+	}
+	if err := d.inject(method); err != nil {
+		d.setState(before)
+		return err
+	}
+	return d.setState(after)
+}
+
+func (d *Driver) statePath() string {
+	return filepath.Join(d.storePath, "state")
+}
+
+func (d *Driver) setState(s state.State) error {
+	return ioutil.WriteFile(d.statePath(), []byte(s.String()), 0600)
+}
+
+// readState reads the state of the machine; a machine which was never
+// created has none
+func (d *Driver) readState() (state.State, error) {
+	data, err := ioutil.ReadFile(d.statePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state.None, nil
+		}
+		return state.Error, err
+	}
+	for s := state.None; s <= state.Error; s++ {
+		if s.String() == string(data) {
+			return s, nil
+		}
+	}
+	return state.Error, fmt.Errorf("invalid state %q of %s", data, d.MachineName)
+}
+
+// fakeIP returns an address of 10.0.0.0/8 derived from the machine name,
+// so that machines have distinct and stable IPs
+func fakeIP(name string) string {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	sum := h.Sum32()
+	return fmt.Sprintf("10.%d.%d.%d", (sum>>16)&0xff, (sum>>8)&0xff, 2+(sum&0xff)%252)
+}
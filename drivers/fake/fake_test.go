@@ -0,0 +1,178 @@
+package fake
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/machine/drivers"
+	"github.com/docker/machine/state"
+)
+
+func getTestDriver(t *testing.T, faults ...string) (*Driver, func()) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen is not installed")
+	}
+	dir, err := ioutil.TempDir("", "machine-fake-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, _ := NewDriver("test", dir, "ca.pem", "key.pem")
+	driver := d.(*Driver)
+	driver.Faults = faults
+	return driver, func() {
+		driver.Remove()
+		os.RemoveAll(dir)
+	}
+}
+
+func checkState(t *testing.T, d *Driver, expected state.State) {
+	s, err := d.GetState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != expected {
+		t.Fatalf("expected %s; received %s", expected, s)
+	}
+}
+
+func TestFakeIP(t *testing.T) {
+	if fakeIP("dev") != fakeIP("dev") {
+		t.Fatal("expected a stable IP")
+	}
+	if fakeIP("dev") == fakeIP("prod") {
+		t.Fatal("expected distinct IPs")
+	}
+	if !strings.HasPrefix(fakeIP("dev"), "10.") {
+		t.Fatalf("unexpected IP %s", fakeIP("dev"))
+	}
+}
+
+func TestStateTransitions(t *testing.T) {
+	d, cleanup := getTestDriver(t)
+	defer cleanup()
+
+	checkState(t, d, state.None)
+	if err := d.Create(); err != nil {
+		t.Fatal(err)
+	}
+	checkState(t, d, state.Running)
+	url, err := d.GetURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url != "tcp://"+fakeIP("test")+":2376" {
+		t.Fatalf("unexpected URL %s", url)
+	}
+
+	if err := d.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	checkState(t, d, state.Stopped)
+	if _, err := d.GetIP(); err != drivers.ErrHostIsNotRunning {
+		t.Fatalf("expected %v; received %v", drivers.ErrHostIsNotRunning, err)
+	}
+
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	checkState(t, d, state.Running)
+	if err := d.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	checkState(t, d, state.Running)
+	if err := d.Kill(); err != nil {
+		t.Fatal(err)
+	}
+	checkState(t, d, state.Stopped)
+}
+
+func TestFailures(t *testing.T) {
+	d, cleanup := getTestDriver(t, "Start:error")
+	defer cleanup()
+
+	if err := d.Create(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Start(); err == nil {
+		t.Fatal("expected Start to fail")
+	}
+	checkState(t, d, state.Stopped)
+
+	d.Faults = []string{"Create:error", "GetState:error"}
+	if err := d.Create(); err == nil {
+		t.Fatal("expected Create to fail")
+	}
+	if s, err := d.GetState(); err == nil || s != state.Error {
+		t.Fatalf("expected GetState to fail; received %s, %v", s, err)
+	}
+	d.Faults = nil
+	checkState(t, d, state.Error)
+}
+
+func TestTransitionSeenByOtherProcesses(t *testing.T) {
+	d, cleanup := getTestDriver(t)
+	defer cleanup()
+	if err := d.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	// another driver of the same machine, as loaded by another process
+	other, _ := NewDriver(d.MachineName, d.storePath, d.CaCertPath, d.PrivateKeyPath)
+
+	d.Faults = []string{"Stop:300ms"}
+	done := make(chan error)
+	go func() { done <- d.Stop() }()
+	time.Sleep(100 * time.Millisecond)
+	checkState(t, other.(*Driver), state.Stopping)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	checkState(t, other.(*Driver), state.Stopped)
+}
+
+func TestSSHServer(t *testing.T) {
+	if _, err := exec.LookPath("ssh"); err != nil {
+		t.Skip("ssh is not installed")
+	}
+	d, cleanup := getTestDriver(t)
+	defer cleanup()
+	if err := d.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, command := range []string{"sudo hostname test", "echo \"key\" | sudo tee -a /etc/docker/server-key.pem"} {
+		cmd, err := drivers.GetSSHCommandFromDriver(d, command)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := cmd.Run(); err != nil {
+			t.Fatalf("%s: %s", command, err)
+		}
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(d.storePath, "commands.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "sudo hostname test\necho \"key\" | sudo tee -a /etc/docker/server-key.pem\n"
+	if string(data) != expected {
+		t.Fatalf("expected %q; received %q", expected, data)
+	}
+
+	d.Faults = []string{"SSH:error"}
+	cmd, err := drivers.GetSSHCommandFromDriver(d, "sudo service docker start")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Run(); err == nil {
+		t.Fatal("expected the SSH command to fail")
+	}
+}
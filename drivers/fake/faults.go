@@ -0,0 +1,103 @@
+package fake
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// faultsEnvVar adds faults to all fake machines, e.g. to make existing
+// machines slow
+const faultsEnvVar = "MACHINE_FAKE_FAULTS"
+
+// methods which faults can be injected into; SSH is a command run on the
+// SSH server of a machine
+var faultMethods = []string{
+	"PreCreateCheck", "Create", "Start", "Stop", "Restart", "Kill", "Remove",
+	"GetState", "GetIP", "GetURL", "SSH",
+}
+
+// fault makes a method fail and/or take time
+type fault struct {
+	Method string
+	Fail   bool
+	Delay  time.Duration
+}
+
+// parseFault parses a fault as method[:error][:delay], e.g. Create:error:3s
+// for a Create failing after 3 seconds or GetState:500ms for a slow GetState
+func parseFault(value string) (*fault, error) {
+	parts := strings.Split(value, ":")
+	f := &fault{Method: parts[0]}
+
+	known := false
+	for _, m := range faultMethods {
+		if strings.EqualFold(m, f.Method) {
+			f.Method, known = m, true
+		}
+	}
+	if !known {
+		return nil, fmt.Errorf("invalid fault %q: unknown method %s; use one of %s", value, f.Method, strings.Join(faultMethods, ", "))
+	}
+
+	for _, part := range parts[1:] {
+		if part == "error" && !f.Fail {
+			f.Fail = true
+			continue
+		}
+		delay, err := time.ParseDuration(part)
+		if err != nil || f.Delay != 0 || delay <= 0 {
+			return nil, fmt.Errorf("invalid fault %q: expected method[:error][:delay]", value)
+		}
+		f.Delay = delay
+	}
+	if !f.Fail && f.Delay == 0 {
+		return nil, fmt.Errorf("invalid fault %q: expected an error and/or a delay", value)
+	}
+	return f, nil
+}
+
+// parseFaults parses the faults of a machine and of MACHINE_FAKE_FAULTS,
+// which is a comma separated list
+func parseFaults(values []string) ([]*fault, error) {
+	if env := os.Getenv(faultsEnvVar); env != "" {
+		values = append(append([]string{}, values...), strings.Split(env, ",")...)
+	}
+
+	faults := []*fault{}
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		f, err := parseFault(value)
+		if err != nil {
+			return nil, err
+		}
+		faults = append(faults, f)
+	}
+	return faults, nil
+}
+
+// inject waits for the delays of the faults of method and returns an error
+// if one of them fails
+func (d *Driver) inject(method string) error {
+	faults, err := parseFaults(d.Faults)
+	if err != nil {
+		return err
+	}
+
+	fail := false
+	for _, f := range faults {
+		if f.Method != method {
+			continue
+		}
+		time.Sleep(f.Delay)
+		fail = fail || f.Fail
+	}
+	if fail {
+		return fmt.Errorf("injected failure of %s on %s", method, d.MachineName)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package fake
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParseFault(t *testing.T) {
+	expected := map[string]fault{
+		"Create:error:3s":   {Method: "Create", Fail: true, Delay: 3 * time.Second},
+		"getstate:error":    {Method: "GetState", Fail: true},
+		"Start:500ms":       {Method: "Start", Delay: 500 * time.Millisecond},
+		"SSH:2s:error":      {Method: "SSH", Fail: true, Delay: 2 * time.Second},
+		"PreCreateCheck:1m": {Method: "PreCreateCheck", Delay: time.Minute},
+	}
+	for value, f := range expected {
+		parsed, err := parseFault(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *parsed != f {
+			t.Fatalf("%s: expected %+v; received %+v", value, f, *parsed)
+		}
+	}
+
+	for _, value := range []string{"", "Create", "Upgrade:error", "Create:fail", "Create:1s:2s", "Create:error:error", "Create:-1s"} {
+		if _, err := parseFault(value); err == nil {
+			t.Fatalf("expected an error for %q", value)
+		}
+	}
+}
+
+func TestParseFaultsEnv(t *testing.T) {
+	os.Setenv(faultsEnvVar, "GetState:error, GetIP:1s")
+	defer os.Unsetenv(faultsEnvVar)
+
+	faults, err := parseFaults([]string{"Create:error"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(faults) != 3 || faults[0].Method != "Create" || faults[1].Method != "GetState" || faults[2].Method != "GetIP" {
+		t.Fatalf("unexpected faults %v", faults)
+	}
+}
+
+func TestInject(t *testing.T) {
+	d := &Driver{MachineName: "test", Faults: []string{"Start:50ms", "Stop:error:50ms"}}
+
+	start := time.Now()
+	if err := d.inject("Start"); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) < 50*time.Millisecond {
+		t.Fatal("expected Start to be delayed")
+	}
+
+	start = time.Now()
+	if err := d.inject("Stop"); err == nil {
+		t.Fatal("expected Stop to fail")
+	}
+	if time.Since(start) < 50*time.Millisecond {
+		t.Fatal("expected Stop to fail after its delay")
+	}
+
+	if err := d.inject("Kill"); err != nil {
+		t.Fatal(err)
+	}
+}
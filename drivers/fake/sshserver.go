@@ -0,0 +1,145 @@
+package fake
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+
+	log "github.com/Sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+// sshServer is an SSH server in the Machine process standing in for the
+// server of a fake machine. It accepts any client and records the commands
+// it receives in the commands.log of the machine instead of running them.
+type sshServer struct {
+	driver   *Driver
+	listener net.Listener
+	config   *ssh.ServerConfig
+}
+
+func startSSHServer(d *Driver) (*sshServer, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return nil, err
+	}
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &sshServer{driver: d, listener: listener, config: config}
+	go s.serve()
+	return s, nil
+}
+
+func (s *sshServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *sshServer) close() error {
+	return s.listener.Close()
+}
+
+func (s *sshServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handleConn(conn)
+	}
+}
+
+func (s *sshServer) handleConn(conn net.Conn) {
+	_, channels, requests, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		log.Debugf("Error in the SSH handshake of %s: %s", s.driver.MachineName, err)
+		return
+	}
+	go ssh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			log.Debugf("Error accepting an SSH session of %s: %s", s.driver.MachineName, err)
+			continue
+		}
+		go s.handleSession(channel, channelRequests)
+	}
+}
+
+func (s *sshServer) handleSession(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+	// stdin, e.g. a file written with tee, is read and dropped
+	go io.Copy(ioutil.Discard, channel)
+
+	for req := range requests {
+		switch req.Type {
+		case "exec":
+			command := struct{ Command string }{}
+			if err := ssh.Unmarshal(req.Payload, &command); err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			req.Reply(true, nil)
+			s.exit(channel, s.run(command.Command))
+			return
+		case "shell":
+			req.Reply(true, nil)
+			fmt.Fprintf(channel, "%s is a fake machine; interactive shells are not supported\r\n", s.driver.MachineName)
+			s.exit(channel, 0)
+			return
+		case "pty-req", "env":
+			req.Reply(true, nil)
+		default:
+			req.Reply(false, nil)
+		}
+	}
+}
+
+// run records a command and returns its exit status
+func (s *sshServer) run(command string) uint32 {
+	log.Debugf("fake SSH command on %s: %s", s.driver.MachineName, command)
+	if err := s.driver.recordCommand(command); err != nil {
+		log.Debugf("Error recording the SSH command of %s: %s", s.driver.MachineName, err)
+	}
+	if err := s.driver.inject("SSH"); err != nil {
+		return 1
+	}
+	return 0
+}
+
+func (s *sshServer) exit(channel ssh.Channel, status uint32) {
+	channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+}
+
+// recordCommand appends a command to the commands.log of the machine
+func (d *Driver) recordCommand(command string) error {
+	f, err := os.OpenFile(filepath.Join(d.storePath, "commands.log"), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, command); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
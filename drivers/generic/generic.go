@@ -0,0 +1,247 @@
+package generic
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+	"github.com/docker/machine/drivers"
+	"github.com/docker/machine/provider"
+	"github.com/docker/machine/state"
+	"github.com/docker/machine/utils"
+)
+
+const (
+	dockerPort = 2376
+)
+
+// Driver adopts an existing Linux server reachable over SSH. The server is
+// provisioned like the machines of the cloud drivers but is never created,
+// powered off or destroyed by Machine.
+type Driver struct {
+	MachineName    string
+	IPAddress      string
+	SSHUser        string
+	SSHPort        int
+	SSHKey         string
+	CaCertPath     string
+	PrivateKeyPath string
+	SwarmMaster    bool
+	SwarmHost      string
+	SwarmDiscovery string
+	storePath      string
+}
+
+func init() {
+	drivers.Register("generic", &drivers.RegisteredDriver{
+		New:            NewDriver,
+		GetCreateFlags: GetCreateFlags,
+	})
+}
+
+// GetCreateFlags registers the flags this driver adds to
+// "docker hosts create"
+func GetCreateFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:  "generic-ip-address",
+			Usage: "IP address or hostname of the server",
+		},
+		cli.StringFlag{
+			Name:  "generic-ssh-user",
+			Usage: "SSH user, which must be root or able to sudo without a password",
+			Value: "root",
+		},
+		cli.StringFlag{
+			Name:  "generic-ssh-key",
+			Usage: "SSH private key of the user",
+			Value: filepath.Join(utils.GetHomeDir(), ".ssh", "id_rsa"),
+		},
+		cli.IntFlag{
+			Name:  "generic-ssh-port",
+			Usage: "SSH port of the server",
+			Value: 22,
+		},
+	}
+}
+
+func NewDriver(machineName string, storePath string, caCert string, privateKey string) (drivers.Driver, error) {
+	return &Driver{MachineName: machineName, storePath: storePath, CaCertPath: caCert, PrivateKeyPath: privateKey}, nil
+}
+
+func (d *Driver) AuthorizePort(ports []*drivers.Port) error {
+	return nil
+}
+
+func (d *Driver) DeauthorizePort(ports []*drivers.Port) error {
+	return nil
+}
+
+func (d *Driver) DriverName() string {
+	return "generic"
+}
+
+func (d *Driver) GetMachineName() string {
+	return d.MachineName
+}
+
+func (d *Driver) GetSSHHostname() (string, error) {
+	return d.GetIP()
+}
+
+// GetSSHKeyPath returns the copy of the key made when the machine was
+// created
+func (d *Driver) GetSSHKeyPath() string {
+	return filepath.Join(d.storePath, "id_rsa")
+}
+
+func (d *Driver) GetSSHPort() (int, error) {
+	if d.SSHPort == 0 {
+		d.SSHPort = 22
+	}
+
+	return d.SSHPort, nil
+}
+
+func (d *Driver) GetSSHUsername() string {
+	if d.SSHUser == "" {
+		d.SSHUser = "root"
+	}
+
+	return d.SSHUser
+}
+
+func (d *Driver) GetProviderType() provider.ProviderType {
+	return provider.Remote
+}
+
+func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
+	d.IPAddress = flags.String("generic-ip-address")
+	d.SSHUser = flags.String("generic-ssh-user")
+	d.SSHKey = flags.String("generic-ssh-key")
+	d.SSHPort = flags.Int("generic-ssh-port")
+	d.SwarmMaster = flags.Bool("swarm-master")
+	d.SwarmHost = flags.String("swarm-host")
+	d.SwarmDiscovery = flags.String("swarm-discovery")
+
+	if d.IPAddress == "" {
+		return fmt.Errorf("generic driver requires the --generic-ip-address option")
+	}
+	if d.SSHKey == "" {
+		return fmt.Errorf("generic driver requires the --generic-ssh-key option")
+	}
+	if d.SSHPort <= 0 || d.SSHPort > 65535 {
+		return fmt.Errorf("invalid SSH port %d", d.SSHPort)
+	}
+
+	return nil
+}
+
+func (d *Driver) PreCreateCheck() error {
+	if _, err := os.Stat(d.SSHKey); err != nil {
+		return fmt.Errorf("SSH key %s cannot be read: %s", d.SSHKey, err)
+	}
+	return nil
+}
+
+// Create copies the SSH key to the store and waits for the server to be
+// reachable; the engine is installed by the provisioning of the host
+func (d *Driver) Create() error {
+	log.Infof("Importing SSH key...")
+	if err := utils.CopyFile(d.SSHKey, d.GetSSHKeyPath()); err != nil {
+		return fmt.Errorf("error copying SSH key: %s", err)
+	}
+	if err := os.Chmod(d.GetSSHKeyPath(), 0600); err != nil {
+		return err
+	}
+
+	log.Infof("Waiting for SSH on %s:%d...", d.IPAddress, d.SSHPort)
+	return utils.WaitForSpecific(d.reachableFunc(d.SSHPort), 12, 5*time.Second)
+}
+
+func (d *Driver) GetURL() (string, error) {
+	ip, err := d.GetIP()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("tcp://%s:%d", ip, dockerPort), nil
+}
+
+func (d *Driver) GetIP() (string, error) {
+	if d.IPAddress == "" {
+		return "", fmt.Errorf("IP address is not set")
+	}
+	return d.IPAddress, nil
+}
+
+// GetState reports the server as running when the engine is reachable and
+// as stopped when only SSH is
+func (d *Driver) GetState() (state.State, error) {
+	if d.reachableFunc(dockerPort)() {
+		return state.Running, nil
+	}
+	if d.reachableFunc(d.SSHPort)() {
+		return state.Stopped, nil
+	}
+	return state.Error, fmt.Errorf("%s is not reachable", d.IPAddress)
+}
+
+// Start starts the engine service
+func (d *Driver) Start() error {
+	return d.runSSHCommand("sudo service docker start")
+}
+
+// Stop stops the engine service; the server keeps running
+func (d *Driver) Stop() error {
+	return d.runSSHCommand("sudo service docker stop")
+}
+
+// Kill stops the engine service, as the server cannot be powered off
+func (d *Driver) Kill() error {
+	return d.Stop()
+}
+
+// Restart reboots the server and waits for SSH to be reachable again
+func (d *Driver) Restart() error {
+	// the connection may be closed by the reboot before ssh exits
+	if err := d.runSSHCommand("sudo reboot"); err != nil {
+		log.Debugf("Error running reboot: %s", err)
+	}
+
+	if err := utils.WaitForSpecific(func() bool {
+		return !d.reachableFunc(d.SSHPort)()
+	}, 30, 2*time.Second); err != nil {
+		return fmt.Errorf("%s did not go down for the reboot", d.IPAddress)
+	}
+	return utils.WaitForSpecific(d.reachableFunc(d.SSHPort), 60, 5*time.Second)
+}
+
+// Remove leaves the server alone; only the machine is removed from the
+// store
+func (d *Driver) Remove() error {
+	return nil
+}
+
+func (d *Driver) runSSHCommand(command string) error {
+	cmd, err := drivers.GetSSHCommandFromDriver(d, command)
+	if err != nil {
+		return err
+	}
+	return cmd.Run()
+}
+
+func (d *Driver) reachableFunc(port int) func() bool {
+	return func() bool {
+		conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", d.IPAddress, port), 5*time.Second)
+		if err != nil {
+			log.Debugf("%s:%d is not reachable: %s", d.IPAddress, port, err)
+			return false
+		}
+		conn.Close()
+		return true
+	}
+}
@@ -0,0 +1,120 @@
+package generic
+
+import (
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/docker/machine/state"
+)
+
+type DriverOptionsMock struct {
+	Data map[string]interface{}
+}
+
+func (d DriverOptionsMock) String(key string) string {
+	return d.Data[key].(string)
+}
+
+func (d DriverOptionsMock) StringSlice(key string) []string {
+	return d.Data[key].([]string)
+}
+
+func (d DriverOptionsMock) Int(key string) int {
+	return d.Data[key].(int)
+}
+
+func (d DriverOptionsMock) Bool(key string) bool {
+	return d.Data[key].(bool)
+}
+
+func getTestDriverOptions() DriverOptionsMock {
+	return DriverOptionsMock{
+		Data: map[string]interface{}{
+			"generic-ip-address": "10.0.0.1",
+			"generic-ssh-user":   "ubuntu",
+			"generic-ssh-key":    "/tmp/id_rsa",
+			"generic-ssh-port":   2222,
+			"swarm-master":       false,
+			"swarm-host":         "",
+			"swarm-discovery":    "",
+		},
+	}
+}
+
+func TestSetConfigFromFlags(t *testing.T) {
+	d := &Driver{}
+	if err := d.SetConfigFromFlags(getTestDriverOptions()); err != nil {
+		t.Fatal(err)
+	}
+	if d.IPAddress != "10.0.0.1" || d.SSHUser != "ubuntu" || d.SSHPort != 2222 {
+		t.Fatalf("unexpected configuration %+v", d)
+	}
+
+	url, err := d.GetURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url != "tcp://10.0.0.1:2376" {
+		t.Fatalf("expected tcp://10.0.0.1:2376; received %s", url)
+	}
+}
+
+func TestSetConfigFromFlagsInvalid(t *testing.T) {
+	for key, value := range map[string]interface{}{
+		"generic-ip-address": "",
+		"generic-ssh-key":    "",
+		"generic-ssh-port":   0,
+	} {
+		flags := getTestDriverOptions()
+		flags.Data[key] = value
+		d := &Driver{}
+		if err := d.SetConfigFromFlags(flags); err == nil {
+			t.Fatalf("expected an error for %s=%v", key, value)
+		}
+	}
+}
+
+// testDriver returns a driver for localhost whose SSH port is listening
+// when listen is set
+func testDriver(t *testing.T, listen bool) (*Driver, net.Listener) {
+	if (&Driver{IPAddress: "127.0.0.1"}).reachableFunc(dockerPort)() {
+		t.Skip("an engine is listening on localhost")
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	d := &Driver{IPAddress: "127.0.0.1"}
+	d.SSHPort, _ = strconv.Atoi(port)
+	if !listen {
+		l.Close()
+	}
+	return d, l
+}
+
+func TestGetStateStopped(t *testing.T) {
+	d, l := testDriver(t, true)
+	defer l.Close()
+
+	s, err := d.GetState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != state.Stopped {
+		t.Fatalf("expected %s; received %s", state.Stopped, s)
+	}
+}
+
+func TestGetStateUnreachable(t *testing.T) {
+	d, _ := testDriver(t, false)
+
+	s, err := d.GetState()
+	if err == nil {
+		t.Fatal("expected an error for an unreachable server")
+	}
+	if s != state.Error {
+		t.Fatalf("expected %s; received %s", state.Error, s)
+	}
+}
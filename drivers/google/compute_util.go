@@ -4,10 +4,13 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/url"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/docker/machine/drivers"
 	"github.com/docker/machine/ssh"
 	raw "google.golang.org/api/compute/v1"
 )
@@ -126,6 +129,207 @@ func (c *ComputeUtil) createFirewallRule() error {
 	return c.waitForGlobalOp(op.Name)
 }
 
+// portFirewallRuleName returns the name of the firewall rule opening a port
+// on this instance only
+func (c *ComputeUtil) portFirewallRuleName(p *drivers.Port) string {
+	return fmt.Sprintf("%s-%s-%d", c.instanceName, strings.ToLower(p.Protocol), p.Port)
+}
+
+// authorizePorts creates a firewall rule per port targeting a tag unique to
+// this instance, which is added to instances created before it was used.
+func (c *ComputeUtil) authorizePorts(ports []*drivers.Port) error {
+	if err := c.ensureInstanceTag(); err != nil {
+		return err
+	}
+	for _, p := range ports {
+		sourceRange := p.CIDR
+		if sourceRange == "" {
+			sourceRange = "0.0.0.0/0"
+		}
+		log.Infof("Creating firewall rule for %s.", p)
+		rule := &raw.Firewall{
+			Allowed: []*raw.FirewallAllowed{
+				{
+					IPProtocol: strings.ToLower(p.Protocol),
+					Ports: []string{
+						strconv.Itoa(p.Port),
+					},
+				},
+			},
+			SourceRanges: []string{
+				sourceRange,
+			},
+			TargetTags: []string{
+				c.instanceName,
+			},
+			Name: c.portFirewallRuleName(p),
+		}
+		op, err := c.service.Firewalls.Insert(c.project, rule).Do()
+		if err != nil {
+			return err
+		}
+		if err := c.waitForGlobalOp(op.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deauthorizePorts deletes the firewall rules created by authorizePorts
+func (c *ComputeUtil) deauthorizePorts(ports []*drivers.Port) error {
+	for _, p := range ports {
+		log.Infof("Deleting firewall rule for %s.", p)
+		op, err := c.service.Firewalls.Delete(c.project, c.portFirewallRuleName(p)).Do()
+		if err != nil {
+			return err
+		}
+		if err := c.waitForGlobalOp(op.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deletePortFirewallRules deletes all firewall rules created by
+// authorizePorts, which would otherwise outlive the instance
+func (c *ComputeUtil) deletePortFirewallRules() error {
+	pageToken := ""
+	for {
+		list, err := c.service.Firewalls.List(c.project).PageToken(pageToken).Do()
+		if err != nil {
+			return err
+		}
+		for _, rule := range list.Items {
+			if len(rule.TargetTags) != 1 || rule.TargetTags[0] != c.instanceName {
+				continue
+			}
+			log.Infof("Deleting firewall rule %s.", rule.Name)
+			op, err := c.service.Firewalls.Delete(c.project, rule.Name).Do()
+			if err != nil {
+				return err
+			}
+			if err := c.waitForGlobalOp(op.Name); err != nil {
+				return err
+			}
+		}
+		if list.NextPageToken == "" {
+			return nil
+		}
+		pageToken = list.NextPageToken
+	}
+}
+
+func (c *ComputeUtil) ensureInstanceTag() error {
+	instance, err := c.instance()
+	if err != nil {
+		return err
+	}
+	tags := instance.Tags
+	if tags == nil {
+		tags = &raw.Tags{}
+	}
+	for _, tag := range tags.Items {
+		if tag == c.instanceName {
+			return nil
+		}
+	}
+	tags.Items = append(tags.Items, c.instanceName)
+	op, err := c.service.Instances.SetTags(c.project, c.zone, c.instanceName, tags).Do()
+	if err != nil {
+		return err
+	}
+	return c.waitForRegionalOp(op.Name)
+}
+
+// snapshotName returns the name of a snapshot of the disk; snapshot names
+// are global to the project
+func (c *ComputeUtil) snapshotName(name string) string {
+	return c.instanceName + "-" + name
+}
+
+// createSnapshot takes a snapshot of the persistent disk.
+func (c *ComputeUtil) createSnapshot(name string) error {
+	log.Infof("Creating snapshot.")
+	op, err := c.service.Disks.CreateSnapshot(c.project, c.zone, c.diskName(), &raw.Snapshot{
+		Name:        c.snapshotName(name),
+		Description: fmt.Sprintf("Docker Machine snapshot %s of %s", name, c.instanceName),
+	}).Do()
+	if err != nil {
+		return err
+	}
+	log.Infof("Waiting for snapshot.")
+	return c.waitForRegionalOp(op.Name)
+}
+
+// snapshots returns the snapshots of the persistent disk.
+func (c *ComputeUtil) snapshots() ([]*raw.Snapshot, error) {
+	snapshots := []*raw.Snapshot{}
+	pageToken := ""
+	for {
+		list, err := c.service.Snapshots.List(c.project).PageToken(pageToken).Do()
+		if err != nil {
+			return nil, err
+		}
+		for _, snapshot := range list.Items {
+			if strings.HasSuffix(snapshot.SourceDisk, "/disks/"+c.diskName()) && strings.HasPrefix(snapshot.Name, c.snapshotName("")) {
+				snapshots = append(snapshots, snapshot)
+			}
+		}
+		if list.NextPageToken == "" {
+			sort.Sort(snapshotsByCreation(snapshots))
+			return snapshots, nil
+		}
+		pageToken = list.NextPageToken
+	}
+}
+
+type snapshotsByCreation []*raw.Snapshot
+
+func (s snapshotsByCreation) Len() int      { return len(s) }
+func (s snapshotsByCreation) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s snapshotsByCreation) Less(i, j int) bool {
+	return s[i].CreationTimestamp < s[j].CreationTimestamp
+}
+
+// restoreSnapshot replaces the persistent disk with a disk created from the
+// snapshot; the instance must have been deleted.
+func (c *ComputeUtil) restoreSnapshot(name string) error {
+	if instance, _ := c.instance(); instance != nil {
+		return fmt.Errorf("instance %s must be stopped to restore a snapshot", c.instanceName)
+	}
+	snapshot, err := c.service.Snapshots.Get(c.project, c.snapshotName(name)).Do()
+	if err != nil {
+		return err
+	}
+
+	if err := c.deleteDisk(); err != nil {
+		return err
+	}
+
+	log.Infof("Creating disk from snapshot.")
+	op, err := c.service.Disks.Insert(c.project, c.zone, &raw.Disk{
+		Name:           c.diskName(),
+		SizeGb:         snapshot.DiskSizeGb,
+		SourceSnapshot: snapshot.SelfLink,
+	}).Do()
+	if err != nil {
+		return err
+	}
+	log.Infof("Waiting for disk.")
+	return c.waitForRegionalOp(op.Name)
+}
+
+// deleteSnapshot deletes a snapshot of the persistent disk.
+func (c *ComputeUtil) deleteSnapshot(name string) error {
+	log.Infof("Deleting snapshot.")
+	op, err := c.service.Snapshots.Delete(c.project, c.snapshotName(name)).Do()
+	if err != nil {
+		return err
+	}
+	log.Infof("Waiting for snapshot to delete.")
+	return c.waitForGlobalOp(op.Name)
+}
+
 // instance retrieves the instance.
 func (c *ComputeUtil) instance() (*raw.Instance, error) {
 	return c.service.Instances.Get(c.project, c.zone, c.instanceName).Do()
@@ -164,6 +368,7 @@ func (c *ComputeUtil) createInstance(d *Driver) error {
 		Tags: &raw.Tags{
 			Items: []string{
 				firewallTargetTag,
+				c.instanceName,
 			},
 		},
 		ServiceAccounts: []*raw.ServiceAccount{
@@ -1 +1,26 @@
 package google
+
+import (
+	"sort"
+	"testing"
+
+	raw "google.golang.org/api/compute/v1"
+)
+
+func TestSnapshotName(t *testing.T) {
+	c := &ComputeUtil{instanceName: "dev"}
+	if name := c.snapshotName("clean"); name != "dev-clean" {
+		t.Fatalf("expected snapshot name dev-clean; received %q", name)
+	}
+}
+
+func TestSnapshotsByCreation(t *testing.T) {
+	snapshots := []*raw.Snapshot{
+		{Name: "dev-images", CreationTimestamp: "2015-03-02T10:00:00.000-08:00"},
+		{Name: "dev-clean", CreationTimestamp: "2015-03-01T10:00:00.000-08:00"},
+	}
+	sort.Sort(snapshotsByCreation(snapshots))
+	if snapshots[0].Name != "dev-clean" || snapshots[1].Name != "dev-images" {
+		t.Fatalf("unexpected order %s, %s", snapshots[0].Name, snapshots[1].Name)
+	}
+}
@@ -3,6 +3,8 @@ package google
 import (
 	"fmt"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/codegangsta/cli"
@@ -109,11 +111,19 @@ func NewDriver(machineName string, storePath string, caCert string, privateKey s
 }
 
 func (d *Driver) AuthorizePort(ports []*drivers.Port) error {
-	return nil
+	c, err := newComputeUtil(d)
+	if err != nil {
+		return err
+	}
+	return c.authorizePorts(ports)
 }
 
 func (d *Driver) DeauthorizePort(ports []*drivers.Port) error {
-	return nil
+	c, err := newComputeUtil(d)
+	if err != nil {
+		return err
+	}
+	return c.deauthorizePorts(ports)
 }
 
 func (d *Driver) GetMachineName() string {
@@ -282,6 +292,9 @@ func (d *Driver) Remove() error {
 			return err
 		}
 	}
+	if err := c.deletePortFirewallRules(); err != nil {
+		return err
+	}
 	return c.deleteDisk()
 }
 
@@ -298,6 +311,81 @@ func (d *Driver) Restart() error {
 	return c.createInstance(d)
 }
 
+// CreateSnapshot takes a snapshot of the persistent disk.
+func (d *Driver) CreateSnapshot(name string) error {
+	c, err := newComputeUtil(d)
+	if err != nil {
+		return err
+	}
+	return c.createSnapshot(name)
+}
+
+// ListSnapshots returns the snapshots of the persistent disk, oldest first.
+// The current snapshot is the one the disk was restored from.
+func (d *Driver) ListSnapshots() ([]*drivers.Snapshot, error) {
+	c, err := newComputeUtil(d)
+	if err != nil {
+		return nil, err
+	}
+	snapshots, err := c.snapshots()
+	if err != nil {
+		return nil, err
+	}
+	sourceSnapshot := ""
+	if disk, _ := c.disk(); disk != nil {
+		sourceSnapshot = disk.SourceSnapshot
+	}
+
+	result := []*drivers.Snapshot{}
+	for _, s := range snapshots {
+		result = append(result, &drivers.Snapshot{
+			Name:    strings.TrimPrefix(s.Name, c.snapshotName("")),
+			ID:      strconv.FormatUint(s.Id, 10),
+			Current: sourceSnapshot != "" && sourceSnapshot == s.SelfLink,
+		})
+	}
+	return result, nil
+}
+
+// RestoreSnapshot recreates the persistent disk from a snapshot. The
+// instance must be stopped, i.e. deleted.
+func (d *Driver) RestoreSnapshot(name string) error {
+	c, err := newComputeUtil(d)
+	if err != nil {
+		return err
+	}
+	return c.restoreSnapshot(name)
+}
+
+// RemoveSnapshot deletes a snapshot of the persistent disk.
+func (d *Driver) RemoveSnapshot(name string) error {
+	c, err := newComputeUtil(d)
+	if err != nil {
+		return err
+	}
+	return c.deleteSnapshot(name)
+}
+
+// Resize changes the machine type. The instance is deleted while the
+// machine is stopped, so the new type is used when Start recreates it.
+func (d *Driver) Resize(cpus int, memory int, size string) error {
+	if cpus > 0 || memory > 0 {
+		return fmt.Errorf("the CPUs and memory of GCE instances are set by their machine type; use --size to choose a machine type")
+	}
+	c, err := newComputeUtil(d)
+	if err != nil {
+		return err
+	}
+	if instance, _ := c.instance(); instance != nil {
+		return fmt.Errorf("instance %s must be stopped to change its machine type", d.MachineName)
+	}
+	if _, err := c.service.MachineTypes.Get(d.Project, d.Zone, size).Do(); err != nil {
+		return fmt.Errorf("unknown machine type %s: %s", size, err)
+	}
+	d.MachineType = size
+	return nil
+}
+
 // Kill deletes the GCE instance, but keeps the disk.
 func (d *Driver) Kill() error {
 	return d.Stop()
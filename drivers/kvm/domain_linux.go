@@ -0,0 +1,59 @@
+package kvm
+
+// domainXML boots the boot2docker ISO with the disk image made by
+// generateDiskImage. eth0 is attached to the NAT network and eth1 to the
+// private network, through which the host reaches the VM.
+const domainXML = `<domain type='kvm'>
+  <name>{{.MachineName}}</name>
+  <memory unit='MiB'>{{.Memory}}</memory>
+  <vcpu>{{.CPU}}</vcpu>
+  <features>
+    <acpi/>
+    <apic/>
+    <pae/>
+  </features>
+  <cpu mode='host-passthrough'/>
+  <os>
+    <type>hvm</type>
+    <boot dev='cdrom'/>
+    <boot dev='hd'/>
+    <bootmenu enable='no'/>
+  </os>
+  <devices>
+    <disk type='file' device='cdrom'>
+      <source file='{{.ISOPath}}'/>
+      <target dev='hdc' bus='ide'/>
+      <readonly/>
+    </disk>
+    <disk type='file' device='disk'>
+      <driver name='qemu' type='raw' cache='default' io='threads'/>
+      <source file='{{.DiskPath}}'/>
+      <target dev='vda' bus='virtio'/>
+    </disk>
+    <interface type='network'>
+      <source network='{{.Network}}'/>
+      <model type='virtio'/>
+    </interface>
+    <interface type='network'>
+      <mac address='{{.PrivateMAC}}'/>
+      <source network='{{.PrivateNetwork}}'/>
+      <model type='virtio'/>
+    </interface>
+    <graphics type='vnc' autoport='yes' listen='127.0.0.1'/>
+    <serial type='pty'/>
+    <console type='pty'/>
+  </devices>
+</domain>
+`
+
+// privateNetworkXML is an isolated network with DHCP, created when the
+// private network does not exist
+const privateNetworkXML = `<network>
+  <name>{{.Name}}</name>
+  <ip address='{{.Address}}' netmask='{{.Netmask}}'>
+    <dhcp>
+      <range start='{{.Start}}' end='{{.End}}'/>
+    </dhcp>
+  </ip>
+</network>
+`
@@ -0,0 +1,2 @@
+// this is empty to allow builds on non-linux platforms
+package kvm
@@ -0,0 +1,569 @@
+package kvm
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+	"github.com/docker/machine/drivers"
+	"github.com/docker/machine/provider"
+	"github.com/docker/machine/ssh"
+	"github.com/docker/machine/state"
+	"github.com/docker/machine/utils"
+)
+
+const (
+	isoFilename           = "boot2docker.iso"
+	defaultNetwork        = "default"
+	defaultPrivateNetwork = "docker-machines"
+)
+
+// privateNetwork is the configuration of the private network when the
+// driver creates it
+var privateNetwork = struct {
+	Address string
+	Netmask string
+	Start   string
+	End     string
+}{"192.168.42.1", "255.255.255.0", "192.168.42.2", "192.168.42.254"}
+
+type Driver struct {
+	MachineName    string
+	SSHUser        string
+	SSHPort        int
+	CPU            int
+	Memory         int
+	DiskSize       int
+	Boot2DockerURL string
+	ConnectionURI  string
+	Network        string
+	PrivateNetwork string
+	PrivateMAC     string
+	CaCertPath     string
+	PrivateKeyPath string
+	SwarmMaster    bool
+	SwarmHost      string
+	SwarmDiscovery string
+	storePath      string
+}
+
+func init() {
+	drivers.Register("kvm", &drivers.RegisteredDriver{
+		New:            NewDriver,
+		GetCreateFlags: GetCreateFlags,
+	})
+}
+
+// GetCreateFlags registers the flags this driver adds to
+// "docker hosts create"
+func GetCreateFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.IntFlag{
+			Name:  "kvm-cpu-count",
+			Usage: "Number of CPUs for the host",
+			Value: 1,
+		},
+		cli.IntFlag{
+			Name:  "kvm-memory",
+			Usage: "Size of memory for host in MB",
+			Value: 1024,
+		},
+		cli.IntFlag{
+			Name:  "kvm-disk-size",
+			Usage: "Size of disk for host in MB",
+			Value: 20000,
+		},
+		cli.StringFlag{
+			EnvVar: "KVM_BOOT2DOCKER_URL",
+			Name:   "kvm-boot2docker-url",
+			Usage:  "The URL of the boot2docker image. Defaults to the latest available version",
+			Value:  "",
+		},
+		cli.StringFlag{
+			Name:  "kvm-connection-uri",
+			Usage: "libvirt connection URI",
+			Value: defaultConnectionURI,
+		},
+		cli.StringFlag{
+			Name:  "kvm-network",
+			Usage: "Name of the libvirt NAT network through which the VM reaches the outside",
+			Value: defaultNetwork,
+		},
+		cli.StringFlag{
+			Name:  "kvm-private-network",
+			Usage: "Name of the isolated libvirt network through which the host reaches the VM; created if it does not exist",
+			Value: defaultPrivateNetwork,
+		},
+	}
+}
+
+func NewDriver(machineName string, storePath string, caCert string, privateKey string) (drivers.Driver, error) {
+	return &Driver{MachineName: machineName, storePath: storePath, CaCertPath: caCert, PrivateKeyPath: privateKey}, nil
+}
+
+func (d *Driver) AuthorizePort(ports []*drivers.Port) error {
+	return nil
+}
+
+func (d *Driver) DeauthorizePort(ports []*drivers.Port) error {
+	return nil
+}
+
+func (d *Driver) GetMachineName() string {
+	return d.MachineName
+}
+
+func (d *Driver) GetSSHHostname() (string, error) {
+	return d.GetIP()
+}
+
+func (d *Driver) GetSSHKeyPath() string {
+	return filepath.Join(d.storePath, "id_rsa")
+}
+
+func (d *Driver) GetSSHPort() (int, error) {
+	if d.SSHPort == 0 {
+		d.SSHPort = 22
+	}
+
+	return d.SSHPort, nil
+}
+
+func (d *Driver) GetSSHUsername() string {
+	if d.SSHUser == "" {
+		d.SSHUser = "docker"
+	}
+
+	return d.SSHUser
+}
+
+func (d *Driver) GetProviderType() provider.ProviderType {
+	return provider.Local
+}
+
+func (d *Driver) DriverName() string {
+	return "kvm"
+}
+
+func (d *Driver) GetURL() (string, error) {
+	ip, err := d.GetIP()
+	if err != nil {
+		return "", err
+	}
+	if ip == "" {
+		return "", nil
+	}
+	return fmt.Sprintf("tcp://%s:2376", ip), nil
+}
+
+func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
+	d.CPU = flags.Int("kvm-cpu-count")
+	d.Memory = flags.Int("kvm-memory")
+	d.DiskSize = flags.Int("kvm-disk-size")
+	d.Boot2DockerURL = flags.String("kvm-boot2docker-url")
+	d.ConnectionURI = flags.String("kvm-connection-uri")
+	d.Network = flags.String("kvm-network")
+	d.PrivateNetwork = flags.String("kvm-private-network")
+	d.SwarmMaster = flags.Bool("swarm-master")
+	d.SwarmHost = flags.String("swarm-host")
+	d.SwarmDiscovery = flags.String("swarm-discovery")
+	d.SSHUser = "docker"
+	d.SSHPort = 22
+
+	if d.CPU < 1 {
+		return fmt.Errorf("the CPU count must be at least 1")
+	}
+	if d.Network == "" || d.PrivateNetwork == "" {
+		return fmt.Errorf("kvm driver requires a NAT network and a private network")
+	}
+	if d.Network == d.PrivateNetwork {
+		return fmt.Errorf("the NAT network and the private network must be different")
+	}
+
+	return nil
+}
+
+// PreCreateCheck checks that libvirt is reachable and that the NAT network
+// exists
+func (d *Driver) PreCreateCheck() error {
+	if err := d.virsh("version"); err != nil {
+		return err
+	}
+	if err := d.virsh("net-info", d.Network); err != nil {
+		return fmt.Errorf("the libvirt network %s cannot be used: %s", d.Network, err)
+	}
+	return nil
+}
+
+func (d *Driver) Create() error {
+	b2dutils := utils.NewB2dUtils("", "")
+	imgPath := utils.GetMachineCacheDir()
+	// just in case boot2docker.iso has been manually deleted
+	if _, err := os.Stat(imgPath); os.IsNotExist(err) {
+		if err := os.Mkdir(imgPath, 0700); err != nil {
+			return err
+		}
+	}
+
+	if d.Boot2DockerURL != "" {
+		log.Infof("Downloading %s from %s...", isoFilename, d.Boot2DockerURL)
+		if err := b2dutils.DownloadISO(d.storePath, isoFilename, d.Boot2DockerURL); err != nil {
+			return err
+		}
+	} else {
+		iso, err := utils.NewISOCache(imgPath, b2dutils).Get("latest")
+		if err != nil {
+			return err
+		}
+		if err := utils.CopyFile(iso.Path, d.isoPath()); err != nil {
+			return err
+		}
+	}
+
+	log.Infof("Creating SSH key...")
+
+	if err := ssh.GenerateSSHKey(d.GetSSHKeyPath()); err != nil {
+		return err
+	}
+
+	log.Infof("Creating KVM VM...")
+
+	if err := d.generateDiskImage(d.DiskSize); err != nil {
+		return err
+	}
+
+	mac, err := randomMAC()
+	if err != nil {
+		return err
+	}
+	d.PrivateMAC = mac
+
+	if err := d.setupPrivateNetwork(); err != nil {
+		return err
+	}
+
+	xml, err := d.domainXML()
+	if err != nil {
+		return err
+	}
+	if err := d.defineFromXML("define", xml); err != nil {
+		return err
+	}
+
+	log.Infof("Starting KVM VM...")
+
+	return d.Start()
+}
+
+func (d *Driver) Start() error {
+	s, err := d.GetState()
+	if err != nil {
+		return err
+	}
+
+	switch s {
+	case state.Stopped:
+		if err := d.setupPrivateNetwork(); err != nil {
+			return err
+		}
+		if err := d.virsh("start", d.MachineName); err != nil {
+			return err
+		}
+		log.Infof("Waiting for VM to start...")
+	case state.Paused:
+		if err := d.virsh("resume", d.MachineName); err != nil {
+			return err
+		}
+		log.Infof("Resuming VM ...")
+	default:
+		log.Infof("VM not in restartable state")
+	}
+
+	// the IP is known once the VM got a DHCP lease
+	ip := ""
+	if err := utils.WaitForSpecific(func() bool {
+		ip, err = d.GetIP()
+		return err == nil
+	}, 60, 2*time.Second); err != nil {
+		return fmt.Errorf("%s did not get an IP address: %s", d.MachineName, err)
+	}
+
+	return ssh.WaitForTCP(fmt.Sprintf("%s:%d", ip, d.SSHPort))
+}
+
+func (d *Driver) Stop() error {
+	if err := d.virsh("shutdown", d.MachineName); err != nil {
+		return err
+	}
+	for {
+		s, err := d.GetState()
+		if err != nil {
+			return err
+		}
+		if s == state.Running || s == state.Stopping {
+			time.Sleep(1 * time.Second)
+		} else {
+			break
+		}
+	}
+	return nil
+}
+
+func (d *Driver) Remove() error {
+	s, err := d.GetState()
+	if err != nil {
+		if err == ErrMachineNotExist {
+			log.Infof("machine does not exist, assuming it has been removed already")
+			return nil
+		}
+		return err
+	}
+	if s != state.Stopped {
+		if err := d.Kill(); err != nil {
+			return err
+		}
+	}
+	return d.virsh("undefine", d.MachineName)
+}
+
+func (d *Driver) Restart() error {
+	s, err := d.GetState()
+	if err != nil {
+		return err
+	}
+
+	if s == state.Running {
+		if err := d.Stop(); err != nil {
+			return err
+		}
+	}
+	return d.Start()
+}
+
+func (d *Driver) Kill() error {
+	return d.virsh("destroy", d.MachineName)
+}
+
+func (d *Driver) GetState() (state.State, error) {
+	stdout, stderr, err := d.virshOutErr("domstate", d.MachineName)
+	if err != nil {
+		if reDomainNotFound.MatchString(stderr) {
+			return state.Error, ErrMachineNotExist
+		}
+		return state.Error, err
+	}
+	return parseDomainState(stdout), nil
+}
+
+// parseDomainState converts the output of virsh domstate
+func parseDomainState(out string) state.State {
+	switch strings.TrimSpace(out) {
+	case "running", "idle", "blocked":
+		return state.Running
+	case "paused":
+		return state.Paused
+	case "pmsuspended":
+		return state.Saved
+	case "in shutdown":
+		return state.Stopping
+	case "shut off":
+		return state.Stopped
+	case "crashed":
+		return state.Error
+	}
+	return state.None
+}
+
+// GetIP returns the address leased to the VM by the DHCP server of the
+// private network
+func (d *Driver) GetIP() (string, error) {
+	s, err := d.GetState()
+	if err != nil {
+		return "", err
+	}
+	if s != state.Running {
+		return "", drivers.ErrHostIsNotRunning
+	}
+
+	out, err := d.virshOut("net-dhcp-leases", d.PrivateNetwork)
+	if err != nil {
+		return "", err
+	}
+	return parseDHCPLeases(out, d.PrivateMAC)
+}
+
+// parseDHCPLeases finds the IPv4 address leased to mac in the output of
+// virsh net-dhcp-leases
+func parseDHCPLeases(out string, mac string) (string, error) {
+	for _, line := range strings.Split(out, "\n") {
+		// expiry date, expiry time, MAC, protocol, address/prefix, ...
+		fields := strings.Fields(line)
+		if len(fields) < 5 || !strings.EqualFold(fields[2], mac) || fields[3] != "ipv4" {
+			continue
+		}
+		return strings.SplitN(fields[4], "/", 2)[0], nil
+	}
+	return "", fmt.Errorf("no DHCP lease found for %s", mac)
+}
+
+// setupPrivateNetwork creates the private network if it does not exist and
+// starts it if it is not active, e.g. after the host was restarted
+func (d *Driver) setupPrivateNetwork() error {
+	out, stderr, err := d.virshOutErr("net-info", d.PrivateNetwork)
+	if err != nil {
+		if !reNetworkNotFound.MatchString(stderr) {
+			return err
+		}
+
+		log.Infof("Creating libvirt network %s...", d.PrivateNetwork)
+		xml, err := executeTemplate(privateNetworkXML, struct {
+			Name                         string
+			Address, Netmask, Start, End string
+		}{d.PrivateNetwork, privateNetwork.Address, privateNetwork.Netmask, privateNetwork.Start, privateNetwork.End})
+		if err != nil {
+			return err
+		}
+		if err := d.defineFromXML("net-define", xml); err != nil {
+			return err
+		}
+		if err := d.virsh("net-autostart", d.PrivateNetwork); err != nil {
+			return err
+		}
+		out = "Active: no"
+	}
+
+	if parseColonLines(out)["Active"] != "yes" {
+		return d.virsh("net-start", d.PrivateNetwork)
+	}
+	return nil
+}
+
+// defineFromXML runs a virsh command which reads its XML from a file
+func (d *Driver) defineFromXML(command string, xml string) error {
+	f, err := ioutil.TempFile("", "machine-kvm-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(xml); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return d.virsh(command, f.Name())
+}
+
+func (d *Driver) domainXML() (string, error) {
+	return executeTemplate(domainXML, struct {
+		*Driver
+		ISOPath  string
+		DiskPath string
+	}{d, d.isoPath(), d.diskPath()})
+}
+
+func executeTemplate(text string, data interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := template.Must(template.New("xml").Parse(text)).Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// randomMAC returns a MAC address with the prefix of QEMU
+func randomMAC() (string, error) {
+	b := make([]byte, 3)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("52:54:00:%02x:%02x:%02x", b[0], b[1], b[2]), nil
+}
+
+func (d *Driver) publicSSHKeyPath() string {
+	return d.GetSSHKeyPath() + ".pub"
+}
+
+func (d *Driver) isoPath() string {
+	return filepath.Join(d.storePath, isoFilename)
+}
+
+func (d *Driver) diskPath() string {
+	return filepath.Join(d.storePath, "disk.raw")
+}
+
+// Make a boot2docker VM disk image: a sparse raw image starting with a tar
+// holding the magic string, which makes boot2docker format the disk, and
+// the SSH public key.
+func (d *Driver) generateDiskImage(size int) error {
+	log.Debugf("Creating %d MB hard disk image...", size)
+
+	magicString := "boot2docker, please format-me"
+
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+
+	// magicString first so the automount script knows to format the disk
+	file := &tar.Header{Name: magicString, Size: int64(len(magicString))}
+	if err := tw.WriteHeader(file); err != nil {
+		return err
+	}
+	if _, err := tw.Write([]byte(magicString)); err != nil {
+		return err
+	}
+	// .ssh/key.pub => authorized_keys
+	file = &tar.Header{Name: ".ssh", Typeflag: tar.TypeDir, Mode: 0700}
+	if err := tw.WriteHeader(file); err != nil {
+		return err
+	}
+	pubKey, err := ioutil.ReadFile(d.publicSSHKeyPath())
+	if err != nil {
+		return err
+	}
+	for _, name := range []string{".ssh/authorized_keys", ".ssh/authorized_keys2"} {
+		file = &tar.Header{Name: name, Size: int64(len(pubKey)), Mode: 0644}
+		if err := tw.WriteHeader(file); err != nil {
+			return err
+		}
+		if _, err := tw.Write(pubKey); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	return createDiskImage(d.diskPath(), size, buf.Bytes())
+}
+
+// createDiskImage makes a raw disk image at dest with the given size in MB,
+// starting with data
+func createDiskImage(dest string, size int, data []byte) error {
+	sizeBytes := int64(size) << 20
+	if int64(len(data)) > sizeBytes {
+		return fmt.Errorf("a disk of %d MB is too small", size)
+	}
+
+	f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Truncate(sizeBytes); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
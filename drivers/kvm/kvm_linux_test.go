@@ -0,0 +1,129 @@
+package kvm
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/state"
+)
+
+func TestParseDomainState(t *testing.T) {
+	for out, expected := range map[string]state.State{
+		"running\n\n":     state.Running,
+		"paused\n":        state.Paused,
+		"shut off\n\n":    state.Stopped,
+		"in shutdown\n":   state.Stopping,
+		"pmsuspended\n":   state.Saved,
+		"crashed\n":       state.Error,
+		"unknown state\n": state.None,
+	} {
+		if s := parseDomainState(out); s != expected {
+			t.Fatalf("expected %s for %q; received %s", expected, out, s)
+		}
+	}
+}
+
+func TestParseDHCPLeases(t *testing.T) {
+	ip, err := parseDHCPLeases(testLeases, "52:54:00:AA:BB:01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip != "192.168.42.108" {
+		t.Fatalf("expected 192.168.42.108; received %s", ip)
+	}
+
+	if _, err := parseDHCPLeases(testLeases, "52:54:00:aa:bb:03"); err == nil {
+		t.Fatal("expected an error for a MAC without lease")
+	}
+}
+
+func TestRandomMAC(t *testing.T) {
+	mac, err := randomMAC()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(mac, "52:54:00:") || len(mac) != 17 {
+		t.Fatalf("unexpected MAC %s", mac)
+	}
+}
+
+func TestDomainXML(t *testing.T) {
+	d := &Driver{
+		MachineName:    "test",
+		CPU:            2,
+		Memory:         2048,
+		Network:        "default",
+		PrivateNetwork: "docker-machines",
+		PrivateMAC:     "52:54:00:aa:bb:01",
+		storePath:      "/machines/test",
+	}
+	xml, err := d.domainXML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"<name>test</name>",
+		"<memory unit='MiB'>2048</memory>",
+		"<vcpu>2</vcpu>",
+		"<source file='/machines/test/boot2docker.iso'/>",
+		"<source file='/machines/test/disk.raw'/>",
+		"<source network='default'/>",
+		"<mac address='52:54:00:aa:bb:01'/>",
+		"<source network='docker-machines'/>",
+	} {
+		if !strings.Contains(xml, expected) {
+			t.Fatalf("expected %s in\n%s", expected, xml)
+		}
+	}
+}
+
+func TestGenerateDiskImage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "machine-kvm-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := &Driver{storePath: dir}
+	if err := ioutil.WriteFile(d.publicSSHKeyPath(), []byte("ssh-rsa AAAA test\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.generateDiskImage(2); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, "disk.raw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 2<<20 {
+		t.Fatalf("expected a disk of %d bytes; received %d", 2<<20, info.Size())
+	}
+
+	f, err := os.Open(d.diskPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	names := []string{}
+	tr := tar.NewReader(f)
+	for {
+		h, err := tr.Next()
+		if err != nil {
+			break
+		}
+		names = append(names, h.Name)
+	}
+	expected := "boot2docker, please format-me,.ssh,.ssh/authorized_keys,.ssh/authorized_keys2"
+	if strings.Join(names, ",") != expected {
+		t.Fatalf("expected %s; received %s", expected, strings.Join(names, ","))
+	}
+
+	if err := d.generateDiskImage(2); err == nil {
+		t.Fatal("expected an error for an existing disk")
+	}
+}
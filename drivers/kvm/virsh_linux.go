@@ -0,0 +1,73 @@
+package kvm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+var (
+	reColonLine          = regexp.MustCompile(`(.+):\s+(.*)`)
+	reDomainNotFound     = regexp.MustCompile(`(?i)domain not found|failed to get domain`)
+	reNetworkNotFound    = regexp.MustCompile(`(?i)network not found|failed to get network`)
+	ErrMachineNotExist   = errors.New("machine does not exist")
+	ErrVirshNotFound     = errors.New("virsh not found")
+	virshCmd             = "virsh"
+	defaultConnectionURI = "qemu:///system"
+)
+
+func (d *Driver) virsh(args ...string) error {
+	_, _, err := d.virshOutErr(args...)
+	return err
+}
+
+func (d *Driver) virshOut(args ...string) (string, error) {
+	stdout, _, err := d.virshOutErr(args...)
+	return stdout, err
+}
+
+// virshOutErr runs virsh against the libvirt daemon of the driver
+func (d *Driver) virshOutErr(args ...string) (string, string, error) {
+	uri := d.ConnectionURI
+	if uri == "" {
+		uri = defaultConnectionURI
+	}
+	return virshOutErr(append([]string{"--connect", uri}, args...)...)
+}
+
+func virshOutErr(args ...string) (string, string, error) {
+	cmd := exec.Command(virshCmd, args...)
+	log.Debugf("executing: %v %v", virshCmd, strings.Join(args, " "))
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	stderrStr := stderr.String()
+	log.Debugf("STDOUT: %v", stdout.String())
+	log.Debugf("STDERR: %v", stderrStr)
+	if err != nil {
+		if ee, ok := err.(*exec.Error); ok && ee.Err == exec.ErrNotFound {
+			err = ErrVirshNotFound
+		} else if stderrStr != "" {
+			err = fmt.Errorf("%v %v failed: %v", virshCmd, strings.Join(args, " "), strings.TrimSpace(stderrStr))
+		}
+	}
+	return stdout.String(), stderrStr, err
+}
+
+// parseColonLines parses the "key: value" output of virsh info commands
+func parseColonLines(out string) map[string]string {
+	values := map[string]string{}
+	for _, line := range strings.Split(out, "\n") {
+		if groups := reColonLine.FindStringSubmatch(strings.TrimSpace(line)); groups != nil {
+			values[groups[1]] = groups[2]
+		}
+	}
+	return values
+}
@@ -0,0 +1,173 @@
+package kvm
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/state"
+)
+
+const testLeases = ` Expiry Time          MAC address        Protocol  IP address                Hostname        Client ID or DUID
+-------------------------------------------------------------------------------------------------------------------
+ 2015-05-20 14:36:13  52:54:00:aa:bb:01  ipv4      192.168.42.108/24         boot2docker     -
+ 2015-05-20 14:38:51  52:54:00:aa:bb:02  ipv4      192.168.42.115/24         boot2docker     -
+`
+
+// fakeVirsh replaces virsh by a script which logs its arguments and runs
+// commands, a case body matched against the virsh command
+func fakeVirsh(t *testing.T, commands string) (string, func()) {
+	dir, err := ioutil.TempDir("", "machine-kvm-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logPath := filepath.Join(dir, "log")
+	script := `#!/bin/sh
+echo "$@" >> ` + logPath + `
+shift 2
+case "$1" in
+` + commands + `
+esac
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, "virsh"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := virshCmd
+	virshCmd = filepath.Join(dir, "virsh")
+	return logPath, func() {
+		virshCmd = previous
+		os.RemoveAll(dir)
+	}
+}
+
+func readLog(t *testing.T, logPath string) []string {
+	b, err := ioutil.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(b)), "\n")
+}
+
+func TestVirshConnectionURI(t *testing.T) {
+	logPath, cleanup := fakeVirsh(t, "")
+	defer cleanup()
+
+	d := &Driver{}
+	if err := d.virsh("version"); err != nil {
+		t.Fatal(err)
+	}
+	d.ConnectionURI = "qemu+ssh://kvm.example.com/system"
+	if err := d.virsh("version"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"--connect qemu:///system version",
+		"--connect qemu+ssh://kvm.example.com/system version",
+	}
+	if log := readLog(t, logPath); strings.Join(log, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("expected %q; received %q", expected, log)
+	}
+}
+
+func TestVirshError(t *testing.T) {
+	_, cleanup := fakeVirsh(t, `start) echo "error: Failed to start domain test" >&2; exit 1;;`)
+	defer cleanup()
+
+	d := &Driver{MachineName: "test"}
+	err := d.virsh("start", "test")
+	if err == nil || !strings.Contains(err.Error(), "Failed to start domain test") {
+		t.Fatalf("expected the error of virsh; received %v", err)
+	}
+}
+
+func TestVirshNotFound(t *testing.T) {
+	previous := virshCmd
+	virshCmd = "machine-test-virsh-not-found"
+	defer func() { virshCmd = previous }()
+
+	if err := (&Driver{}).virsh("version"); err != ErrVirshNotFound {
+		t.Fatalf("expected %v; received %v", ErrVirshNotFound, err)
+	}
+}
+
+func TestGetStateNotExist(t *testing.T) {
+	_, cleanup := fakeVirsh(t, `domstate) echo "error: failed to get domain 'test'" >&2; exit 1;;`)
+	defer cleanup()
+
+	d := &Driver{MachineName: "test"}
+	if _, err := d.GetState(); err != ErrMachineNotExist {
+		t.Fatalf("expected %v; received %v", ErrMachineNotExist, err)
+	}
+	if err := d.Remove(); err != nil {
+		t.Fatalf("expected a missing domain to be removed; received %v", err)
+	}
+}
+
+func TestGetIP(t *testing.T) {
+	_, cleanup := fakeVirsh(t, `domstate) echo running;;
+net-dhcp-leases) cat <<'LEASES'
+`+testLeases+`LEASES
+;;`)
+	defer cleanup()
+
+	d := &Driver{MachineName: "test", PrivateNetwork: "docker-machines", PrivateMAC: "52:54:00:aa:bb:02"}
+	ip, err := d.GetIP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip != "192.168.42.115" {
+		t.Fatalf("expected 192.168.42.115; received %s", ip)
+	}
+}
+
+func TestGetIPStopped(t *testing.T) {
+	_, cleanup := fakeVirsh(t, `domstate) echo "shut off";;`)
+	defer cleanup()
+
+	d := &Driver{MachineName: "test"}
+	if _, err := d.GetIP(); err == nil {
+		t.Fatal("expected an error for a stopped VM")
+	}
+	if s, _ := d.GetState(); s != state.Stopped {
+		t.Fatalf("expected %s; received %s", state.Stopped, s)
+	}
+}
+
+func TestSetupPrivateNetworkCreate(t *testing.T) {
+	logPath, cleanup := fakeVirsh(t, `net-info) echo "error: failed to get network 'docker-machines'" >&2; exit 1;;`)
+	defer cleanup()
+
+	d := &Driver{PrivateNetwork: "docker-machines"}
+	if err := d.setupPrivateNetwork(); err != nil {
+		t.Fatal(err)
+	}
+
+	log := readLog(t, logPath)
+	if len(log) != 4 {
+		t.Fatalf("expected 4 virsh commands; received %q", log)
+	}
+	for i, prefix := range []string{"net-info", "net-define", "net-autostart", "net-start"} {
+		if !strings.HasPrefix(log[i], "--connect qemu:///system "+prefix+" ") {
+			t.Fatalf("expected %s; received %s", prefix, log[i])
+		}
+	}
+}
+
+func TestSetupPrivateNetworkActive(t *testing.T) {
+	for active, commands := range map[string]int{"yes": 1, "no": 2} {
+		logPath, cleanup := fakeVirsh(t, `net-info) printf "Name:           docker-machines\nActive:         `+active+`\n";;`)
+
+		d := &Driver{PrivateNetwork: "docker-machines"}
+		if err := d.setupPrivateNetwork(); err != nil {
+			t.Fatal(err)
+		}
+		if log := readLog(t, logPath); len(log) != commands {
+			t.Fatalf("expected %d virsh commands for Active: %s; received %q", commands, active, log)
+		}
+		cleanup()
+	}
+}
@@ -1,13 +1,19 @@
 package openstack
 
 import (
+	"crypto/rand"
 	"crypto/tls"
+	"encoding/hex"
+	"fmt"
 	"net/http"
+	"path"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/docker/machine/drivers"
 	"github.com/rackspace/gophercloud"
 	"github.com/rackspace/gophercloud/openstack"
 	"github.com/rackspace/gophercloud/openstack/compute/v2/extensions/keypairs"
+	"github.com/rackspace/gophercloud/openstack/compute/v2/extensions/secgroups"
 	"github.com/rackspace/gophercloud/openstack/compute/v2/extensions/startstop"
 	"github.com/rackspace/gophercloud/openstack/compute/v2/flavors"
 	"github.com/rackspace/gophercloud/openstack/compute/v2/images"
@@ -40,6 +46,16 @@ type Client interface {
 	GetFloatingIPs(d *Driver) ([]FloatingIp, error)
 	GetFloatingIpPoolId(d *Driver) (string, error)
 	GetInstancePortId(d *Driver) (string, error)
+	AuthorizePorts(d *Driver, ports []*drivers.Port) error
+	DeauthorizePorts(d *Driver, ports []*drivers.Port) error
+	DeletePortsSecurityGroup(d *Driver) error
+	CreateImage(d *Driver, name string) (string, error)
+	GetInstanceImages(d *Driver) ([]images.Image, error)
+	GetImageStatus(d *Driver, imageId string) (string, error)
+	GetInstanceImageId(d *Driver) (string, error)
+	RebuildInstance(d *Driver, imageId string) error
+	DeleteImage(d *Driver, imageId string) error
+	ResizeInstance(d *Driver, flavorId string) error
 }
 
 type GenericClient struct {
@@ -130,6 +146,21 @@ func (c *GenericClient) DeleteInstance(d *Driver) error {
 	return nil
 }
 
+// ResizeInstance changes the flavor of the instance and confirms the resize
+// once the instance is ready to be verified
+func (c *GenericClient) ResizeInstance(d *Driver, flavorId string) error {
+	if result := servers.Resize(c.Compute, d.MachineId, servers.ResizeOpts{FlavorRef: flavorId}); result.Err != nil {
+		return result.Err
+	}
+	if err := c.WaitForInstanceStatus(d, "VERIFY_RESIZE", 600); err != nil {
+		return err
+	}
+	if result := servers.ConfirmResize(c.Compute, d.MachineId); result.Err != nil {
+		return result.Err
+	}
+	return nil
+}
+
 func (c *GenericClient) WaitForInstanceStatus(d *Driver, status string, timeout int) error {
 	if err := servers.WaitForStatus(c.Compute, d.MachineId, status, timeout); err != nil {
 		return err
@@ -262,6 +293,187 @@ func (c *GenericClient) DeleteKeyPair(d *Driver, name string) error {
 	return nil
 }
 
+// portsSecurityGroupName is the security group holding the rules for the
+// ports opened on a machine, so that they do not affect other servers
+func portsSecurityGroupName(d *Driver) string {
+	return fmt.Sprintf("docker-machine-%s", d.MachineName)
+}
+
+func (c *GenericClient) getPortsSecurityGroup(d *Driver) (*secgroups.SecurityGroup, error) {
+	var group *secgroups.SecurityGroup
+	err := secgroups.List(c.Compute).EachPage(func(page pagination.Page) (bool, error) {
+		groups, err := secgroups.ExtractSecurityGroups(page)
+		if err != nil {
+			return false, err
+		}
+		for i := range groups {
+			if groups[i].Name == portsSecurityGroupName(d) {
+				group = &groups[i]
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+	return group, err
+}
+
+func (c *GenericClient) AuthorizePorts(d *Driver, ports []*drivers.Port) error {
+	group, err := c.getPortsSecurityGroup(d)
+	if err != nil {
+		return err
+	}
+	if group == nil {
+		log.WithField("Name", portsSecurityGroupName(d)).Debug("creating security group...")
+		group, err = secgroups.Create(c.Compute, secgroups.CreateOpts{
+			Name:        portsSecurityGroupName(d),
+			Description: fmt.Sprintf("Ports opened on %s by docker machine", d.MachineName),
+		}).Extract()
+		if err != nil {
+			return err
+		}
+		if result := secgroups.AddServerToGroup(c.Compute, d.MachineId, group.Name); result.Err != nil {
+			return result.Err
+		}
+	}
+
+	for _, p := range ports {
+		cidr := p.CIDR
+		if cidr == "" {
+			cidr = "0.0.0.0/0"
+		}
+		_, err := secgroups.CreateRule(c.Compute, secgroups.CreateRuleOpts{
+			ParentGroupID: group.ID,
+			FromPort:      p.Port,
+			ToPort:        p.Port,
+			IPProtocol:    p.Protocol,
+			CIDR:          cidr,
+		}).Extract()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *GenericClient) DeauthorizePorts(d *Driver, ports []*drivers.Port) error {
+	group, err := c.getPortsSecurityGroup(d)
+	if err != nil {
+		return err
+	}
+	if group == nil {
+		return nil
+	}
+
+	for _, p := range ports {
+		for _, rule := range group.Rules {
+			if rule.FromPort != p.Port || rule.ToPort != p.Port || rule.IPProtocol != p.Protocol {
+				continue
+			}
+			if p.CIDR != "" && rule.IPRange.CIDR != p.CIDR {
+				continue
+			}
+			if result := secgroups.DeleteRule(c.Compute, rule.ID); result.Err != nil {
+				return result.Err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *GenericClient) DeletePortsSecurityGroup(d *Driver) error {
+	group, err := c.getPortsSecurityGroup(d)
+	if err != nil || group == nil {
+		return err
+	}
+	if result := secgroups.Delete(c.Compute, group.ID); result.Err != nil {
+		return result.Err
+	}
+	return nil
+}
+
+// CreateImage creates an image of the instance, which gophercloud does not
+// provide, and returns the ID of the new image
+func (c *GenericClient) CreateImage(d *Driver, name string) (string, error) {
+	resp, err := c.Compute.Request("POST", c.Compute.ServiceURL("servers", d.MachineId, "action"), gophercloud.RequestOpts{
+		JSONBody: map[string]interface{}{
+			"createImage": map[string]interface{}{"name": name},
+		},
+		OkCodes: []int{202},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return "", fmt.Errorf("no location returned for image %s", name)
+	}
+	return path.Base(location), nil
+}
+
+// GetInstanceImages returns the images created from the instance
+func (c *GenericClient) GetInstanceImages(d *Driver) ([]images.Image, error) {
+	result := []images.Image{}
+	pager := images.ListDetail(c.Compute, images.ListOpts{Server: d.MachineId})
+	err := pager.EachPage(func(page pagination.Page) (bool, error) {
+		imageList, err := images.ExtractImages(page)
+		if err != nil {
+			return false, err
+		}
+		result = append(result, imageList...)
+		return true, nil
+	})
+	return result, err
+}
+
+func (c *GenericClient) GetImageStatus(d *Driver, imageId string) (string, error) {
+	image, err := images.Get(c.Compute, imageId).Extract()
+	if err != nil {
+		return "", err
+	}
+	return image.Status, nil
+}
+
+// GetInstanceImageId returns the ID of the image the instance was last
+// built from
+func (c *GenericClient) GetInstanceImageId(d *Driver) (string, error) {
+	server, err := c.GetServerDetail(d)
+	if err != nil {
+		return "", err
+	}
+	id, _ := server.Image["id"].(string)
+	return id, nil
+}
+
+func (c *GenericClient) RebuildInstance(d *Driver, imageId string) error {
+	// the admin password is required but not used, SSH uses the key pair
+	password := make([]byte, 16)
+	if _, err := rand.Read(password); err != nil {
+		return err
+	}
+	opts := servers.RebuildOpts{
+		ImageID:   imageId,
+		AdminPass: hex.EncodeToString(password),
+	}
+	if result := servers.Rebuild(c.Compute, d.MachineId, opts); result.Err != nil {
+		return result.Err
+	}
+	return nil
+}
+
+// DeleteImage deletes an image, which gophercloud does not provide
+func (c *GenericClient) DeleteImage(d *Driver, imageId string) error {
+	resp, err := c.Compute.Request("DELETE", c.Compute.ServiceURL("images", imageId), gophercloud.RequestOpts{
+		OkCodes: []int{204},
+	})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
 func (c *GenericClient) GetServerDetail(d *Driver) (*servers.Server, error) {
 	server, err := servers.Get(c.Compute, d.MachineId).Extract()
 	if err != nil {
@@ -419,7 +631,10 @@ func (c *GenericClient) Authenticate(d *Driver) error {
 	if d.Insecure {
 		// Configure custom TLS settings.
 		config := &tls.Config{InsecureSkipVerify: true}
-		transport := &http.Transport{TLSClientConfig: config}
+		transport := &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: config,
+		}
 		provider.HTTPClient.Transport = transport
 	}
 
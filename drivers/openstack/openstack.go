@@ -210,11 +210,17 @@ func NewDerivedDriver(machineName string, storePath string, client Client, caCer
 }
 
 func (d *Driver) AuthorizePort(ports []*drivers.Port) error {
-	return nil
+	if err := d.initCompute(); err != nil {
+		return err
+	}
+	return d.client.AuthorizePorts(d, ports)
 }
 
 func (d *Driver) DeauthorizePort(ports []*drivers.Port) error {
-	return nil
+	if err := d.initCompute(); err != nil {
+		return err
+	}
+	return d.client.DeauthorizePorts(d, ports)
 }
 
 func (d *Driver) GetMachineName() string {
@@ -432,6 +438,10 @@ func (d *Driver) Remove() error {
 	if err := d.client.DeleteKeyPair(d, d.KeyPairName); err != nil {
 		return err
 	}
+	// the security group can only be deleted once the instance is gone
+	if err := d.client.DeletePortsSecurityGroup(d); err != nil {
+		log.Warnf("Unable to delete security group %s: %s", portsSecurityGroupName(d), err)
+	}
 	return nil
 }
 
@@ -446,6 +456,44 @@ func (d *Driver) Restart() error {
 	return d.waitForInstanceToStart()
 }
 
+// Resize changes the flavor of the instance to the flavor with the given
+// name or ID
+func (d *Driver) Resize(cpus int, memory int, size string) error {
+	if cpus > 0 || memory > 0 {
+		return fmt.Errorf("the CPUs and memory of OpenStack instances are set by their flavor; use --size to choose a flavor")
+	}
+	if err := d.initCompute(); err != nil {
+		return err
+	}
+
+	flavorName, flavorId := d.FlavorName, d.FlavorId
+	d.FlavorName = size
+	id, err := d.client.GetFlavorId(d)
+	d.FlavorName = flavorName
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		flavorName, flavorId = size, id
+	} else {
+		flavorName, flavorId = "", size
+	}
+
+	log.WithFields(log.Fields{
+		"MachineId": d.MachineId,
+		"FlavorId":  flavorId,
+	}).Info("Resizing OpenStack instance...")
+	if err := d.client.ResizeInstance(d, flavorId); err != nil {
+		return err
+	}
+	// a stopped instance is stopped again once the resize is confirmed
+	if err := d.client.WaitForInstanceStatus(d, "SHUTOFF", 200); err != nil {
+		return err
+	}
+	d.FlavorName, d.FlavorId = flavorName, flavorId
+	return nil
+}
+
 func (d *Driver) Kill() error {
 	return d.Stop()
 }
@@ -0,0 +1,138 @@
+package openstack
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/machine/drivers"
+	"github.com/docker/machine/utils"
+	"github.com/rackspace/gophercloud/openstack/compute/v2/images"
+)
+
+// snapshotImageName returns the name of the image holding a snapshot; image
+// names are shared by the tenant
+func snapshotImageName(d *Driver, name string) string {
+	return fmt.Sprintf("%s-%s", d.MachineName, name)
+}
+
+// CreateSnapshot creates an image of the instance and waits for it to be
+// saved
+func (d *Driver) CreateSnapshot(name string) error {
+	if err := d.initCompute(); err != nil {
+		return err
+	}
+	if _, err := d.getSnapshotImage(name); err == nil {
+		return fmt.Errorf("snapshot %s of %s already exists", name, d.MachineName)
+	}
+
+	log.WithField("MachineId", d.MachineId).Infof("Creating image of OpenStack instance for snapshot %s...", name)
+	imageId, err := d.client.CreateImage(d, snapshotImageName(d, name))
+	if err != nil {
+		return err
+	}
+
+	var imageErr error
+	saved := func() bool {
+		status, err := d.client.GetImageStatus(d, imageId)
+		if err != nil {
+			log.Debugf("Error getting status of image %s: %s", imageId, err)
+			return false
+		}
+		switch status {
+		case "ACTIVE":
+			return true
+		case "ERROR", "DELETED":
+			imageErr = fmt.Errorf("image %s of %s is in state %s", imageId, d.MachineName, status)
+			return true
+		}
+		return false
+	}
+	if err := utils.WaitForSpecific(saved, 120, 5*time.Second); err != nil {
+		return err
+	}
+	return imageErr
+}
+
+// ListSnapshots returns the snapshot images of the instance, oldest first.
+// The current snapshot is the image the instance was last rebuilt from.
+func (d *Driver) ListSnapshots() ([]*drivers.Snapshot, error) {
+	if err := d.initCompute(); err != nil {
+		return nil, err
+	}
+	imageList, err := d.client.GetInstanceImages(d)
+	if err != nil {
+		return nil, err
+	}
+	currentId, err := d.client.GetInstanceImageId(d)
+	if err != nil {
+		return nil, err
+	}
+	return instanceSnapshots(imageList, snapshotImageName(d, ""), currentId), nil
+}
+
+// RestoreSnapshot rebuilds the instance from the snapshot image
+func (d *Driver) RestoreSnapshot(name string) error {
+	image, err := d.getSnapshotImage(name)
+	if err != nil {
+		return err
+	}
+
+	log.WithField("MachineId", d.MachineId).Infof("Rebuilding OpenStack instance from snapshot %s...", name)
+	if err := d.client.RebuildInstance(d, image.ID); err != nil {
+		return err
+	}
+	return d.waitForInstanceActive()
+}
+
+// RemoveSnapshot deletes the snapshot image
+func (d *Driver) RemoveSnapshot(name string) error {
+	image, err := d.getSnapshotImage(name)
+	if err != nil {
+		return err
+	}
+	return d.client.DeleteImage(d, image.ID)
+}
+
+func (d *Driver) getSnapshotImage(name string) (*images.Image, error) {
+	if err := d.initCompute(); err != nil {
+		return nil, err
+	}
+	imageList, err := d.client.GetInstanceImages(d)
+	if err != nil {
+		return nil, err
+	}
+	for i := range imageList {
+		if imageList[i].Name == snapshotImageName(d, name) {
+			return &imageList[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%s has no snapshot %s", d.MachineName, name)
+}
+
+type imagesByCreation []images.Image
+
+func (s imagesByCreation) Len() int           { return len(s) }
+func (s imagesByCreation) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s imagesByCreation) Less(i, j int) bool { return s[i].Created < s[j].Created }
+
+// instanceSnapshots converts the images named with prefix to snapshots,
+// oldest first
+func instanceSnapshots(imageList []images.Image, prefix string, currentId string) []*drivers.Snapshot {
+	sort.Sort(imagesByCreation(imageList))
+
+	result := []*drivers.Snapshot{}
+	for _, image := range imageList {
+		if !strings.HasPrefix(image.Name, prefix) {
+			continue
+		}
+		result = append(result, &drivers.Snapshot{
+			Name:    strings.TrimPrefix(image.Name, prefix),
+			ID:      image.ID,
+			Current: image.ID == currentId,
+		})
+	}
+	return result
+}
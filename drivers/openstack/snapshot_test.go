@@ -0,0 +1,25 @@
+package openstack
+
+import (
+	"testing"
+
+	"github.com/rackspace/gophercloud/openstack/compute/v2/images"
+)
+
+func TestInstanceSnapshots(t *testing.T) {
+	snapshots := instanceSnapshots([]images.Image{
+		{ID: "2", Name: "dev-images", Created: "2015-03-02T10:00:00Z"},
+		{ID: "3", Name: "other-image", Created: "2015-03-03T10:00:00Z"},
+		{ID: "1", Name: "dev-clean", Created: "2015-03-01T10:00:00Z"},
+	}, "dev-", "2")
+
+	if len(snapshots) != 2 {
+		t.Fatalf("expected 2 snapshots; received %d", len(snapshots))
+	}
+	if snapshots[0].Name != "clean" || snapshots[0].ID != "1" || snapshots[0].Current {
+		t.Fatalf("unexpected first snapshot %+v", *snapshots[0])
+	}
+	if snapshots[1].Name != "images" || snapshots[1].ID != "2" || !snapshots[1].Current {
+		t.Fatalf("unexpected second snapshot %+v", *snapshots[1])
+	}
+}
@@ -0,0 +1,322 @@
+package plugin
+
+import (
+	"fmt"
+	"net/rpc"
+	"os"
+	"os/exec"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+	"github.com/docker/machine/drivers"
+	"github.com/docker/machine/provider"
+	"github.com/docker/machine/state"
+)
+
+// flagsTimeout bounds the time a plugin takes to return its flags, so that a
+// hung executable cannot hang the command creating machines
+var flagsTimeout = 10 * time.Second
+
+// Plugin is a driver served by an executable
+type Plugin struct {
+	Name        string
+	Path        string
+	flags       []Flag
+	flagsLoaded bool
+}
+
+func NewPlugin(name string, path string) *Plugin {
+	return &Plugin{Name: name, Path: path}
+}
+
+// RegisteredDriver returns the functions registering the plugin as a driver
+func (p *Plugin) RegisteredDriver() *drivers.RegisteredDriver {
+	return &drivers.RegisteredDriver{
+		New:            p.NewDriver,
+		GetCreateFlags: p.GetCreateFlags,
+		Plugin:         true,
+	}
+}
+
+// GetCreateFlags returns the flags of the plugin, which are asked once to a
+// process of the plugin. A plugin which fails has no flags.
+func (p *Plugin) GetCreateFlags() []cli.Flag {
+	return toCLIFlags(p.getFlags())
+}
+
+func (p *Plugin) getFlags() []Flag {
+	if p.flagsLoaded {
+		return p.flags
+	}
+	p.flags, p.flagsLoaded = []Flag{}, true
+
+	client, cmd, err := p.start()
+	if err != nil {
+		log.Warnf("Error starting the driver plugin %s: %s", p.Path, err)
+		return p.flags
+	}
+	defer stop(client, cmd)
+
+	flags := []Flag{}
+	call := client.Go("Driver.GetCreateFlags", Empty{}, &flags, nil)
+	select {
+	case <-call.Done:
+		if call.Error != nil {
+			log.Warnf("Error getting the flags of the driver plugin %s: %s", p.Path, call.Error)
+			return p.flags
+		}
+	case <-time.After(flagsTimeout):
+		log.Warnf("Timed out getting the flags of the driver plugin %s", p.Path)
+		if err := cmd.Process.Kill(); err != nil {
+			log.Debugf("Error killing %s: %s", p.Path, err)
+		}
+		return p.flags
+	}
+	p.flags = flags
+	return p.flags
+}
+
+// NewDriver returns a driver whose process is started when it is first used
+func (p *Plugin) NewDriver(machineName string, storePath string, caCert string, privateKey string) (drivers.Driver, error) {
+	return &Driver{
+		plugin: p,
+		args: NewArgs{
+			MachineName: machineName,
+			StorePath:   storePath,
+			CaCert:      caCert,
+			PrivateKey:  privateKey,
+		},
+	}, nil
+}
+
+// start starts a process of the plugin and connects to it
+func (p *Plugin) start() (*rpc.Client, *exec.Cmd, error) {
+	cmd := exec.Command(p.Path)
+	cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%s", pluginEnvVar, pluginEnvValue))
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	log.Debugf("executing: %v", p.Path)
+	if err := cmd.Start(); err != nil {
+		return nil, nil, err
+	}
+	return rpc.NewClient(stdioConn{stdout, stdin}), cmd, nil
+}
+
+// stop closes the connection to a plugin, which then exits
+func stop(client *rpc.Client, cmd *exec.Cmd) {
+	client.Close()
+	if err := cmd.Wait(); err != nil {
+		log.Debugf("Error waiting for %s: %s", cmd.Path, err)
+	}
+}
+
+// Driver calls the driver served by a process of a plugin. Its
+// configuration is the one of the served driver, so that it is saved in
+// config.json like the configuration of built-in drivers.
+type Driver struct {
+	plugin *Plugin
+	args   NewArgs
+	client *rpc.Client
+	cmd    *exec.Cmd
+	config []byte
+}
+
+// connect starts the process of the driver on first use and loads the
+// configuration read from config.json
+func (d *Driver) connect() (*rpc.Client, error) {
+	if d.client != nil {
+		return d.client, nil
+	}
+
+	client, cmd, err := d.plugin.start()
+	if err != nil {
+		return nil, fmt.Errorf("error starting the driver plugin %s: %s", d.plugin.Path, err)
+	}
+	if err := client.Call("Driver.New", d.args, &Empty{}); err != nil {
+		stop(client, cmd)
+		return nil, err
+	}
+	if d.config != nil {
+		if err := client.Call("Driver.SetConfigRaw", d.config, &Empty{}); err != nil {
+			stop(client, cmd)
+			return nil, err
+		}
+	}
+	d.client, d.cmd = client, cmd
+	return client, nil
+}
+
+// Close stops the process of the driver. The process is started again by
+// the next call, so Close is called once the host is no longer used rather
+// than when it will never be used again.
+func (d *Driver) Close() error {
+	if d.client == nil {
+		return nil
+	}
+	stop(d.client, d.cmd)
+	d.client, d.cmd = nil, nil
+	return nil
+}
+
+func (d *Driver) call(method string, args interface{}, reply interface{}) error {
+	client, err := d.connect()
+	if err != nil {
+		return err
+	}
+	if err := client.Call("Driver."+method, args, reply); err != nil {
+		// errors are sent as strings; restore the ones Machine checks for
+		if err.Error() == drivers.ErrHostIsNotRunning.Error() {
+			return drivers.ErrHostIsNotRunning
+		}
+		return err
+	}
+	return nil
+}
+
+func (d *Driver) stringCall(method string) (string, error) {
+	var reply string
+	err := d.call(method, Empty{}, &reply)
+	return reply, err
+}
+
+// MarshalJSON returns the configuration of the served driver
+func (d *Driver) MarshalJSON() ([]byte, error) {
+	if d.client == nil {
+		if d.config == nil {
+			return []byte("{}"), nil
+		}
+		return d.config, nil
+	}
+	var data []byte
+	if err := d.call("GetConfigRaw", Empty{}, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// UnmarshalJSON keeps the configuration, which is loaded into the served
+// driver once its process is started
+func (d *Driver) UnmarshalJSON(data []byte) error {
+	d.config = append([]byte{}, data...)
+	if d.client == nil {
+		return nil
+	}
+	return d.call("SetConfigRaw", d.config, &Empty{})
+}
+
+func (d *Driver) AuthorizePort(ports []*drivers.Port) error {
+	return d.call("AuthorizePort", ports, &Empty{})
+}
+
+func (d *Driver) Create() error {
+	return d.call("Create", Empty{}, &Empty{})
+}
+
+func (d *Driver) DeauthorizePort(ports []*drivers.Port) error {
+	return d.call("DeauthorizePort", ports, &Empty{})
+}
+
+// DriverName returns the name of the plugin, under which the driver is
+// registered
+func (d *Driver) DriverName() string {
+	return d.plugin.Name
+}
+
+func (d *Driver) GetIP() (string, error) {
+	return d.stringCall("GetIP")
+}
+
+func (d *Driver) GetMachineName() string {
+	name, err := d.stringCall("GetMachineName")
+	if err != nil {
+		log.Warnf("Error getting the machine name from the driver plugin %s: %s", d.plugin.Name, err)
+		return d.args.MachineName
+	}
+	return name
+}
+
+func (d *Driver) GetSSHHostname() (string, error) {
+	return d.stringCall("GetSSHHostname")
+}
+
+func (d *Driver) GetSSHKeyPath() string {
+	path, err := d.stringCall("GetSSHKeyPath")
+	if err != nil {
+		log.Warnf("Error getting the SSH key path from the driver plugin %s: %s", d.plugin.Name, err)
+	}
+	return path
+}
+
+func (d *Driver) GetSSHPort() (int, error) {
+	var port int
+	err := d.call("GetSSHPort", Empty{}, &port)
+	return port, err
+}
+
+func (d *Driver) GetSSHUsername() string {
+	user, err := d.stringCall("GetSSHUsername")
+	if err != nil {
+		log.Warnf("Error getting the SSH user from the driver plugin %s: %s", d.plugin.Name, err)
+	}
+	return user
+}
+
+func (d *Driver) GetURL() (string, error) {
+	return d.stringCall("GetURL")
+}
+
+func (d *Driver) GetState() (state.State, error) {
+	var s state.State
+	if err := d.call("GetState", Empty{}, &s); err != nil {
+		return state.Error, err
+	}
+	return s, nil
+}
+
+func (d *Driver) GetProviderType() provider.ProviderType {
+	var t provider.ProviderType
+	if err := d.call("GetProviderType", Empty{}, &t); err != nil {
+		log.Warnf("Error getting the provider type from the driver plugin %s: %s", d.plugin.Name, err)
+		return provider.None
+	}
+	return t
+}
+
+func (d *Driver) Kill() error {
+	return d.call("Kill", Empty{}, &Empty{})
+}
+
+func (d *Driver) PreCreateCheck() error {
+	return d.call("PreCreateCheck", Empty{}, &Empty{})
+}
+
+func (d *Driver) Remove() error {
+	return d.call("Remove", Empty{}, &Empty{})
+}
+
+func (d *Driver) Restart() error {
+	return d.call("Restart", Empty{}, &Empty{})
+}
+
+// SetConfigFromFlags sends the values of the flags of the plugin and of the
+// options of "create" read by drivers
+func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
+	return d.call("SetConfigFromFlags", readOptions(d.plugin.getFlags(), flags), &Empty{})
+}
+
+func (d *Driver) Start() error {
+	return d.call("Start", Empty{}, &Empty{})
+}
+
+func (d *Driver) Stop() error {
+	return d.call("Stop", Empty{}, &Empty{})
+}
@@ -0,0 +1,122 @@
+package plugin
+
+import (
+	"fmt"
+
+	"github.com/codegangsta/cli"
+	"github.com/docker/machine/drivers"
+)
+
+// sharedOptions are the options of "create" which are not flags of a driver
+// but are read by drivers in SetConfigFromFlags
+var sharedOptions = []Flag{
+	{Kind: "bool", Name: "swarm-master"},
+	{Kind: "string", Name: "swarm-host"},
+	{Kind: "string", Name: "swarm-discovery"},
+}
+
+// Flag describes a create flag of a plugin, as cli.Flag is an interface
+// which cannot be sent over RPC
+type Flag struct {
+	Kind        string
+	Name        string
+	Usage       string
+	EnvVar      string
+	String      string
+	StringSlice []string
+	Int         int
+}
+
+// Options holds the values of the flags of a plugin, read from the
+// DriverOptions of "create"
+type Options struct {
+	Strings      map[string]string
+	StringSlices map[string][]string
+	Ints         map[string]int
+	Bools        map[string]bool
+}
+
+// toFlags describes the flags of a driver; only the kinds which can be read
+// through DriverOptions are supported
+func toFlags(cliFlags []cli.Flag) ([]Flag, error) {
+	flags := []Flag{}
+	for _, f := range cliFlags {
+		switch f := f.(type) {
+		case cli.StringFlag:
+			flags = append(flags, Flag{Kind: "string", Name: f.Name, Usage: f.Usage, EnvVar: f.EnvVar, String: f.Value})
+		case cli.StringSliceFlag:
+			flag := Flag{Kind: "stringslice", Name: f.Name, Usage: f.Usage, EnvVar: f.EnvVar}
+			if f.Value != nil {
+				flag.StringSlice = f.Value.Value()
+			}
+			flags = append(flags, flag)
+		case cli.IntFlag:
+			flags = append(flags, Flag{Kind: "int", Name: f.Name, Usage: f.Usage, EnvVar: f.EnvVar, Int: f.Value})
+		case cli.BoolFlag:
+			flags = append(flags, Flag{Kind: "bool", Name: f.Name, Usage: f.Usage, EnvVar: f.EnvVar})
+		default:
+			return nil, fmt.Errorf("unsupported flag type %T for %s", f, f)
+		}
+	}
+	return flags, nil
+}
+
+// toCLIFlags converts the flags of a plugin back to flags of "create"
+func toCLIFlags(flags []Flag) []cli.Flag {
+	cliFlags := []cli.Flag{}
+	for _, f := range flags {
+		switch f.Kind {
+		case "string":
+			cliFlags = append(cliFlags, cli.StringFlag{Name: f.Name, Usage: f.Usage, EnvVar: f.EnvVar, Value: f.String})
+		case "stringslice":
+			value := cli.StringSlice(f.StringSlice)
+			cliFlags = append(cliFlags, cli.StringSliceFlag{Name: f.Name, Usage: f.Usage, EnvVar: f.EnvVar, Value: &value})
+		case "int":
+			cliFlags = append(cliFlags, cli.IntFlag{Name: f.Name, Usage: f.Usage, EnvVar: f.EnvVar, Value: f.Int})
+		case "bool":
+			cliFlags = append(cliFlags, cli.BoolFlag{Name: f.Name, Usage: f.Usage, EnvVar: f.EnvVar})
+		}
+	}
+	return cliFlags
+}
+
+// readOptions reads the values of flags and of the shared options
+func readOptions(flags []Flag, opts drivers.DriverOptions) Options {
+	options := Options{
+		Strings:      map[string]string{},
+		StringSlices: map[string][]string{},
+		Ints:         map[string]int{},
+		Bools:        map[string]bool{},
+	}
+	for _, f := range append(append([]Flag{}, sharedOptions...), flags...) {
+		switch f.Kind {
+		case "string":
+			options.Strings[f.Name] = opts.String(f.Name)
+		case "stringslice":
+			options.StringSlices[f.Name] = opts.StringSlice(f.Name)
+		case "int":
+			options.Ints[f.Name] = opts.Int(f.Name)
+		case "bool":
+			options.Bools[f.Name] = opts.Bool(f.Name)
+		}
+	}
+	return options
+}
+
+// String implements drivers.DriverOptions in the plugin; options which were
+// not sent have their zero value
+func (o Options) String(key string) string {
+	return o.Strings[key]
+}
+
+func (o Options) StringSlice(key string) []string {
+	return o.StringSlices[key]
+}
+
+func (o Options) Int(key string) int {
+	return o.Ints[key]
+}
+
+func (o Options) Bool(key string) bool {
+	return o.Bools[key]
+}
@@ -0,0 +1,85 @@
+// Package plugin runs drivers out of process. Executables named
+// docker-machine-driver-<name> on the PATH are registered as the driver
+// <name> alongside the built-in drivers. Machine starts the executable of a
+// machine when it is first used and calls its driver over net/rpc on the
+// stdin and stdout of the process; a plugin serves its driver with Serve.
+package plugin
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/machine/drivers"
+)
+
+const (
+	executablePrefix = "docker-machine-driver-"
+
+	// pluginEnvVar is set for plugins so that they refuse to run when they
+	// are started by a user
+	pluginEnvVar   = "DOCKER_MACHINE_PLUGIN"
+	pluginEnvValue = "1"
+)
+
+func init() {
+	for name, path := range Discover(os.Getenv("PATH")) {
+		if err := drivers.Register(name, NewPlugin(name, path).RegisteredDriver()); err != nil {
+			log.Debugf("Ignoring the driver plugin %s: %s", path, err)
+		}
+	}
+}
+
+// Discover returns the paths of the plugins in the directories of path by
+// driver name. As for commands, the first directory wins.
+func Discover(path string) map[string]string {
+	plugins := map[string]string{}
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			dir = "."
+		}
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, f := range files {
+			if f.IsDir() || !strings.HasPrefix(f.Name(), executablePrefix) {
+				continue
+			}
+			name := strings.TrimPrefix(f.Name(), executablePrefix)
+			if runtime.GOOS == "windows" {
+				if !strings.HasSuffix(name, ".exe") {
+					continue
+				}
+				name = strings.TrimSuffix(name, ".exe")
+			} else if f.Mode()&0111 == 0 {
+				continue
+			}
+			if name == "" {
+				continue
+			}
+			if _, exists := plugins[name]; !exists {
+				plugins[name] = filepath.Join(dir, f.Name())
+			}
+		}
+	}
+	return plugins
+}
+
+// stdioConn is the connection to a plugin over its stdin and stdout
+type stdioConn struct {
+	io.ReadCloser
+	io.WriteCloser
+}
+
+func (c stdioConn) Close() error {
+	rerr := c.ReadCloser.Close()
+	if err := c.WriteCloser.Close(); err != nil {
+		return err
+	}
+	return rerr
+}
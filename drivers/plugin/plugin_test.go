@@ -0,0 +1,340 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codegangsta/cli"
+	"github.com/docker/machine/drivers"
+	"github.com/docker/machine/provider"
+	"github.com/docker/machine/state"
+)
+
+// FakeDriver is served by the test binary when it runs as a plugin
+type FakeDriver struct {
+	MachineName string
+	Memory      int
+	Region      string
+	IPAddress   string
+	Running     bool
+	storePath   string
+}
+
+var fakeRegisteredDriver = &drivers.RegisteredDriver{
+	New: func(machineName string, storePath string, caCert string, privateKey string) (drivers.Driver, error) {
+		return &FakeDriver{MachineName: machineName, storePath: storePath}, nil
+	},
+	GetCreateFlags: func() []cli.Flag {
+		return []cli.Flag{
+			cli.IntFlag{Name: "fake-memory", Usage: "Memory in MB", Value: 512},
+			cli.StringFlag{Name: "fake-region", Usage: "Region", Value: "north"},
+		}
+	},
+}
+
+func (d *FakeDriver) AuthorizePort(ports []*drivers.Port) error   { return nil }
+func (d *FakeDriver) DeauthorizePort(ports []*drivers.Port) error { return nil }
+func (d *FakeDriver) DriverName() string                          { return "fake" }
+func (d *FakeDriver) GetMachineName() string                      { return d.MachineName }
+func (d *FakeDriver) GetSSHHostname() (string, error)             { return d.GetIP() }
+func (d *FakeDriver) GetSSHKeyPath() string                       { return filepath.Join(d.storePath, "id_rsa") }
+func (d *FakeDriver) GetSSHPort() (int, error)                    { return 22, nil }
+func (d *FakeDriver) GetSSHUsername() string                      { return "docker" }
+func (d *FakeDriver) GetProviderType() provider.ProviderType      { return provider.Remote }
+func (d *FakeDriver) PreCreateCheck() error                       { return nil }
+func (d *FakeDriver) Remove() error                               { return nil }
+func (d *FakeDriver) Restart() error                              { return nil }
+func (d *FakeDriver) Kill() error                                 { return d.Stop() }
+
+func (d *FakeDriver) Create() error {
+	d.IPAddress = "10.0.0.5"
+	return d.Start()
+}
+
+func (d *FakeDriver) GetIP() (string, error) {
+	if !d.Running {
+		return "", drivers.ErrHostIsNotRunning
+	}
+	return d.IPAddress, nil
+}
+
+func (d *FakeDriver) GetURL() (string, error) {
+	ip, err := d.GetIP()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("tcp://%s:2376", ip), nil
+}
+
+func (d *FakeDriver) GetState() (state.State, error) {
+	if d.Running {
+		return state.Running, nil
+	}
+	return state.Stopped, nil
+}
+
+func (d *FakeDriver) SetConfigFromFlags(flags drivers.DriverOptions) error {
+	d.Memory = flags.Int("fake-memory")
+	d.Region = flags.String("fake-region")
+	if d.Region == "" {
+		return fmt.Errorf("fake driver requires the --fake-region option")
+	}
+	return nil
+}
+
+func (d *FakeDriver) Start() error {
+	d.Running = true
+	return nil
+}
+
+func (d *FakeDriver) Stop() error {
+	d.Running = false
+	return nil
+}
+
+// TestHelperProcess is not a test: it serves the fake driver when the test
+// binary is run as a plugin
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+	Serve(fakeRegisteredDriver)
+	os.Exit(0)
+}
+
+// testPlugin writes an executable running the test binary as a plugin
+func testPlugin(t *testing.T) (*Plugin, func()) {
+	dir, err := ioutil.TempDir("", "machine-plugin-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, executablePrefix+"fake")
+	script := fmt.Sprintf("#!/bin/sh\nGO_WANT_HELPER_PROCESS=1 exec %s -test.run=TestHelperProcess\n", os.Args[0])
+	if err := ioutil.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return NewPlugin("fake", path), func() { os.RemoveAll(dir) }
+}
+
+func TestPluginFlagsTimeout(t *testing.T) {
+	saved := flagsTimeout
+	flagsTimeout = 100 * time.Millisecond
+	defer func() { flagsTimeout = saved }()
+
+	dir, err := ioutil.TempDir("", "machine-plugin-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, executablePrefix+"hung")
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\nexec sleep 60\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if flags := NewPlugin("hung", path).GetCreateFlags(); len(flags) != 0 {
+		t.Fatalf("expected no flags; received %v", flags)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("expected the plugin to be killed after the timeout; took %s", elapsed)
+	}
+}
+
+func testOptions() Options {
+	return Options{
+		Strings:      map[string]string{"fake-region": "south"},
+		StringSlices: map[string][]string{},
+		Ints:         map[string]int{"fake-memory": 2048},
+		Bools:        map[string]bool{},
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	first, err := ioutil.TempDir("", "machine-plugin-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(first)
+	second, err := ioutil.TempDir("", "machine-plugin-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(second)
+
+	for path, mode := range map[string]os.FileMode{
+		filepath.Join(first, "docker-machine-driver-cloud"):   0755,
+		filepath.Join(second, "docker-machine-driver-cloud"):  0755,
+		filepath.Join(second, "docker-machine-driver-other"):  0755,
+		filepath.Join(second, "docker-machine-driver-noexec"): 0644,
+		filepath.Join(second, "docker-machine-driver-"):       0755,
+		filepath.Join(second, "docker-machine"):               0755,
+	} {
+		if err := ioutil.WriteFile(path, []byte{}, mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(first, "docker-machine-driver-dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	plugins := Discover(strings.Join([]string{first, filepath.Join(first, "missing"), second}, string(os.PathListSeparator)))
+	expected := map[string]string{
+		"cloud": filepath.Join(first, "docker-machine-driver-cloud"),
+		"other": filepath.Join(second, "docker-machine-driver-other"),
+	}
+	if len(plugins) != len(expected) {
+		t.Fatalf("expected %v; received %v", expected, plugins)
+	}
+	for name, path := range expected {
+		if plugins[name] != path {
+			t.Fatalf("expected %s for %s; received %s", path, name, plugins[name])
+		}
+	}
+}
+
+func TestFlags(t *testing.T) {
+	value := cli.StringSlice{"a", "b"}
+	cliFlags := []cli.Flag{
+		cli.StringFlag{Name: "s", Usage: "string", EnvVar: "S", Value: "v"},
+		cli.StringSliceFlag{Name: "ss", Usage: "slice", Value: &value},
+		cli.IntFlag{Name: "i", Usage: "int", Value: 3},
+		cli.BoolFlag{Name: "b", Usage: "bool"},
+	}
+	flags, err := toFlags(cliFlags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	converted := toCLIFlags(flags)
+	if len(converted) != len(cliFlags) {
+		t.Fatalf("expected %d flags; received %d", len(cliFlags), len(converted))
+	}
+	for i := range cliFlags {
+		if converted[i].String() != cliFlags[i].String() {
+			t.Fatalf("expected %q; received %q", cliFlags[i].String(), converted[i].String())
+		}
+	}
+
+	if _, err := toFlags([]cli.Flag{cli.DurationFlag{Name: "d", Value: time.Second}}); err == nil {
+		t.Fatal("expected an error for an unsupported flag")
+	}
+}
+
+func TestPluginDriver(t *testing.T) {
+	p, cleanup := testPlugin(t)
+	defer cleanup()
+
+	names := []string{}
+	for _, f := range p.GetCreateFlags() {
+		names = append(names, f.String())
+	}
+	sort.Strings(names)
+	if len(names) != 2 || !strings.HasPrefix(names[0], "--fake-memory") || !strings.HasPrefix(names[1], "--fake-region") {
+		t.Fatalf("unexpected flags %q", names)
+	}
+
+	d, err := p.NewDriver("test", "/machines/test", "ca.pem", "key.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver := d.(*Driver)
+	defer driver.Close()
+
+	if driver.DriverName() != "fake" {
+		t.Fatalf("expected the name of the plugin; received %s", driver.DriverName())
+	}
+	if err := driver.SetConfigFromFlags(testOptions()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := driver.GetIP(); err != drivers.ErrHostIsNotRunning {
+		t.Fatalf("expected %v; received %v", drivers.ErrHostIsNotRunning, err)
+	}
+	if err := driver.Create(); err != nil {
+		t.Fatal(err)
+	}
+	url, err := driver.GetURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url != "tcp://10.0.0.5:2376" {
+		t.Fatalf("expected tcp://10.0.0.5:2376; received %s", url)
+	}
+	if path := driver.GetSSHKeyPath(); path != "/machines/test/id_rsa" {
+		t.Fatalf("expected /machines/test/id_rsa; received %s", path)
+	}
+	if driver.GetProviderType() != provider.Remote {
+		t.Fatalf("expected %s; received %s", provider.Remote, driver.GetProviderType())
+	}
+
+	if err := driver.SetConfigFromFlags(Options{}); err == nil || !strings.Contains(err.Error(), "--fake-region") {
+		t.Fatalf("expected the error of the driver; received %v", err)
+	}
+}
+
+func TestPluginDriverConfig(t *testing.T) {
+	p, cleanup := testPlugin(t)
+	defer cleanup()
+
+	// config.json holds the configuration of the served driver
+	host := struct {
+		DriverName string
+		Driver     drivers.Driver
+	}{DriverName: "fake"}
+	host.Driver, _ = p.NewDriver("test", "/machines/test", "ca.pem", "key.pem")
+	defer host.Driver.(*Driver).Close()
+	if err := host.Driver.SetConfigFromFlags(testOptions()); err != nil {
+		t.Fatal(err)
+	}
+	if err := host.Driver.Create(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(host)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved := struct{ Driver FakeDriver }{}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	expected := FakeDriver{MachineName: "test", Memory: 2048, Region: "south", IPAddress: "10.0.0.5", Running: true}
+	if saved.Driver != expected {
+		t.Fatalf("expected %+v; received %+v", expected, saved.Driver)
+	}
+
+	// loading the configuration does not start the plugin
+	loaded := host
+	loaded.Driver, _ = p.NewDriver("test", "/machines/test", "ca.pem", "key.pem")
+	driver := loaded.Driver.(*Driver)
+	defer driver.Close()
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		t.Fatal(err)
+	}
+	if driver.client != nil {
+		t.Fatal("expected the plugin not to be started")
+	}
+	s, err := driver.GetState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != state.Running {
+		t.Fatalf("expected %s; received %s", state.Running, s)
+	}
+}
+
+func TestServerWithoutDriver(t *testing.T) {
+	s := &Server{registered: fakeRegisteredDriver}
+	var ip string
+	if err := s.GetIP(Empty{}, &ip); err == nil {
+		t.Fatal("expected an error before the driver is created")
+	}
+	if err := s.Create(Empty{}, &Empty{}); err == nil {
+		t.Fatal("expected an error before the driver is created")
+	}
+}
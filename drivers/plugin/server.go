@@ -0,0 +1,227 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/rpc"
+	"os"
+
+	"github.com/docker/machine/drivers"
+	"github.com/docker/machine/provider"
+	"github.com/docker/machine/state"
+)
+
+// NewArgs are the arguments of RegisteredDriver.New
+type NewArgs struct {
+	MachineName string
+	StorePath   string
+	CaCert      string
+	PrivateKey  string
+}
+
+// Empty is the argument or reply of the calls which have none
+type Empty struct{}
+
+// Server serves a driver to Machine. Machine starts one plugin process per
+// machine, so a server holds a single driver.
+type Server struct {
+	registered *drivers.RegisteredDriver
+	driver     drivers.Driver
+}
+
+// Serve serves the driver over stdin and stdout until Machine closes them.
+// It is called from the main function of a plugin:
+//
+//	func main() {
+//		plugin.Serve(&drivers.RegisteredDriver{
+//			New:            NewDriver,
+//			GetCreateFlags: GetCreateFlags,
+//		})
+//	}
+//
+// Logs must be written to stderr, which Machine passes through.
+func Serve(registered *drivers.RegisteredDriver) {
+	if os.Getenv(pluginEnvVar) != pluginEnvValue {
+		fmt.Fprintf(os.Stderr, "This is a Docker Machine driver plugin; it is run by docker-machine, which finds it on the PATH.\n")
+		os.Exit(1)
+	}
+	if err := ServeConn(registered, stdioConn{os.Stdin, os.Stdout}); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+}
+
+// ServeConn serves the driver over conn until it is closed
+func ServeConn(registered *drivers.RegisteredDriver, conn io.ReadWriteCloser) error {
+	server := rpc.NewServer()
+	if err := server.RegisterName("Driver", &Server{registered: registered}); err != nil {
+		return err
+	}
+	server.ServeConn(conn)
+	return nil
+}
+
+func (s *Server) GetCreateFlags(_ Empty, reply *[]Flag) error {
+	flags, err := toFlags(s.registered.GetCreateFlags())
+	if err != nil {
+		return err
+	}
+	*reply = flags
+	return nil
+}
+
+func (s *Server) New(args NewArgs, _ *Empty) error {
+	driver, err := s.registered.New(args.MachineName, args.StorePath, args.CaCert, args.PrivateKey)
+	if err != nil {
+		return err
+	}
+	s.driver = driver
+	return nil
+}
+
+// GetConfigRaw returns the configuration of the driver which is saved in
+// the config.json of the machine
+func (s *Server) GetConfigRaw(_ Empty, reply *[]byte) error {
+	if err := s.checkDriver(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(s.driver)
+	if err != nil {
+		return err
+	}
+	*reply = data
+	return nil
+}
+
+// SetConfigRaw loads the configuration saved in the config.json of the
+// machine
+func (s *Server) SetConfigRaw(data []byte, _ *Empty) error {
+	if err := s.checkDriver(); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, s.driver)
+}
+
+func (s *Server) SetConfigFromFlags(options Options, _ *Empty) error {
+	if err := s.checkDriver(); err != nil {
+		return err
+	}
+	return s.driver.SetConfigFromFlags(options)
+}
+
+func (s *Server) AuthorizePort(ports []*drivers.Port, _ *Empty) error {
+	if err := s.checkDriver(); err != nil {
+		return err
+	}
+	return s.driver.AuthorizePort(ports)
+}
+
+func (s *Server) DeauthorizePort(ports []*drivers.Port, _ *Empty) error {
+	if err := s.checkDriver(); err != nil {
+		return err
+	}
+	return s.driver.DeauthorizePort(ports)
+}
+
+func (s *Server) GetIP(_ Empty, reply *string) error {
+	return s.stringCall(drivers.Driver.GetIP, reply)
+}
+
+func (s *Server) GetMachineName(_ Empty, reply *string) error {
+	return s.stringCall(func(d drivers.Driver) (string, error) { return d.GetMachineName(), nil }, reply)
+}
+
+func (s *Server) GetSSHHostname(_ Empty, reply *string) error {
+	return s.stringCall(drivers.Driver.GetSSHHostname, reply)
+}
+
+func (s *Server) GetSSHKeyPath(_ Empty, reply *string) error {
+	return s.stringCall(func(d drivers.Driver) (string, error) { return d.GetSSHKeyPath(), nil }, reply)
+}
+
+func (s *Server) GetSSHPort(_ Empty, reply *int) error {
+	if err := s.checkDriver(); err != nil {
+		return err
+	}
+	port, err := s.driver.GetSSHPort()
+	*reply = port
+	return err
+}
+
+func (s *Server) GetSSHUsername(_ Empty, reply *string) error {
+	return s.stringCall(func(d drivers.Driver) (string, error) { return d.GetSSHUsername(), nil }, reply)
+}
+
+func (s *Server) GetURL(_ Empty, reply *string) error {
+	return s.stringCall(drivers.Driver.GetURL, reply)
+}
+
+func (s *Server) GetState(_ Empty, reply *state.State) error {
+	if err := s.checkDriver(); err != nil {
+		return err
+	}
+	st, err := s.driver.GetState()
+	*reply = st
+	return err
+}
+
+func (s *Server) GetProviderType(_ Empty, reply *provider.ProviderType) error {
+	if err := s.checkDriver(); err != nil {
+		return err
+	}
+	*reply = s.driver.GetProviderType()
+	return nil
+}
+
+func (s *Server) Create(_ Empty, _ *Empty) error {
+	return s.call(drivers.Driver.Create)
+}
+
+func (s *Server) Kill(_ Empty, _ *Empty) error {
+	return s.call(drivers.Driver.Kill)
+}
+
+func (s *Server) PreCreateCheck(_ Empty, _ *Empty) error {
+	return s.call(drivers.Driver.PreCreateCheck)
+}
+
+func (s *Server) Remove(_ Empty, _ *Empty) error {
+	return s.call(drivers.Driver.Remove)
+}
+
+func (s *Server) Restart(_ Empty, _ *Empty) error {
+	return s.call(drivers.Driver.Restart)
+}
+
+func (s *Server) Start(_ Empty, _ *Empty) error {
+	return s.call(drivers.Driver.Start)
+}
+
+func (s *Server) Stop(_ Empty, _ *Empty) error {
+	return s.call(drivers.Driver.Stop)
+}
+
+func (s *Server) checkDriver() error {
+	if s.driver == nil {
+		return fmt.Errorf("the driver of the plugin has not been created")
+	}
+	return nil
+}
+
+// call and stringCall call a method of the driver once it was created
+func (s *Server) call(f func(drivers.Driver) error) error {
+	if err := s.checkDriver(); err != nil {
+		return err
+	}
+	return f(s.driver)
+}
+
+func (s *Server) stringCall(f func(drivers.Driver) (string, error), reply *string) error {
+	if err := s.checkDriver(); err != nil {
+		return err
+	}
+	value, err := f(s.driver)
+	*reply = value
+	return err
+}
@@ -135,8 +135,8 @@ func getHostOnlyNetwork(hostIP net.IP, netmask net.IPMask) (*hostOnlyNetwork, er
 	return nil, nil
 }
 
-func getOrCreateHostOnlyNetwork(hostIP net.IP, netmask net.IPMask, dhcpIP net.IP, dhcpUpperIP net.IP, dhcpLowerIP net.IP) (*hostOnlyNetwork, error) {
-	hostOnlyNet, err := getHostOnlyNetwork(hostIP, netmask)
+func getOrCreateHostOnlyNetwork(host *net.IPNet, dhcp dhcpServer) (*hostOnlyNetwork, error) {
+	hostOnlyNet, err := getHostOnlyNetwork(host.IP, host.Mask)
 	if err != nil || hostOnlyNet != nil {
 		return hostOnlyNet, err
 	}
@@ -145,18 +145,12 @@ func getOrCreateHostOnlyNetwork(hostIP net.IP, netmask net.IPMask, dhcpIP net.IP
 	if err != nil {
 		return nil, err
 	}
-	hostOnlyNet.IPv4.IP = hostIP
-	hostOnlyNet.IPv4.Mask = netmask
+	hostOnlyNet.IPv4.IP = host.IP
+	hostOnlyNet.IPv4.Mask = host.Mask
 	if err := hostOnlyNet.Save(); err != nil {
 		return nil, err
 	}
 
-	dhcp := dhcpServer{}
-	dhcp.IPv4.IP = dhcpIP
-	dhcp.IPv4.Mask = netmask
-	dhcp.LowerIP = dhcpUpperIP
-	dhcp.UpperIP = dhcpLowerIP
-	dhcp.Enabled = true
 	if err := addHostonlyDHCP(hostOnlyNet.Name, dhcp); err != nil {
 		return nil, err
 	}
@@ -164,6 +158,135 @@ func getOrCreateHostOnlyNetwork(hostIP net.IP, netmask net.IPMask, dhcpIP net.IP
 	return hostOnlyNet, nil
 }
 
+// parseHostOnlyCIDR parses the host IP and prefix of a host-only network,
+// e.g. 192.168.99.1/24, and returns the DHCP server for it. As with the
+// default network, the DHCP server takes the address after the host and
+// leases addresses from 100/256 of the network up to the last address.
+func parseHostOnlyCIDR(cidr string) (*net.IPNet, *dhcpServer, error) {
+	ip, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid host-only CIDR %q: %s", cidr, err)
+	}
+	ip = ip.To4()
+	if ip == nil {
+		return nil, nil, fmt.Errorf("invalid host-only CIDR %q: only IPv4 networks are supported", cidr)
+	}
+	ones, bits := network.Mask.Size()
+	if ones > 29 {
+		return nil, nil, fmt.Errorf("invalid host-only CIDR %q: the network must have at least 8 addresses", cidr)
+	}
+
+	size := uint32(1) << uint(bits-ones)
+	base := ipToUint32(network.IP.To4())
+	hostOffset := ipToUint32(ip) - base
+	if hostOffset == 0 || hostOffset == size-1 {
+		return nil, nil, fmt.Errorf("invalid host-only CIDR %q: the host IP can not be the network or broadcast address", cidr)
+	}
+
+	lowerOffset := size / 256 * 100
+	if size < 256 {
+		lowerOffset = size * 100 / 256
+	}
+	if lowerOffset <= hostOffset+1 {
+		lowerOffset = hostOffset + 2
+	}
+	upperOffset := size - 2
+	if hostOffset+1 > upperOffset || lowerOffset > upperOffset {
+		return nil, nil, fmt.Errorf("invalid host-only CIDR %q: no addresses left for DHCP after the host IP", cidr)
+	}
+
+	dhcp := &dhcpServer{
+		IPv4:    net.IPNet{IP: uint32ToIP(base + hostOffset + 1), Mask: network.Mask},
+		LowerIP: uint32ToIP(base + lowerOffset),
+		UpperIP: uint32ToIP(base + upperOffset),
+		Enabled: true,
+	}
+	return &net.IPNet{IP: ip, Mask: network.Mask}, dhcp, nil
+}
+
+// staticIPRange returns the addresses of the host-only network which can be
+// assigned statically: those below the DHCP range other than the host's and
+// the DHCP server's
+func staticIPRange(host *net.IPNet, dhcp *dhcpServer) (uint32, uint32) {
+	return ipToUint32(host.IP.Mask(host.Mask)) + 1, ipToUint32(dhcp.LowerIP) - 1
+}
+
+// checkStaticIP returns an error if ip can not be assigned statically in the
+// host-only network
+func checkStaticIP(cidr string, ip string) error {
+	host, dhcp, err := parseHostOnlyCIDR(cidr)
+	if err != nil {
+		return err
+	}
+	first, last := staticIPRange(host, dhcp)
+	parsed := net.ParseIP(ip).To4()
+	if parsed == nil {
+		return fmt.Errorf("invalid static IP %q", ip)
+	}
+	n := ipToUint32(parsed)
+	if n < first || n > last || parsed.Equal(host.IP) || parsed.Equal(dhcp.IPv4.IP) {
+		return fmt.Errorf("the static IP %s must be an unused address of %s between %s and %s, below the DHCP range", ip, cidr, uint32ToIP(first), uint32ToIP(last))
+	}
+	return nil
+}
+
+// reserveStaticIP returns the first address of the host-only network which
+// can be assigned statically and is not in use
+func reserveStaticIP(cidr string, used map[string]bool) (string, error) {
+	host, dhcp, err := parseHostOnlyCIDR(cidr)
+	if err != nil {
+		return "", err
+	}
+	first, last := staticIPRange(host, dhcp)
+	for n := first; n <= last; n++ {
+		ip := uint32ToIP(n)
+		if ip.Equal(host.IP) || ip.Equal(dhcp.IPv4.IP) || used[ip.String()] {
+			continue
+		}
+		return ip.String(), nil
+	}
+	return "", fmt.Errorf("no static IP left in %s", cidr)
+}
+
+// checkHostOnlyCollision returns an error if an address of another host
+// interface, e.g. a VPN, lies in the host-only network
+func checkHostOnlyCollision(host *net.IPNet) error {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return err
+	}
+	if addr := findCollision(host, addrs); addr != nil {
+		return fmt.Errorf("the host-only network %s collides with the host address %s; choose another network with --virtualbox-hostonly-cidr", host, addr)
+	}
+	return nil
+}
+
+// findCollision returns the first address other than the host-only
+// interface's own which lies in the host-only network or whose network
+// contains it
+func findCollision(host *net.IPNet, addrs []net.Addr) net.Addr {
+	network := &net.IPNet{IP: host.IP.Mask(host.Mask), Mask: host.Mask}
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.To4() == nil || ipNet.IP.Equal(host.IP) {
+			continue
+		}
+		if network.Contains(ipNet.IP) || ipNet.Contains(network.IP) {
+			return addr
+		}
+	}
+	return nil
+}
+
+func ipToUint32(ip net.IP) uint32 {
+	ip = ip.To4()
+	return uint32(ip[0])<<24 | uint32(ip[1])<<16 | uint32(ip[2])<<8 | uint32(ip[3])
+}
+
+func uint32ToIP(n uint32) net.IP {
+	return net.IPv4(byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
 // DHCP server info.
 type dhcpServer struct {
 	NetworkName string
@@ -1 +1,97 @@
 package virtualbox
+
+import (
+	"net"
+	"testing"
+)
+
+func TestParseHostOnlyCIDR(t *testing.T) {
+	tests := []struct {
+		cidr, host, dhcp, lower, upper string
+	}{
+		{"192.168.99.1/24", "192.168.99.1", "192.168.99.2", "192.168.99.100", "192.168.99.254"},
+		{"10.10.0.1/16", "10.10.0.1", "10.10.0.2", "10.10.100.0", "10.10.255.254"},
+		{"172.16.5.200/24", "172.16.5.200", "172.16.5.201", "172.16.5.202", "172.16.5.254"},
+		{"192.168.50.1/28", "192.168.50.1", "192.168.50.2", "192.168.50.6", "192.168.50.14"},
+	}
+	for _, test := range tests {
+		host, dhcp, err := parseHostOnlyCIDR(test.cidr)
+		if err != nil {
+			t.Fatalf("%s: %s", test.cidr, err)
+		}
+		if host.IP.String() != test.host || dhcp.IPv4.IP.String() != test.dhcp ||
+			dhcp.LowerIP.String() != test.lower || dhcp.UpperIP.String() != test.upper {
+			t.Fatalf("%s: unexpected host %s, DHCP server %s, range %s-%s", test.cidr, host.IP, dhcp.IPv4.IP, dhcp.LowerIP, dhcp.UpperIP)
+		}
+		if host.Mask.String() != dhcp.IPv4.Mask.String() {
+			t.Fatalf("%s: the DHCP server has mask %s", test.cidr, dhcp.IPv4.Mask)
+		}
+	}
+
+	for _, cidr := range []string{"192.168.99.1", "192.168.99.0/24", "192.168.99.255/24", "192.168.99.1/30", "fd00::1/64", "192.168.99.253/24"} {
+		if _, _, err := parseHostOnlyCIDR(cidr); err == nil {
+			t.Fatalf("expected error parsing %s", cidr)
+		}
+	}
+}
+
+func TestFindCollision(t *testing.T) {
+	host, _, err := parseHostOnlyCIDR("192.168.99.1/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parse := func(cidrs ...string) []net.Addr {
+		addrs := []net.Addr{}
+		for _, cidr := range cidrs {
+			ip, network, err := net.ParseCIDR(cidr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			addrs = append(addrs, &net.IPNet{IP: ip, Mask: network.Mask})
+		}
+		return addrs
+	}
+
+	if addr := findCollision(host, parse("127.0.0.1/8", "192.168.99.1/24", "10.0.2.15/24", "fe80::1/64")); addr != nil {
+		t.Fatalf("unexpected collision with %s", addr)
+	}
+	if addr := findCollision(host, parse("127.0.0.1/8", "192.168.99.20/24")); addr == nil || addr.String() != "192.168.99.20/24" {
+		t.Fatalf("expected collision with 192.168.99.20/24; received %v", addr)
+	}
+	if addr := findCollision(host, parse("192.168.0.5/16")); addr == nil {
+		t.Fatal("expected collision with a network containing the host-only network")
+	}
+}
+
+func TestCheckStaticIP(t *testing.T) {
+	for _, ip := range []string{"192.168.99.3", "192.168.99.50", "192.168.99.99"} {
+		if err := checkStaticIP("192.168.99.1/24", ip); err != nil {
+			t.Fatalf("%s: %s", ip, err)
+		}
+	}
+	for _, ip := range []string{"192.168.99.1", "192.168.99.2", "192.168.99.100", "192.168.98.50", "invalid"} {
+		if err := checkStaticIP("192.168.99.1/24", ip); err == nil {
+			t.Fatalf("expected error for static IP %s", ip)
+		}
+	}
+}
+
+func TestReserveStaticIP(t *testing.T) {
+	ip, err := reserveStaticIP("192.168.99.1/24", map[string]bool{"192.168.99.3": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip != "192.168.99.4" {
+		t.Fatalf("expected static IP 192.168.99.4; received %s", ip)
+	}
+
+	// with the host in the middle of the network the addresses below it are used
+	ip, err = reserveStaticIP("10.0.0.200/24", map[string]bool{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip != "10.0.0.1" {
+		t.Fatalf("expected static IP 10.0.0.1; received %s", ip)
+	}
+}
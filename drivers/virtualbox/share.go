@@ -0,0 +1,143 @@
+package virtualbox
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/docker/machine/drivers"
+)
+
+var reWindowsDrive = regexp.MustCompile(`^([a-zA-Z]):[/\\]*`)
+
+// msysPath translates a Windows path to the form used by MSYS, e.g.
+// C:\Users\docker to /c/Users/docker, which is how the Docker client passes
+// host paths from the boot2docker shell
+func msysPath(path string) string {
+	if m := reWindowsDrive.FindStringSubmatch(path); m != nil {
+		path = "/" + strings.ToLower(m[1]) + "/" + path[len(m[0]):]
+	}
+	return strings.TrimRight(strings.Replace(path, `\`, "/", -1), "/")
+}
+
+// shareName returns the name of the share for a path in the guest; parts of
+// the VBox internal code are buggy with share names that start with "/"
+func shareName(path string) string {
+	return strings.Trim(msysPath(path), "/")
+}
+
+// ParseShare parses a share given as hostpath[:guestpath]. boot2docker
+// mounts a share at /<name>; without a guest path the directory is mounted
+// at its host path, in MSYS form on Windows, so that containers can
+// bind-mount host paths unchanged.
+func ParseShare(value string) (*drivers.Share, error) {
+	hostPath, guestPath := value, ""
+	// the colon after a Windows drive letter does not separate the guest path
+	if i := strings.LastIndex(value, ":"); i != -1 && !(i == 1 && reWindowsDrive.MatchString(value)) {
+		hostPath, guestPath = value[:i], value[i+1:]
+	}
+
+	if hostPath == "" {
+		return nil, fmt.Errorf("invalid share %q: missing host path", value)
+	}
+	if guestPath == "" {
+		guestPath = hostPath
+	}
+
+	name := shareName(guestPath)
+	if name == "" {
+		return nil, fmt.Errorf("invalid share %q: the guest path can not be /", value)
+	}
+
+	return &drivers.Share{HostPath: hostPath, Name: name}, nil
+}
+
+// defaultShares returns the directory with the users' homes on the host,
+// which is shared unless --virtualbox-no-share is given
+func defaultShares() []*drivers.Share {
+	var hostPath string
+	switch runtime.GOOS {
+	case "darwin":
+		hostPath = "/Users"
+	case "linux":
+		hostPath = "/home"
+	case "windows":
+		drive := os.Getenv("SYSTEMDRIVE")
+		if drive == "" {
+			drive = "C:"
+		}
+		hostPath = filepath.Join(drive+`\`, "Users")
+	}
+
+	if hostPath == "" {
+		return nil
+	}
+	if _, err := os.Stat(hostPath); err != nil {
+		return nil
+	}
+	return []*drivers.Share{{HostPath: hostPath, Name: shareName(hostPath)}}
+}
+
+func (d *Driver) addShare(share *drivers.Share) error {
+	if fi, err := os.Stat(share.HostPath); err != nil {
+		return err
+	} else if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", share.HostPath)
+	}
+
+	if err := vbm("sharedfolder", "add", d.MachineName, "--name", share.Name, "--hostpath", share.HostPath, "--automount"); err != nil {
+		return err
+	}
+
+	// enable symlinks
+	return vbm("setextradata", d.MachineName, "VBoxInternal2/SharedFoldersEnableSymlinksCreate/"+share.Name, "1")
+}
+
+// AddShare shares a host directory with the VM, which must be stopped
+func (d *Driver) AddShare(hostPath string, guestPath string) error {
+	value := hostPath
+	if guestPath != "" {
+		value += ":" + guestPath
+	}
+	share, err := ParseShare(value)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range d.Shares {
+		if s.Name == share.Name {
+			return fmt.Errorf("%s is already shared as %s", s.HostPath, s.Name)
+		}
+	}
+
+	if err := d.addShare(share); err != nil {
+		return err
+	}
+	d.Shares = append(d.Shares, share)
+	return nil
+}
+
+// RemoveShare stops sharing a directory with the VM, which must be stopped.
+// The share is given by its guest path or host path.
+func (d *Driver) RemoveShare(path string) error {
+	for i, s := range d.Shares {
+		if s.Name != shareName(path) && s.HostPath != path {
+			continue
+		}
+
+		if err := vbm("sharedfolder", "remove", d.MachineName, "--name", s.Name); err != nil {
+			return err
+		}
+		d.Shares = append(d.Shares[:i], d.Shares[i+1:]...)
+		return nil
+	}
+	return fmt.Errorf("%s is not shared with %s", path, d.MachineName)
+}
+
+// ListShares returns the directories shared with the VM
+func (d *Driver) ListShares() []*drivers.Share {
+	return d.Shares
+}
@@ -0,0 +1,44 @@
+package virtualbox
+
+import (
+	"testing"
+)
+
+func TestMsysPath(t *testing.T) {
+	expected := map[string]string{
+		`C:\Users\docker`:   "/c/Users/docker",
+		`d:\src\`:           "/d/src",
+		`C:/Users`:          "/c/Users",
+		"/home/docker/src/": "/home/docker/src",
+	}
+	for path, msys := range expected {
+		if p := msysPath(path); p != msys {
+			t.Fatalf("%s: expected %s; received %s", path, msys, p)
+		}
+	}
+}
+
+func TestParseShare(t *testing.T) {
+	expected := map[string][2]string{
+		"/home":                    {"/home", "home"},
+		"/home/docker/src:/src":    {"/home/docker/src", "src"},
+		"/Users:Users":             {"/Users", "Users"},
+		`C:\Users`:                 {`C:\Users`, "c/Users"},
+		`C:\Users\docker\src:/app`: {`C:\Users\docker\src`, "app"},
+	}
+	for value, share := range expected {
+		s, err := ParseShare(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.HostPath != share[0] || s.Name != share[1] {
+			t.Fatalf("%s: expected %v; received %+v", value, share, s)
+		}
+	}
+
+	for _, value := range []string{"", ":/src", "/home:/"} {
+		if _, err := ParseShare(value); err == nil {
+			t.Fatalf("expected error for %q", value)
+		}
+	}
+}
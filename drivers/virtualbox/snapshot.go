@@ -0,0 +1,107 @@
+package virtualbox
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/docker/machine/drivers"
+)
+
+// CreateSnapshot takes a snapshot of the VM, which may be running
+func (d *Driver) CreateSnapshot(name string) error {
+	snapshots, err := d.ListSnapshots()
+	if err != nil {
+		return err
+	}
+	for _, s := range snapshots {
+		if s.Name == name {
+			return fmt.Errorf("snapshot %s of %s already exists", name, d.MachineName)
+		}
+	}
+
+	return vbm("snapshot", d.MachineName, "take", name)
+}
+
+// ListSnapshots returns the snapshots of the VM, oldest first
+func (d *Driver) ListSnapshots() ([]*drivers.Snapshot, error) {
+	stdout, stderr, err := vbmOutErr("snapshot", d.MachineName, "list", "--machinereadable")
+	if err != nil {
+		if strings.Contains(stdout+stderr, "does not have any snapshots") {
+			return []*drivers.Snapshot{}, nil
+		}
+		return nil, err
+	}
+	return parseSnapshots(stdout), nil
+}
+
+// RestoreSnapshot restores the VM to a snapshot; the VM must not be running
+func (d *Driver) RestoreSnapshot(name string) error {
+	if err := d.checkSnapshot(name); err != nil {
+		return err
+	}
+	return vbm("snapshot", d.MachineName, "restore", name)
+}
+
+// RemoveSnapshot deletes a snapshot, merging its changes into its children
+func (d *Driver) RemoveSnapshot(name string) error {
+	if err := d.checkSnapshot(name); err != nil {
+		return err
+	}
+	return vbm("snapshot", d.MachineName, "delete", name)
+}
+
+func (d *Driver) checkSnapshot(name string) error {
+	snapshots, err := d.ListSnapshots()
+	if err != nil {
+		return err
+	}
+	for _, s := range snapshots {
+		if s.Name == name {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s has no snapshot %s", d.MachineName, name)
+}
+
+// parseSnapshots parses the output of snapshot list --machinereadable, in
+// which the snapshot tree is flattened into keys such as SnapshotName-1-1
+func parseSnapshots(out string) []*drivers.Snapshot {
+	snapshots := []*drivers.Snapshot{}
+	byKey := map[string]*drivers.Snapshot{}
+	current := ""
+
+	s := bufio.NewScanner(strings.NewReader(out))
+	for s.Scan() {
+		res := reVMInfoLine.FindStringSubmatch(s.Text())
+		if res == nil {
+			continue
+		}
+		key := res[1]
+		if key == "" {
+			key = res[2]
+		}
+		val := res[3]
+		if val == "" {
+			val = res[4]
+		}
+
+		switch {
+		case key == "CurrentSnapshotNode":
+			current = val
+		case strings.HasPrefix(key, "SnapshotName"):
+			snapshot := &drivers.Snapshot{Name: val}
+			byKey[key] = snapshot
+			snapshots = append(snapshots, snapshot)
+		case strings.HasPrefix(key, "SnapshotUUID"):
+			if snapshot, ok := byKey["SnapshotName"+strings.TrimPrefix(key, "SnapshotUUID")]; ok {
+				snapshot.ID = val
+			}
+		}
+	}
+
+	if snapshot, ok := byKey[current]; ok {
+		snapshot.Current = true
+	}
+	return snapshots
+}
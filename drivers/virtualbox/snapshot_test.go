@@ -0,0 +1,40 @@
+package virtualbox
+
+import (
+	"testing"
+
+	"github.com/docker/machine/drivers"
+)
+
+const testSnapshotList = `SnapshotName="clean"
+SnapshotUUID="4b6c3c8e-5d1a-4c36-9a8e-1d7a6b8f2c01"
+SnapshotName-1="images"
+SnapshotUUID-1="9f1e2d3c-4b5a-6978-8a9b-0c1d2e3f4a5b"
+SnapshotName-1-1="release"
+SnapshotUUID-1-1="0a1b2c3d-4e5f-6071-8293-a4b5c6d7e8f9"
+CurrentSnapshotName="images"
+CurrentSnapshotUUID="9f1e2d3c-4b5a-6978-8a9b-0c1d2e3f4a5b"
+CurrentSnapshotNode="SnapshotName-1"
+`
+
+func TestParseSnapshots(t *testing.T) {
+	snapshots := parseSnapshots(testSnapshotList)
+	if len(snapshots) != 3 {
+		t.Fatalf("expected 3 snapshots; received %d", len(snapshots))
+	}
+
+	expected := []drivers.Snapshot{
+		{Name: "clean", ID: "4b6c3c8e-5d1a-4c36-9a8e-1d7a6b8f2c01"},
+		{Name: "images", ID: "9f1e2d3c-4b5a-6978-8a9b-0c1d2e3f4a5b", Current: true},
+		{Name: "release", ID: "0a1b2c3d-4e5f-6071-8293-a4b5c6d7e8f9"},
+	}
+	for i, s := range snapshots {
+		if *s != expected[i] {
+			t.Fatalf("expected %+v; received %+v", expected[i], *s)
+		}
+	}
+
+	if len(parseSnapshots("")) != 0 {
+		t.Fatal("expected no snapshots")
+	}
+}
@@ -0,0 +1,126 @@
+package virtualbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/machine/drivers"
+	"github.com/docker/machine/utils"
+)
+
+// bootsyncPath is run by boot2docker at each boot before Docker is started
+const bootsyncPath = "/var/lib/boot2docker/bootsync.sh"
+
+// setStaticIP sets the static IP of the VM from --virtualbox-static-ip,
+// which is an address of the host-only network below the DHCP range or
+// "auto" to reserve the first address not used by another machine
+func (d *Driver) setStaticIP(value string) error {
+	switch value {
+	case "":
+		return nil
+	case "auto":
+		ip, err := reserveStaticIP(d.hostOnlyCIDR(), d.usedStaticIPs())
+		if err != nil {
+			return err
+		}
+		d.IPAddress = ip
+		return nil
+	}
+
+	if err := checkStaticIP(d.hostOnlyCIDR(), value); err != nil {
+		return err
+	}
+	if d.usedStaticIPs()[value] {
+		return fmt.Errorf("the static IP %s is used by another machine", value)
+	}
+	d.IPAddress = value
+	return nil
+}
+
+// usedStaticIPs returns the static IPs of the other VirtualBox machines in
+// the store
+func (d *Driver) usedStaticIPs() map[string]bool {
+	used := map[string]bool{}
+
+	machinesDir := filepath.Dir(d.storePath)
+	dirs, err := ioutil.ReadDir(machinesDir)
+	if err != nil {
+		return used
+	}
+	for _, dir := range dirs {
+		if !dir.IsDir() || dir.Name() == d.MachineName {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(machinesDir, dir.Name(), "config.json"))
+		if err != nil {
+			continue
+		}
+		config := struct {
+			DriverName string
+			Driver     struct {
+				IPAddress string
+			}
+		}{}
+		if err := json.Unmarshal(data, &config); err != nil {
+			log.Debugf("Error reading the configuration of %s: %s", dir.Name(), err)
+			continue
+		}
+		if config.DriverName == "virtualbox" && config.Driver.IPAddress != "" {
+			used[config.Driver.IPAddress] = true
+		}
+	}
+	return used
+}
+
+// bootsyncScript returns a bootsync.sh which stops the DHCP client of the
+// host-only adapter and configures the static IP instead
+func bootsyncScript(ip string, cidr string) (string, error) {
+	host, _, err := parseHostOnlyCIDR(cidr)
+	if err != nil {
+		return "", err
+	}
+	network := host.IP.Mask(host.Mask)
+	broadcast := make(net.IP, len(network))
+	for i := range network {
+		broadcast[i] = network[i] | ^host.Mask[i]
+	}
+
+	return fmt.Sprintf(`#!/bin/sh
+# static IP of the host-only adapter, configured by docker-machine
+if [ -f /var/run/udhcpc.eth1.pid ]; then
+	kill $(cat /var/run/udhcpc.eth1.pid)
+	rm -f /var/run/udhcpc.eth1.pid
+fi
+ifconfig eth1 %s netmask %s broadcast %s up
+`, ip, net.IP(host.Mask), broadcast), nil
+}
+
+// configureStaticIP installs the bootsync.sh which configures the static IP
+// at each boot and runs it once for the running VM
+func (d *Driver) configureStaticIP() error {
+	script, err := bootsyncScript(d.IPAddress, d.hostOnlyCIDR())
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Configuring static IP %s...", d.IPAddress)
+	command := fmt.Sprintf("sudo tee %s >/dev/null && sudo chmod +x %s && sudo %s", bootsyncPath, bootsyncPath, bootsyncPath)
+	return utils.WaitFor(func() bool {
+		cmd, err := drivers.GetSSHCommandFromDriver(d, command)
+		if err != nil {
+			log.Debug(err)
+			return false
+		}
+		cmd.Stdin = strings.NewReader(script)
+		if err := cmd.Run(); err != nil {
+			log.Debugf("Error configuring the static IP: %s", err)
+			return false
+		}
+		return true
+	})
+}
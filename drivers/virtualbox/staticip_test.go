@@ -0,0 +1,49 @@
+package virtualbox
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBootsyncScript(t *testing.T) {
+	script, err := bootsyncScript("192.168.99.50", "192.168.99.1/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "ifconfig eth1 192.168.99.50 netmask 255.255.255.0 broadcast 192.168.99.255 up"
+	if !strings.Contains(script, expected) {
+		t.Fatalf("expected script to contain %q; received %s", expected, script)
+	}
+}
+
+func TestUsedStaticIPs(t *testing.T) {
+	machinesDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(machinesDir)
+
+	configs := map[string]string{
+		"dev":     `{"DriverName":"virtualbox","Driver":{"IPAddress":"192.168.99.3"}}`,
+		"dhcp":    `{"DriverName":"virtualbox","Driver":{"IPAddress":""}}`,
+		"cloud":   `{"DriverName":"digitalocean","Driver":{"IPAddress":"192.168.99.4"}}`,
+		"staging": `{"DriverName":"virtualbox","Driver":{"IPAddress":"192.168.99.5"}}`,
+	}
+	for name, config := range configs {
+		if err := os.Mkdir(filepath.Join(machinesDir, name), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(machinesDir, name, "config.json"), []byte(config), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d := &Driver{MachineName: "staging", storePath: filepath.Join(machinesDir, "staging")}
+	used := d.usedStaticIPs()
+	if len(used) != 1 || !used["192.168.99.3"] {
+		t.Fatalf("expected only 192.168.99.3 to be used; received %v", used)
+	}
+}
@@ -26,23 +26,33 @@ import (
 )
 
 const (
-	dockerConfigDir = "/var/lib/boot2docker"
-	isoFilename     = "boot2docker.iso"
+	dockerConfigDir     = "/var/lib/boot2docker"
+	defaultHostOnlyCIDR = "192.168.99.1/24"
+	defaultNicType      = "virtio"
+	isoFilename         = "boot2docker.iso"
+	maxCPUCount         = 32
 )
 
 type Driver struct {
-	MachineName    string
-	SSHUser        string
-	SSHPort        int
-	Memory         int
-	DiskSize       int
-	Boot2DockerURL string
-	CaCertPath     string
-	PrivateKeyPath string
-	SwarmMaster    bool
-	SwarmHost      string
-	SwarmDiscovery string
-	storePath      string
+	MachineName     string
+	SSHUser         string
+	SSHPort         int
+	CPU             int
+	Memory          int
+	DiskSize        int
+	Boot2DockerURL  string
+	CaCertPath      string
+	PrivateKeyPath  string
+	SwarmMaster     bool
+	SwarmHost       string
+	SwarmDiscovery  string
+	Shares          []*drivers.Share
+	HostOnlyCIDR    string
+	HostOnlyNicType string
+	NatNicType      string
+	NoDNSProxy      bool
+	IPAddress       string
+	storePath       string
 }
 
 type CreateFlags struct {
@@ -62,6 +72,11 @@ func init() {
 // "docker hosts create"
 func GetCreateFlags() []cli.Flag {
 	return []cli.Flag{
+		cli.IntFlag{
+			Name:  "virtualbox-cpu-count",
+			Usage: "Number of CPUs for the host. Defaults to the number of host CPUs, up to 32",
+			Value: 0,
+		},
 		cli.IntFlag{
 			Name:  "virtualbox-memory",
 			Usage: "Size of memory for host in MB",
@@ -78,6 +93,39 @@ func GetCreateFlags() []cli.Flag {
 			Usage:  "The URL of the boot2docker image. Defaults to the latest available version",
 			Value:  "",
 		},
+		cli.StringSliceFlag{
+			Name:  "virtualbox-share",
+			Usage: "Share a host directory with the VM as hostpath[:guestpath]; replaces the default share of the users' home directories",
+			Value: &cli.StringSlice{},
+		},
+		cli.BoolFlag{
+			Name:  "virtualbox-no-share",
+			Usage: "Do not share any host directory with the VM",
+		},
+		cli.StringFlag{
+			Name:  "virtualbox-hostonly-cidr",
+			Usage: "The host IP and prefix of the host-only network",
+			Value: defaultHostOnlyCIDR,
+		},
+		cli.StringFlag{
+			Name:  "virtualbox-hostonly-nictype",
+			Usage: "NIC type of the host-only adapter: Am79C970A, Am79C973, 82540EM, 82543GC, 82545EM or virtio",
+			Value: defaultNicType,
+		},
+		cli.StringFlag{
+			Name:  "virtualbox-nat-nictype",
+			Usage: "NIC type of the NAT adapter: Am79C970A, Am79C973, 82540EM, 82543GC, 82545EM or virtio",
+			Value: defaultNicType,
+		},
+		cli.BoolFlag{
+			Name:  "virtualbox-no-dns-proxy",
+			Usage: "Do not resolve DNS requests of the VM through the host",
+		},
+		cli.StringFlag{
+			Name:  "virtualbox-static-ip",
+			Usage: "Static IP of the VM in the host-only network, below the DHCP range, or \"auto\" to reserve one",
+			Value: "",
+		},
 	}
 }
 
@@ -137,6 +185,7 @@ func (d *Driver) GetURL() (string, error) {
 }
 
 func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
+	d.CPU = flags.Int("virtualbox-cpu-count")
 	d.Memory = flags.Int("virtualbox-memory")
 	d.DiskSize = flags.Int("virtualbox-disk-size")
 	d.Boot2DockerURL = flags.String("virtualbox-boot2docker-url")
@@ -145,6 +194,46 @@ func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 	d.SwarmDiscovery = flags.String("swarm-discovery")
 	d.SSHUser = "docker"
 
+	if err := checkCPUCount(d.CPU); err != nil {
+		return err
+	}
+
+	d.HostOnlyCIDR = flags.String("virtualbox-hostonly-cidr")
+	if _, _, err := parseHostOnlyCIDR(d.HostOnlyCIDR); err != nil {
+		return err
+	}
+	d.HostOnlyNicType = flags.String("virtualbox-hostonly-nictype")
+	if err := checkNicType(d.HostOnlyNicType); err != nil {
+		return err
+	}
+	d.NatNicType = flags.String("virtualbox-nat-nictype")
+	if err := checkNicType(d.NatNicType); err != nil {
+		return err
+	}
+	d.NoDNSProxy = flags.Bool("virtualbox-no-dns-proxy")
+	if err := d.setStaticIP(flags.String("virtualbox-static-ip")); err != nil {
+		return err
+	}
+
+	shares := flags.StringSlice("virtualbox-share")
+	if flags.Bool("virtualbox-no-share") {
+		if len(shares) > 0 {
+			return fmt.Errorf("--virtualbox-share and --virtualbox-no-share can not be used together")
+		}
+		d.Shares = []*drivers.Share{}
+	} else if len(shares) > 0 {
+		d.Shares = []*drivers.Share{}
+		for _, value := range shares {
+			share, err := ParseShare(value)
+			if err != nil {
+				return err
+			}
+			d.Shares = append(d.Shares, share)
+		}
+	} else {
+		d.Shares = defaultShares()
+	}
+
 	return nil
 }
 
@@ -171,7 +260,6 @@ func (d *Driver) Create() error {
 	b2dutils := utils.NewB2dUtils("", "")
 	imgPath := utils.GetMachineCacheDir()
 	isoFilename := "boot2docker.iso"
-	commonIsoPath := filepath.Join(imgPath, "boot2docker.iso")
 	// just in case boot2docker.iso has been manually deleted
 	if _, err := os.Stat(imgPath); os.IsNotExist(err) {
 		if err := os.Mkdir(imgPath, 0700); err != nil {
@@ -183,28 +271,19 @@ func (d *Driver) Create() error {
 	if d.Boot2DockerURL != "" {
 		isoURL = d.Boot2DockerURL
 		log.Infof("Downloading %s from %s...", isoFilename, isoURL)
-		if err := b2dutils.DownloadISO(commonIsoPath, isoFilename, isoURL); err != nil {
+		if err := b2dutils.DownloadISO(d.storePath, isoFilename, isoURL); err != nil {
 			return err
 
 		}
 
 	} else {
-		// todo: check latest release URL, download if it's new
-		// until then always use "latest"
-		isoURL, err = b2dutils.GetLatestBoot2DockerReleaseURL()
+		iso, err := utils.NewISOCache(imgPath, b2dutils).Get("latest")
 		if err != nil {
-			log.Warnf("Unable to check for the latest release: %s", err)
-		}
-
-		if _, err := os.Stat(commonIsoPath); os.IsNotExist(err) {
-			log.Infof("Downloading %s to %s...", isoFilename, commonIsoPath)
-			if err := b2dutils.DownloadISO(imgPath, isoFilename, isoURL); err != nil {
-				return err
-			}
+			return err
 		}
 
 		isoDest := filepath.Join(d.storePath, isoFilename)
-		if err := utils.CopyFile(commonIsoPath, isoDest); err != nil {
+		if err := utils.CopyFile(iso.Path, isoDest); err != nil {
 			return err
 		}
 	}
@@ -228,16 +307,24 @@ func (d *Driver) Create() error {
 		return err
 	}
 
-	cpus := uint(runtime.NumCPU())
-	if cpus > 32 {
-		cpus = 32
+	cpus := d.CPU
+	if cpus < 1 {
+		cpus = runtime.NumCPU()
+		if cpus > maxCPUCount {
+			cpus = maxCPUCount
+		}
+	}
+
+	dnsProxy := "on"
+	if d.NoDNSProxy {
+		dnsProxy = "off"
 	}
 
 	if err := vbm("modifyvm", d.MachineName,
 		"--firmware", "bios",
 		"--bioslogofadein", "off",
 		"--bioslogofadeout", "off",
-		"--natdnshostresolver1", "on",
+		"--natdnshostresolver1", dnsProxy,
 		"--bioslogodisplaytime", "0",
 		"--biosbootmenu", "disabled",
 
@@ -263,7 +350,7 @@ func (d *Driver) Create() error {
 
 	if err := vbm("modifyvm", d.MachineName,
 		"--nic1", "nat",
-		"--nictype1", "virtio",
+		"--nictype1", d.natNicType(),
 		"--cableconnected1", "on"); err != nil {
 		return err
 	}
@@ -273,22 +360,8 @@ func (d *Driver) Create() error {
 		return err
 	}
 
-	hostOnlyNetwork, err := getOrCreateHostOnlyNetwork(
-		net.ParseIP("192.168.99.1"),
-		net.IPv4Mask(255, 255, 255, 0),
-		net.ParseIP("192.168.99.2"),
-		net.ParseIP("192.168.99.100"),
-		net.ParseIP("192.168.99.254"))
-	if err != nil {
-		return err
-	}
-	if err := vbm("modifyvm", d.MachineName,
-		"--nic2", "hostonly",
-		"--nictype2", "virtio",
-		"--hostonlyadapter2", hostOnlyNetwork.Name,
-		"--cableconnected2", "on"); err != nil {
-		return err
-	}
+	// the host-only adapter is set up by Start, which validates the network
+	// whenever the VM is started
 
 	if err := vbm("storagectl", d.MachineName,
 		"--name", "SATA",
@@ -323,34 +396,10 @@ func (d *Driver) Create() error {
 		return err
 	}
 
-	var shareName, shareDir string // TODO configurable at some point
-	switch runtime.GOOS {
-	case "darwin":
-		shareName = "Users"
-		shareDir = "/Users"
-		// TODO "linux" and "windows"
-	}
-
-	if shareDir != "" {
-		if _, err := os.Stat(shareDir); err != nil && !os.IsNotExist(err) {
+	for _, share := range d.Shares {
+		log.Debugf("Sharing %s as /%s", share.HostPath, share.Name)
+		if err := d.addShare(share); err != nil {
 			return err
-		} else if !os.IsNotExist(err) {
-			if shareName == "" {
-				// parts of the VBox internal code are buggy with share names that start with "/"
-				shareName = strings.TrimLeft(shareDir, "/")
-				// TODO do some basic Windows -> MSYS path conversion
-				// ie, s!^([a-z]+):[/\\]+!\1/!; s!\\!/!g
-			}
-
-			// woo, shareDir exists!  let's carry on!
-			if err := vbm("sharedfolder", "add", d.MachineName, "--name", shareName, "--hostpath", shareDir, "--automount"); err != nil {
-				return err
-			}
-
-			// enable symlinks
-			if err := vbm("setextradata", d.MachineName, "VBoxInternal2/SharedFoldersEnableSymlinksCreate/"+shareName, "1"); err != nil {
-				return err
-			}
 		}
 	}
 
@@ -360,6 +409,12 @@ func (d *Driver) Create() error {
 		return err
 	}
 
+	if d.IPAddress != "" {
+		if err := d.configureStaticIP(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -371,6 +426,9 @@ func (d *Driver) Start() error {
 
 	switch s {
 	case state.Stopped, state.Saved:
+		if err := d.setupHostOnlyNetwork(s == state.Stopped); err != nil {
+			return err
+		}
 		if err := vbm("startvm", d.MachineName, "--type", "headless"); err != nil {
 			return err
 		}
@@ -387,6 +445,73 @@ func (d *Driver) Start() error {
 	return ssh.WaitForTCP(fmt.Sprintf("localhost:%d", d.SSHPort))
 }
 
+// setupHostOnlyNetwork checks that the host-only network does not collide
+// with another network of the host and creates it if it no longer exists,
+// e.g. after VirtualBox was reinstalled. The adapter of a powered off VM is
+// attached to it; a saved VM keeps its adapter.
+func (d *Driver) setupHostOnlyNetwork(attach bool) error {
+	host, dhcp, err := parseHostOnlyCIDR(d.hostOnlyCIDR())
+	if err != nil {
+		return err
+	}
+	if err := checkHostOnlyCollision(host); err != nil {
+		return err
+	}
+
+	hostOnlyNetwork, err := getOrCreateHostOnlyNetwork(host, *dhcp)
+	if err != nil {
+		return err
+	}
+	if !attach {
+		return nil
+	}
+	return vbm("modifyvm", d.MachineName,
+		"--nic2", "hostonly",
+		"--nictype2", d.hostOnlyNicType(),
+		"--hostonlyadapter2", hostOnlyNetwork.Name,
+		"--cableconnected2", "on")
+}
+
+// the network settings are empty in the configuration of machines created
+// before they could be changed
+func (d *Driver) hostOnlyCIDR() string {
+	if d.HostOnlyCIDR == "" {
+		return defaultHostOnlyCIDR
+	}
+	return d.HostOnlyCIDR
+}
+
+func (d *Driver) hostOnlyNicType() string {
+	if d.HostOnlyNicType == "" {
+		return defaultNicType
+	}
+	return d.HostOnlyNicType
+}
+
+func (d *Driver) natNicType() string {
+	if d.NatNicType == "" {
+		return defaultNicType
+	}
+	return d.NatNicType
+}
+
+// checkCPUCount accepts 0, which stands for the number of host CPUs, or a
+// count VirtualBox can give a VM
+func checkCPUCount(cpus int) error {
+	if cpus < 0 || cpus > maxCPUCount {
+		return fmt.Errorf("the CPU count must be between 1 and %d, or 0 for the number of host CPUs", maxCPUCount)
+	}
+	return nil
+}
+
+func checkNicType(nicType string) error {
+	switch nicType {
+	case "Am79C970A", "Am79C973", "82540EM", "82543GC", "82545EM", "virtio":
+		return nil
+	}
+	return fmt.Errorf("invalid NIC type %q", nicType)
+}
+
 func (d *Driver) Stop() error {
 	if err := vbm("controlvm", d.MachineName, "acpipowerbutton"); err != nil {
 		return err
@@ -440,6 +565,35 @@ func (d *Driver) Kill() error {
 	return vbm("controlvm", d.MachineName, "poweroff")
 }
 
+// Resize changes the CPUs and memory of the VM, which must be stopped
+func (d *Driver) Resize(cpus int, memory int, size string) error {
+	if size != "" {
+		return fmt.Errorf("VirtualBox machines have no instance size; use --cpus and --memory")
+	}
+	if cpus > maxCPUCount {
+		return fmt.Errorf("the CPU count must be between 1 and %d", maxCPUCount)
+	}
+
+	args := []string{"modifyvm", d.MachineName}
+	if cpus > 0 {
+		args = append(args, "--cpus", fmt.Sprintf("%d", cpus))
+	}
+	if memory > 0 {
+		args = append(args, "--memory", fmt.Sprintf("%d", memory))
+	}
+	if err := vbm(args...); err != nil {
+		return err
+	}
+
+	if cpus > 0 {
+		d.CPU = cpus
+	}
+	if memory > 0 {
+		d.Memory = memory
+	}
+	return nil
+}
+
 func (d *Driver) GetState() (state.State, error) {
 	stdout, stderr, err := vbmOutErr("showvminfo", d.MachineName,
 		"--machinereadable")
@@ -474,6 +628,10 @@ func (d *Driver) setMachineNameIfNotSet() {
 }
 
 func (d *Driver) GetIP() (string, error) {
+	if d.IPAddress != "" {
+		return d.IPAddress, nil
+	}
+
 	// DHCP is used to get the IP, so virtualbox hosts don't have IPs unless
 	// they are running
 	s, err := d.GetState()
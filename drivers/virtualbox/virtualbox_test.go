@@ -1 +1,35 @@
 package virtualbox
+
+import "testing"
+
+func TestCheckNicType(t *testing.T) {
+	if err := checkNicType("82540EM"); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkNicType("e1000"); err == nil {
+		t.Fatal("expected error for an unknown NIC type")
+	}
+}
+
+func TestCheckCPUCount(t *testing.T) {
+	for _, cpus := range []int{0, 1, maxCPUCount} {
+		if err := checkCPUCount(cpus); err != nil {
+			t.Fatalf("%d: %s", cpus, err)
+		}
+	}
+	for _, cpus := range []int{-1, maxCPUCount + 1} {
+		if err := checkCPUCount(cpus); err == nil {
+			t.Fatalf("expected error for %d CPUs", cpus)
+		}
+	}
+}
+
+func TestResizeRejectsTooManyCPUs(t *testing.T) {
+	d := &Driver{MachineName: "test"}
+	if err := d.Resize(maxCPUCount+1, 0, ""); err == nil {
+		t.Fatal("expected error for too many CPUs")
+	}
+	if d.CPU != 0 {
+		t.Fatalf("expected the CPU count to be unchanged; received %d", d.CPU)
+	}
+}
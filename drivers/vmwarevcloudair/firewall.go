@@ -0,0 +1,178 @@
+/*
+ * Copyright 2014 VMware, Inc.  All rights reserved.  Licensed under the Apache v2 License.
+ */
+
+package vmwarevcloudair
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/vmware/govcloudair"
+	types "github.com/vmware/govcloudair/types/v56"
+
+	"github.com/docker/machine/drivers"
+)
+
+const swarmPort = 3376
+
+// portFirewallRule returns the edge gateway firewall rule allowing access
+// to a port of the public IP of the machine from its CIDR, or from anywhere
+func (d *Driver) portFirewallRule(p *drivers.Port) *types.FirewallRule {
+	source := p.CIDR
+	if source == "" {
+		source = "Any"
+	}
+	return &types.FirewallRule{
+		Description: d.MachineName,
+		IsEnabled:   true,
+		Policy:      "allow",
+		Protocols: &types.FirewallRuleProtocols{
+			Tcp: p.Protocol == "tcp",
+			Udp: p.Protocol == "udp",
+		},
+		DestinationPortRange: strconv.Itoa(p.Port),
+		DestinationIP:        d.PublicIP,
+		SourcePortRange:      "Any",
+		SourceIP:             source,
+	}
+}
+
+// machinePorts returns the ports Machine needs to reach on the machine
+func (d *Driver) machinePorts() []*drivers.Port {
+	ports := []*drivers.Port{
+		{Protocol: "tcp", Port: d.SSHPort},
+		{Protocol: "tcp", Port: d.DockerPort},
+	}
+	if d.SwarmMaster {
+		ports = append(ports, &drivers.Port{Protocol: "tcp", Port: swarmPort})
+	}
+	return ports
+}
+
+func sameFirewallRule(a *types.FirewallRule, b *types.FirewallRule) bool {
+	return a.Policy == b.Policy &&
+		a.Protocols != nil && b.Protocols != nil &&
+		*a.Protocols == *b.Protocols &&
+		a.DestinationPortRange == b.DestinationPortRange &&
+		a.DestinationIP == b.DestinationIP &&
+		a.SourceIP == b.SourceIP
+}
+
+// isAnyInboundRule reports whether rule is the rule opening every port of
+// ip created by Create1to1Mapping
+func isAnyInboundRule(rule *types.FirewallRule, ip string) bool {
+	return rule.Policy == "allow" &&
+		rule.Protocols != nil && rule.Protocols.Any &&
+		rule.DestinationPortRange == "Any" &&
+		rule.SourcePortRange == "Any" &&
+		rule.SourceIP == "Any" &&
+		rule.DestinationIP == ip
+}
+
+// addPortRules returns rules with the rules of ports which are missing
+func (d *Driver) addPortRules(rules []*types.FirewallRule, ports []*drivers.Port) []*types.FirewallRule {
+	for _, p := range ports {
+		rule := d.portFirewallRule(p)
+		found := false
+		for _, r := range rules {
+			if sameFirewallRule(r, rule) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// removePortRules returns rules without the rules of ports
+func (d *Driver) removePortRules(rules []*types.FirewallRule, ports []*drivers.Port) []*types.FirewallRule {
+	remaining := []*types.FirewallRule{}
+	for _, r := range rules {
+		removed := false
+		for _, p := range ports {
+			if sameFirewallRule(r, d.portFirewallRule(p)) {
+				removed = true
+				break
+			}
+		}
+		if !removed {
+			remaining = append(remaining, r)
+		}
+	}
+	return remaining
+}
+
+// removeMachineRules returns rules without the per port rules created for
+// the machine
+func (d *Driver) removeMachineRules(rules []*types.FirewallRule) []*types.FirewallRule {
+	remaining := []*types.FirewallRule{}
+	for _, r := range rules {
+		if r.Description == d.MachineName && r.DestinationIP == d.PublicIP && r.DestinationPortRange != "Any" {
+			continue
+		}
+		remaining = append(remaining, r)
+	}
+	return remaining
+}
+
+// restrictInboundRules returns rules where the rule opening every port of
+// the machine is replaced by the rules of the ports Machine needs
+func (d *Driver) restrictInboundRules(rules []*types.FirewallRule) []*types.FirewallRule {
+	remaining := []*types.FirewallRule{}
+	for _, r := range rules {
+		if !isAnyInboundRule(r, d.PublicIP) {
+			remaining = append(remaining, r)
+		}
+	}
+	return d.addPortRules(remaining, d.machinePorts())
+}
+
+// configureFirewall replaces the firewall rules of the edge gateway by the
+// result of update, keeping its other services as they are
+func configureFirewall(p *govcloudair.Client, edge govcloudair.EdgeGateway, update func([]*types.FirewallRule) []*types.FirewallRule) error {
+	if err := edge.Refresh(); err != nil {
+		return err
+	}
+
+	config := edge.EdgeGateway.Configuration.EdgeGatewayServiceConfiguration
+	if config == nil || config.FirewallService == nil {
+		return fmt.Errorf("edge gateway %s has no firewall service", edge.EdgeGateway.Name)
+	}
+	config.FirewallService.FirewallRule = update(config.FirewallService.FirewallRule)
+
+	output, err := xml.MarshalIndent(config, "  ", "    ")
+	if err != nil {
+		return err
+	}
+
+	u, err := url.ParseRequestURI(edge.EdgeGateway.HREF)
+	if err != nil {
+		return err
+	}
+	u.Path += "/action/configureServices"
+
+	req := p.NewRequest(map[string]string{}, "POST", *u, bytes.NewBufferString(xml.Header+string(output)))
+	req.Header.Add("Content-Type", "application/vnd.vmware.admin.edgeGatewayServiceConfiguration+xml")
+
+	resp, err := p.Http.Do(req)
+	if err != nil {
+		return fmt.Errorf("error reconfiguring edge gateway %s: %s", edge.EdgeGateway.Name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 && resp.StatusCode != 202 {
+		return fmt.Errorf("error reconfiguring edge gateway %s: %s", edge.EdgeGateway.Name, resp.Status)
+	}
+
+	task := govcloudair.NewTask(p)
+	if err := xml.NewDecoder(resp.Body).Decode(task.Task); err != nil {
+		return fmt.Errorf("error decoding task response: %s", err)
+	}
+	return task.WaitTaskCompletion()
+}
@@ -11,6 +11,7 @@ import (
 	"strings"
 
 	"github.com/vmware/govcloudair"
+	types "github.com/vmware/govcloudair/types/v56"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/codegangsta/cli"
@@ -168,12 +169,45 @@ func NewDriver(machineName string, storePath string, caCert string, privateKey s
 	return driver, nil
 }
 
+// AuthorizePort adds edge gateway firewall rules allowing access to ports
+// of the public IP of the machine
 func (d *Driver) AuthorizePort(ports []*drivers.Port) error {
-	return nil
+	log.Debugf("authorizing ports %v on %s", ports, d.EdgeGateway)
+	return d.updateFirewall(func(rules []*types.FirewallRule) []*types.FirewallRule {
+		return d.addPortRules(rules, ports)
+	})
 }
 
 func (d *Driver) DeauthorizePort(ports []*drivers.Port) error {
-	return nil
+	log.Debugf("revoking ports %v on %s", ports, d.EdgeGateway)
+	return d.updateFirewall(func(rules []*types.FirewallRule) []*types.FirewallRule {
+		return d.removePortRules(rules, ports)
+	})
+}
+
+// updateFirewall connects to vCloud Air to update the firewall rules of the
+// edge gateway of the machine
+func (d *Driver) updateFirewall(update func([]*types.FirewallRule) []*types.FirewallRule) error {
+	p, err := govcloudair.NewClient()
+	if err != nil {
+		return err
+	}
+
+	v, err := p.Authenticate(d.UserName, d.UserPassword, d.ComputeID, d.VDCID)
+	if err != nil {
+		return err
+	}
+
+	edge, err := v.FindEdgeGateway(d.EdgeGateway)
+	if err != nil {
+		return err
+	}
+
+	if err := configureFirewall(p, edge, update); err != nil {
+		return err
+	}
+
+	return p.Disconnect()
 }
 
 func (d *Driver) GetMachineName() string {
@@ -432,6 +466,12 @@ func (d *Driver) Create() error {
 		return err
 	}
 
+	// The 1:1 mapping opens every port; only open those Machine needs and
+	// leave the others to AuthorizePort
+	if err := configureFirewall(p, edge, d.restrictInboundRules); err != nil {
+		return err
+	}
+
 	log.Infof("Waiting for SSH...")
 
 	if err := ssh.WaitForTCP(fmt.Sprintf("%s:%d", d.PublicIP, d.SSHPort)); err != nil {
@@ -494,6 +534,9 @@ func (d *Driver) Remove() error {
 	}
 
 	log.Infof("Removing NAT and Firewall Rules on %s...", d.EdgeGateway)
+	if err := configureFirewall(p, edge, d.removeMachineRules); err != nil {
+		return err
+	}
 	task, err := edge.Remove1to1Mapping(vapp.VApp.Children.VM[0].NetworkConnectionSection.NetworkConnection.IPAddress, d.PublicIP)
 	if err != nil {
 		return err
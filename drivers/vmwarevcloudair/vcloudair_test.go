@@ -1 +1,91 @@
 package vmwarevcloudair
+
+import (
+	"testing"
+
+	types "github.com/vmware/govcloudair/types/v56"
+
+	"github.com/docker/machine/drivers"
+)
+
+func getTestDriver() *Driver {
+	return &Driver{
+		MachineName: "test-machine",
+		PublicIP:    "203.0.113.10",
+		SSHPort:     22,
+		DockerPort:  2376,
+	}
+}
+
+func anyInboundRule(ip string) *types.FirewallRule {
+	return &types.FirewallRule{
+		Policy:               "allow",
+		Protocols:            &types.FirewallRuleProtocols{Any: true},
+		DestinationPortRange: "Any",
+		DestinationIP:        ip,
+		SourcePortRange:      "Any",
+		SourceIP:             "Any",
+	}
+}
+
+func TestRestrictInboundRules(t *testing.T) {
+	d := getTestDriver()
+	other := anyInboundRule("203.0.113.20")
+
+	rules := d.restrictInboundRules([]*types.FirewallRule{anyInboundRule(d.PublicIP), other})
+
+	if len(rules) != 3 || rules[0] != other {
+		t.Fatalf("expected the rule of another IP and 2 port rules; received %d rules", len(rules))
+	}
+	for i, port := range []string{"22", "2376"} {
+		r := rules[i+1]
+		if r.DestinationPortRange != port || r.DestinationIP != d.PublicIP || !r.Protocols.Tcp || r.SourceIP != "Any" {
+			t.Fatalf("unexpected rule %+v", r)
+		}
+	}
+}
+
+func TestPortRules(t *testing.T) {
+	d := getTestDriver()
+	ports := []*drivers.Port{
+		{Protocol: "tcp", Port: 80},
+		{Protocol: "udp", Port: 53, CIDR: "10.0.0.0/8"},
+	}
+
+	rules := d.addPortRules([]*types.FirewallRule{}, ports)
+	if len(rules) != 2 {
+		t.Fatalf("expected 2 rules; received %d", len(rules))
+	}
+	if r := rules[1]; r.DestinationPortRange != "53" || !r.Protocols.Udp || r.Protocols.Tcp || r.SourceIP != "10.0.0.0/8" {
+		t.Fatalf("unexpected rule %+v", r)
+	}
+
+	// adding a port again does not duplicate its rule
+	if rules = d.addPortRules(rules, ports[:1]); len(rules) != 2 {
+		t.Fatalf("expected 2 rules; received %d", len(rules))
+	}
+
+	// a port opened to a CIDR is not closed by a port without it
+	if remaining := d.removePortRules(rules, []*drivers.Port{{Protocol: "udp", Port: 53}}); len(remaining) != 2 {
+		t.Fatalf("expected 2 rules; received %d", len(remaining))
+	}
+
+	remaining := d.removePortRules(rules, []*drivers.Port{{Protocol: "udp", Port: 53, CIDR: "10.0.0.0/8"}})
+	if len(remaining) != 1 || remaining[0].DestinationPortRange != "80" {
+		t.Fatalf("expected the rule of port 80 only; received %d rules", len(remaining))
+	}
+}
+
+func TestRemoveMachineRules(t *testing.T) {
+	d := getTestDriver()
+	other := getTestDriver()
+	other.MachineName, other.PublicIP = "other-machine", "203.0.113.20"
+
+	rules := d.restrictInboundRules([]*types.FirewallRule{anyInboundRule(d.PublicIP)})
+	rules = other.addPortRules(rules, []*drivers.Port{{Protocol: "tcp", Port: 80}})
+
+	remaining := d.removeMachineRules(rules)
+	if len(remaining) != 1 || remaining[0].DestinationIP != other.PublicIP {
+		t.Fatalf("expected the rule of the other machine only; received %d rules", len(remaining))
+	}
+}
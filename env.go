@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+var (
+	envShells  = []string{"bash", "zsh", "fish", "tcsh", "powershell", "cmd", "emacs"}
+	envFormats = []string{"dotenv", "json"}
+)
+
+// envVar is an environment variable printed by the env command
+type envVar struct {
+	Name  string
+	Value string
+}
+
+// detectShell guesses the shell env is run from. SHELL is not set in
+// cmd.exe, so that is assumed on Windows.
+func detectShell() string {
+	userShell := os.Getenv("SHELL")
+	if userShell == "" {
+		if runtime.GOOS == "windows" {
+			return "cmd"
+		}
+		return "bash"
+	}
+
+	switch shell := filepath.Base(userShell); shell {
+	case "fish", "zsh", "powershell":
+		return shell
+	case "tcsh", "csh":
+		return "tcsh"
+	}
+	return "bash"
+}
+
+func validateEnvShell(shell string) error {
+	for _, s := range envShells {
+		if s == shell {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported shell %q (must be one of %s)", shell, strings.Join(envShells, ", "))
+}
+
+func validateEnvFormat(format string) error {
+	for _, f := range envFormats {
+		if f == format {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported format %q (must be one of %s)", format, strings.Join(envFormats, ", "))
+}
+
+// formatEnvShell returns the commands to set, or unset, the variables in the
+// given shell. Values are not quoted for bash, zsh and fish so that the output
+// can be used with $(...) as well as eval.
+func formatEnvShell(shell string, vars []envVar, unset bool) (string, error) {
+	if err := validateEnvShell(shell); err != nil {
+		return "", err
+	}
+
+	out := ""
+	for _, v := range vars {
+		var line string
+		switch shell {
+		case "fish":
+			if unset {
+				line = fmt.Sprintf("set -e %s;", v.Name)
+			} else {
+				line = fmt.Sprintf("set -x %s %s;", v.Name, v.Value)
+			}
+		case "tcsh":
+			if unset {
+				line = fmt.Sprintf("unsetenv %s;", v.Name)
+			} else {
+				line = fmt.Sprintf("setenv %s \"%s\";", v.Name, v.Value)
+			}
+		case "powershell":
+			if unset {
+				line = fmt.Sprintf("Remove-Item Env:\\%s", v.Name)
+			} else {
+				line = fmt.Sprintf("$Env:%s = \"%s\"", v.Name, v.Value)
+			}
+		case "cmd":
+			if unset {
+				line = fmt.Sprintf("SET %s=", v.Name)
+			} else {
+				line = fmt.Sprintf("SET %s=%s", v.Name, v.Value)
+			}
+		case "emacs":
+			if unset {
+				line = fmt.Sprintf("(setenv %q nil)", v.Name)
+			} else {
+				line = fmt.Sprintf("(setenv %q %q)", v.Name, v.Value)
+			}
+		default:
+			if unset {
+				line = fmt.Sprintf("unset %s", v.Name)
+			} else {
+				line = fmt.Sprintf("export %s=%s", v.Name, v.Value)
+			}
+		}
+		out += line + "\n"
+	}
+	return out, nil
+}
+
+// formatEnvData returns the variables in a format meant to be read by other
+// tools rather than a shell
+func formatEnvData(format string, vars []envVar) (string, error) {
+	if err := validateEnvFormat(format); err != nil {
+		return "", err
+	}
+
+	switch format {
+	case "json":
+		values := make(map[string]string)
+		for _, v := range vars {
+			values[v.Name] = v.Value
+		}
+		data, err := json.MarshalIndent(values, "", "    ")
+		if err != nil {
+			return "", err
+		}
+		return string(data) + "\n", nil
+	default:
+		out := ""
+		for _, v := range vars {
+			out += fmt.Sprintf("%s=%s\n", v.Name, v.Value)
+		}
+		return out, nil
+	}
+}
+
+// appendNoProxy adds ip to a NO_PROXY list unless it is already in it
+func appendNoProxy(noProxy string, ip string) string {
+	if noProxy == "" {
+		return ip
+	}
+	for _, entry := range strings.Split(noProxy, ",") {
+		if strings.TrimSpace(entry) == ip {
+			return noProxy
+		}
+	}
+	return fmt.Sprintf("%s,%s", noProxy, ip)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+var testEnvVars = []envVar{
+	{"DOCKER_TLS_VERIFY", "1"},
+	{"DOCKER_CERT_PATH", "/home/test/.docker/machine/machines/dev"},
+	{"DOCKER_HOST", "tcp://192.168.99.100:2376"},
+}
+
+func TestFormatEnvShell(t *testing.T) {
+	expected := map[string]string{
+		"bash":       "export DOCKER_HOST=tcp://192.168.99.100:2376\n",
+		"zsh":        "export DOCKER_HOST=tcp://192.168.99.100:2376\n",
+		"fish":       "set -x DOCKER_HOST tcp://192.168.99.100:2376;\n",
+		"tcsh":       "setenv DOCKER_HOST \"tcp://192.168.99.100:2376\";\n",
+		"powershell": "$Env:DOCKER_HOST = \"tcp://192.168.99.100:2376\"\n",
+		"cmd":        "SET DOCKER_HOST=tcp://192.168.99.100:2376\n",
+		"emacs":      "(setenv \"DOCKER_HOST\" \"tcp://192.168.99.100:2376\")\n",
+	}
+
+	for shell, line := range expected {
+		out, err := formatEnvShell(shell, testEnvVars[2:], false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != line {
+			t.Fatalf("%s: expected %q; received %q", shell, line, out)
+		}
+	}
+
+	if _, err := formatEnvShell("csh", testEnvVars, false); err == nil {
+		t.Fatal("expected error for unsupported shell")
+	}
+}
+
+func TestFormatEnvShellUnset(t *testing.T) {
+	expected := map[string]string{
+		"bash":       "unset DOCKER_HOST\n",
+		"fish":       "set -e DOCKER_HOST;\n",
+		"tcsh":       "unsetenv DOCKER_HOST;\n",
+		"powershell": "Remove-Item Env:\\DOCKER_HOST\n",
+		"cmd":        "SET DOCKER_HOST=\n",
+		"emacs":      "(setenv \"DOCKER_HOST\" nil)\n",
+	}
+
+	for shell, line := range expected {
+		out, err := formatEnvShell(shell, testEnvVars[2:], true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != line {
+			t.Fatalf("%s: expected %q; received %q", shell, line, out)
+		}
+	}
+}
+
+func TestFormatEnvData(t *testing.T) {
+	out, err := formatEnvData("dotenv", testEnvVars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "DOCKER_TLS_VERIFY=1\nDOCKER_CERT_PATH=/home/test/.docker/machine/machines/dev\nDOCKER_HOST=tcp://192.168.99.100:2376\n"
+	if out != expected {
+		t.Fatalf("expected %q; received %q", expected, out)
+	}
+
+	out, err = formatEnvData("json", testEnvVars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]string{}
+	if err := json.Unmarshal([]byte(out), &values); err != nil {
+		t.Fatal(err)
+	}
+	if values["DOCKER_HOST"] != "tcp://192.168.99.100:2376" || len(values) != 3 {
+		t.Fatalf("unexpected json values: %v", values)
+	}
+
+	if _, err := formatEnvData("yaml", testEnvVars); err == nil {
+		t.Fatal("expected error for unsupported format")
+	}
+}
+
+func TestDetectShell(t *testing.T) {
+	defer os.Setenv("SHELL", os.Getenv("SHELL"))
+
+	expected := map[string]string{
+		"/bin/bash":           "bash",
+		"/bin/sh":             "bash",
+		"/usr/local/bin/fish": "fish",
+		"/bin/zsh":            "zsh",
+		"/bin/csh":            "tcsh",
+	}
+	for userShell, shell := range expected {
+		os.Setenv("SHELL", userShell)
+		if detectShell() != shell {
+			t.Fatalf("%s: expected %s; received %s", userShell, shell, detectShell())
+		}
+	}
+}
+
+func TestAppendNoProxy(t *testing.T) {
+	if v := appendNoProxy("", "192.168.99.100"); v != "192.168.99.100" {
+		t.Fatalf("unexpected NO_PROXY %q", v)
+	}
+	if v := appendNoProxy("localhost", "192.168.99.100"); v != "localhost,192.168.99.100" {
+		t.Fatalf("unexpected NO_PROXY %q", v)
+	}
+	if v := appendNoProxy("localhost, 192.168.99.100", "192.168.99.100"); v != "localhost, 192.168.99.100" {
+		t.Fatalf("unexpected NO_PROXY %q", v)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/url"
@@ -30,27 +31,38 @@ var (
 	validHostNamePattern     = regexp.MustCompile(`^` + validHostNameChars + `+$`)
 	ErrInvalidHostname       = errors.New("Invalid hostname specified")
 	ErrUnknownHypervisorType = errors.New("Unknown hypervisor type")
+	swarmStrategies          = []string{"spread", "binpack", "random"}
 )
 
 const (
-	swarmDockerImage              = "swarm:latest"
+	swarmDefaultImage             = "swarm:latest"
+	swarmDefaultStrategy          = "spread"
 	swarmDiscoveryServiceEndpoint = "https://discovery-stage.hub.docker.com/v1"
+	swarmDiscoveryFilename        = "swarm-discovery"
 )
 
 type Host struct {
-	Name           string `json:"-"`
-	DriverName     string
-	Driver         drivers.Driver
-	CaCertPath     string
-	ServerCertPath string
-	ServerKeyPath  string
-	PrivateKeyPath string
-	ClientCertPath string
-	SwarmMaster    bool
-	SwarmHost      string
-	SwarmDiscovery string
-	storePath      string
-	arch           string
+	Name             string `json:"-"`
+	DriverName       string
+	Driver           drivers.Driver
+	CaCertPath       string
+	ServerCertPath   string
+	ServerKeyPath    string
+	PrivateKeyPath   string
+	ClientCertPath   string
+	SwarmMaster      bool
+	SwarmHost        string
+	SwarmDiscovery   string
+	SwarmImage       string
+	SwarmStrategy    string
+	SwarmOpts        []string
+	EngineLabels     []string
+	EngineHttpProxy  string
+	EngineHttpsProxy string
+	EngineNoProxy    string
+	Ports            []*drivers.Port
+	storePath        string
+	arch             string
 }
 
 type DockerConfig struct {
@@ -150,9 +162,10 @@ func (h *Host) ConfigureSwarm(discovery string, master bool, host string, addr s
 	tlsCaCert := path.Join(basePath, "ca.pem")
 	tlsCert := path.Join(basePath, "server.pem")
 	tlsKey := path.Join(basePath, "server-key.pem")
-	masterArgs := fmt.Sprintf("--tlsverify --tlscacert=%s --tlscert=%s --tlskey=%s -H %s %s",
-		tlsCaCert, tlsCert, tlsKey, host, discovery)
+	masterArgs := fmt.Sprintf("--tlsverify --tlscacert=%s --tlscert=%s --tlskey=%s -H %s --strategy %s %s%s",
+		tlsCaCert, tlsCert, tlsKey, host, h.swarmStrategy(), swarmOptArgs(h.SwarmOpts), discovery)
 	nodeArgs := fmt.Sprintf("--addr %s %s", addr, discovery)
+	swarmImage := h.swarmImage()
 
 	u, err := url.Parse(host)
 	if err != nil {
@@ -166,7 +179,7 @@ func (h *Host) ConfigureSwarm(discovery string, master bool, host string, addr s
 		return err
 	}
 
-	cmd, err := h.GetSSHCommand(fmt.Sprintf("sudo docker pull %s", swarmDockerImage))
+	cmd, err := h.GetSSHCommand(fmt.Sprintf("sudo docker pull %s", swarmImage))
 	if err != nil {
 		return err
 	}
@@ -183,29 +196,165 @@ func (h *Host) ConfigureSwarm(discovery string, master bool, host string, addr s
 	if master {
 		log.Debug("launching swarm master")
 		log.Debugf("master args: %s", masterArgs)
-		cmd, err = h.GetSSHCommand(fmt.Sprintf("sudo docker run -d -p %s:%s --restart=always --name swarm-agent-master -v %s:%s %s manage %s",
-			port, port, dockerDir, dockerDir, swarmDockerImage, masterArgs))
-		if err != nil {
-			return err
-		}
-		if err := cmd.Run(); err != nil {
+		if err := h.runSwarmContainer("swarm-agent-master", fmt.Sprintf("-p %s:%s -v %s:%s %s manage %s",
+			port, port, dockerDir, dockerDir, swarmImage, masterArgs)); err != nil {
 			return err
 		}
 	}
 
+	// static discovery is read by the master only; there is nothing to join
+	if isStaticDiscovery(discovery) {
+		return nil
+	}
+
 	// start node agent
 	log.Debug("launching swarm node")
 	log.Debugf("node args: %s", nodeArgs)
-	cmd, err = h.GetSSHCommand(fmt.Sprintf("sudo docker run -d --restart=always --name swarm-agent -v %s:%s %s join %s",
-		dockerDir, dockerDir, swarmDockerImage, nodeArgs))
+	if err := h.runSwarmContainer("swarm-agent", fmt.Sprintf("-v %s:%s %s join %s",
+		dockerDir, dockerDir, swarmImage, nodeArgs)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// JoinSwarm configures the host as a member, and optionally the master, of
+// the swarm using discovery. Any previous swarm configuration is replaced,
+// so joining the same swarm again is a no-op.
+func (h *Host) JoinSwarm(discovery string, master bool, swarmHost string, addr string) error {
+	if !master {
+		if err := h.removeSwarmContainer("swarm-agent-master"); err != nil {
+			return err
+		}
+	}
+	if isStaticDiscovery(discovery) {
+		if err := h.removeSwarmContainer("swarm-agent"); err != nil {
+			return err
+		}
+	}
+
+	if err := h.ConfigureSwarm(discovery, master, swarmHost, addr); err != nil {
+		return err
+	}
+
+	h.SwarmDiscovery = discovery
+	h.SwarmMaster = master
+	h.SwarmHost = swarmHost
+	return h.SaveConfig()
+}
+
+// LeaveSwarm stops the swarm agent and master on the host and clears its
+// swarm configuration
+func (h *Host) LeaveSwarm() error {
+	for _, name := range []string{"swarm-agent-master", "swarm-agent"} {
+		if err := h.removeSwarmContainer(name); err != nil {
+			return err
+		}
+	}
+
+	h.SwarmDiscovery = ""
+	h.SwarmMaster = false
+	h.SwarmHost = ""
+	return h.SaveConfig()
+}
+
+// swarmImage returns the swarm image to run; hosts created before the image
+// was configurable use the default
+func (h *Host) swarmImage() string {
+	if h.SwarmImage == "" {
+		return swarmDefaultImage
+	}
+	return h.SwarmImage
+}
+
+func (h *Host) swarmStrategy() string {
+	if h.SwarmStrategy == "" {
+		return swarmDefaultStrategy
+	}
+	return h.SwarmStrategy
+}
+
+// swarmOptArgs turns options such as "heartbeat=5s" into flags for swarm
+// manage, e.g. "--heartbeat=5s ". Options may be repeated, e.g. filters.
+func swarmOptArgs(opts []string) string {
+	args := ""
+	for _, opt := range opts {
+		args += fmt.Sprintf("--%s ", strings.TrimLeft(opt, "-"))
+	}
+	return args
+}
+
+// ValidateSwarmStrategy checks that strategy is a scheduling strategy swarm
+// knows about
+func ValidateSwarmStrategy(strategy string) error {
+	for _, s := range swarmStrategies {
+		if s == strategy {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid swarm strategy %q (must be one of %s)", strategy, strings.Join(swarmStrategies, ", "))
+}
+
+// runSwarmContainer starts a swarm container, replacing any existing
+// container with the same name so that it can be reconfigured
+func (h *Host) runSwarmContainer(name string, args string) error {
+	cmd, err := h.GetSSHCommand(fmt.Sprintf("sudo docker rm -f %s >/dev/null 2>&1; sudo docker run -d --restart=always --name %s %s",
+		name, name, args))
 	if err != nil {
 		return err
 	}
-	if err := cmd.Run(); err != nil {
+	return cmd.Run()
+}
+
+// removeSwarmContainer removes a swarm container if it exists
+func (h *Host) removeSwarmContainer(name string) error {
+	if h.Driver.DriverName() == "none" {
+		return nil
+	}
+	cmd, err := h.GetSSHCommand(fmt.Sprintf("sudo docker rm -f %s >/dev/null 2>&1 || true", name))
+	if err != nil {
 		return err
 	}
+	return cmd.Run()
+}
 
-	return nil
+// UploadSwarmDiscoveryFile writes the addresses of the swarm nodes to the
+// discovery file read by a swarm master using file:// discovery
+func (h *Host) UploadSwarmDiscoveryFile(addrs []string) (string, error) {
+	dockerDir, err := h.GetDockerConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	// due to windows clients, we cannot use filepath.Join as the paths
+	// will be mucked on the linux hosts
+	discoveryFile := path.Join(dockerDir, swarmDiscoveryFilename)
+
+	cmd, err := h.GetSSHCommand(fmt.Sprintf("echo \"%s\" | sudo tee %s", strings.Join(addrs, "\n"), discoveryFile))
+	if err != nil {
+		return "", err
+	}
+	if err := cmd.Run(); err != nil {
+		return "", err
+	}
+
+	return discoveryFile, nil
+}
+
+// GetSwarmAddr returns the address swarm uses to reach the engine on this host
+func (h *Host) GetSwarmAddr() (string, error) {
+	dockerUrl, err := h.GetURL()
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(dockerUrl)
+	if err != nil {
+		return "", err
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("unable to determine the address of %s", h.Name)
+	}
+	return u.Host, nil
 }
 
 func (h *Host) StartDocker() error {
@@ -448,7 +597,10 @@ func (h *Host) generateDockerConfig(dockerPort int, caCertPath string, serverKey
 	)
 
 	swarmLabels = append(swarmLabels, fmt.Sprintf("--label=provider=%s", h.Driver.DriverName()))
-	swarmLabels = append(swarmLabels, fmt.Sprintf("--label=arch=%s"), h.arch)
+	swarmLabels = append(swarmLabels, fmt.Sprintf("--label=arch=%s", h.arch))
+	for _, label := range h.EngineLabels {
+		swarmLabels = append(swarmLabels, fmt.Sprintf("--label=%s", label))
+	}
 
 	defaultDaemonOpts := fmt.Sprintf(`--tlsverify --tlscacert=%s --tlskey=%s --tlscert=%s %s`,
 		caCertPath,
@@ -463,7 +615,7 @@ func (h *Host) generateDockerConfig(dockerPort int, caCertPath string, serverKey
 	}
 
 	switch d.DriverName() {
-	case "virtualbox", "vmwarefusion", "vmwarevsphere", "hyper-v":
+	case "virtualbox", "vmwarefusion", "vmwarevsphere", "hyper-v", "kvm":
 		daemonOpts = fmt.Sprintf("-H tcp://0.0.0.0:%d", dockerPort)
 		daemonOptsCfg = path.Join(dockerDir, "profile")
 		opts := fmt.Sprintf("%s %s", defaultDaemonOpts, daemonOpts)
@@ -472,18 +624,28 @@ CACERT=%s
 SERVERCERT=%s
 SERVERKEY=%s
 DOCKER_TLS=no`, opts, caCertPath, serverKeyPath, serverCertPath)
+		for _, v := range h.engineProxyEnv() {
+			daemonCfg += fmt.Sprintf("\nexport %s=\\\"%s\\\"", v.Name, escapeConfigValue(v.Value))
+		}
 	case "openstack":
 		// hack for Fedora only
 		daemonOpts = fmt.Sprintf("--host=unix:///var/run/docker.sock --host=tcp://0.0.0.0:%d --selinux-enabled", dockerPort)
 		daemonOptsCfg = "/etc/sysconfig/docker"
 		opts := fmt.Sprintf("%s %s", defaultDaemonOpts, daemonOpts)
 		daemonCfg = fmt.Sprintf("OPTIONS=\\\"%s\\\"", opts)
+		// read by systemd as an EnvironmentFile, which does not know export
+		for _, v := range h.engineProxyEnv() {
+			daemonCfg += fmt.Sprintf("\n%s=\\\"%s\\\"", v.Name, escapeConfigValue(v.Value))
+		}
 
 	default:
 		daemonOpts = fmt.Sprintf("--host=unix:///var/run/docker.sock --host=tcp://0.0.0.0:%d", dockerPort)
 		daemonOptsCfg = "/etc/default/docker"
 		opts := fmt.Sprintf("%s %s", defaultDaemonOpts, daemonOpts)
 		daemonCfg = fmt.Sprintf("export DOCKER_OPTS=\\\"%s\\\"", opts)
+		for _, v := range h.engineProxyEnv() {
+			daemonCfg += fmt.Sprintf("\nexport %s=\\\"%s\\\"", v.Name, escapeConfigValue(v.Value))
+		}
 	}
 
 	return &DockerConfig{
@@ -492,6 +654,38 @@ DOCKER_TLS=no`, opts, caCertPath, serverKeyPath, serverCertPath)
 	}, nil
 }
 
+// engineProxyEnv returns the proxy variables for the engine and for installing it.
+// Both cases are set as curl and apt only read the lowercase http_proxy.
+func (h *Host) engineProxyEnv() []envVar {
+	vars := []envVar{}
+	for _, v := range []envVar{
+		{"HTTP_PROXY", h.EngineHttpProxy},
+		{"HTTPS_PROXY", h.EngineHttpsProxy},
+		{"NO_PROXY", h.EngineNoProxy},
+	} {
+		if v.Value != "" {
+			vars = append(vars, v, envVar{strings.ToLower(v.Name), v.Value})
+		}
+	}
+	return vars
+}
+
+// escapeDoubleQuoted escapes a value for use within double quotes in a
+// remote shell command
+func escapeDoubleQuoted(value string) string {
+	for _, c := range []string{"\\", "\"", "$", "`"} {
+		value = strings.Replace(value, c, "\\"+c, -1)
+	}
+	return value
+}
+
+// escapeConfigValue escapes a value written within double quotes to an
+// engine config file: once for the file, which is sourced by a shell, and
+// once for the double quoted echo writing the file
+func escapeConfigValue(value string) string {
+	return escapeDoubleQuoted(escapeDoubleQuoted(value))
+}
+
 func (h *Host) Create(name string) error {
 	name, err := ValidateHostName(name)
 	if err != nil {
@@ -524,7 +718,7 @@ func (h *Host) Create(name string) error {
 func (h *Host) Provision() error {
 	// "local" providers use b2d; no provisioning necessary
 	switch h.Driver.DriverName() {
-	case "none", "virtualbox", "vmwarefusion", "vmwarevsphere":
+	case "none", "virtualbox", "vmwarefusion", "vmwarevsphere", "kvm":
 		return nil
 	}
 
@@ -534,7 +728,11 @@ func (h *Host) Provision() error {
 
 	// install docker - until cloudinit we use ubuntu everywhere so we
 	// just install it using the docker repos
-	cmd, err := h.GetSSHCommand("if [ ! -e /usr/bin/docker ]; then curl -sSL https://get.docker.com | sh -; fi")
+	proxyEnv := ""
+	for _, v := range h.engineProxyEnv() {
+		proxyEnv += fmt.Sprintf("export %s=\"%s\"; ", v.Name, escapeDoubleQuoted(v.Value))
+	}
+	cmd, err := h.GetSSHCommand(fmt.Sprintf("if [ ! -e /usr/bin/docker ]; then %scurl -sSL https://get.docker.com | sh -; fi", proxyEnv))
 	if err != nil {
 		return err
 	}
@@ -677,6 +875,314 @@ func (h *Host) Remove(force bool) error {
 	return h.removeStorePath()
 }
 
+// Close releases what the driver holds while the host is in use, such as
+// the process of a driver plugin. The host can be used again afterwards.
+func (h *Host) Close() error {
+	if c, ok := h.Driver.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// OpenPorts authorizes access to ports on the host through its driver and
+// records them, since drivers cannot list the ports they have opened. A
+// port opened again with another CIDR has its previous rule removed first;
+// one already open to the same CIDR is left as it is.
+func (h *Host) OpenPorts(ports []*drivers.Port) error {
+	opened := []*drivers.Port{}
+	replaced := []*drivers.Port{}
+	for _, p := range ports {
+		recorded := h.findPort(p)
+		if recorded != nil && recorded.CIDR == p.CIDR {
+			continue
+		}
+		if recorded != nil {
+			replaced = append(replaced, recorded)
+		}
+		opened = append(removePort(opened, p), p)
+	}
+	if len(opened) == 0 {
+		return nil
+	}
+
+	if len(replaced) > 0 {
+		if err := h.Driver.DeauthorizePort(replaced); err != nil {
+			return err
+		}
+		for _, p := range replaced {
+			h.Ports = removePort(h.Ports, p)
+		}
+		if err := h.SaveConfig(); err != nil {
+			return err
+		}
+	}
+
+	if err := h.Driver.AuthorizePort(opened); err != nil {
+		return err
+	}
+
+	for _, p := range opened {
+		h.Ports = append(removePort(h.Ports, p), p)
+	}
+	return h.SaveConfig()
+}
+
+// ClosePorts removes access to ports opened with OpenPorts, using the CIDR
+// they were opened with
+func (h *Host) ClosePorts(ports []*drivers.Port) error {
+	closed := []*drivers.Port{}
+	for _, p := range ports {
+		if recorded := h.findPort(p); recorded != nil {
+			p = recorded
+		}
+		closed = append(closed, p)
+	}
+
+	if err := h.Driver.DeauthorizePort(closed); err != nil {
+		return err
+	}
+
+	for _, p := range closed {
+		h.Ports = removePort(h.Ports, p)
+	}
+	return h.SaveConfig()
+}
+
+// findPort returns the recorded port with the number and protocol of port
+func (h *Host) findPort(port *drivers.Port) *drivers.Port {
+	for _, p := range h.Ports {
+		if p.Port == port.Port && p.Protocol == port.Protocol {
+			return p
+		}
+	}
+	return nil
+}
+
+func removePort(ports []*drivers.Port, port *drivers.Port) []*drivers.Port {
+	remaining := []*drivers.Port{}
+	for _, p := range ports {
+		if p.Port != port.Port || p.Protocol != port.Protocol {
+			remaining = append(remaining, p)
+		}
+	}
+	return remaining
+}
+
+// AddShare shares a host directory with the machine, stopping and
+// restarting it if it is running
+func (h *Host) AddShare(hostPath string, guestPath string) error {
+	return h.changeShares(func(sharer drivers.Sharer) error {
+		return sharer.AddShare(hostPath, guestPath)
+	})
+}
+
+// RemoveShare stops sharing a directory with the machine, stopping and
+// restarting it if it is running
+func (h *Host) RemoveShare(path string) error {
+	return h.changeShares(func(sharer drivers.Sharer) error {
+		return sharer.RemoveShare(path)
+	})
+}
+
+// ListShares returns the directories shared with the machine
+func (h *Host) ListShares() ([]*drivers.Share, error) {
+	sharer, ok := h.Driver.(drivers.Sharer)
+	if !ok {
+		return nil, fmt.Errorf("driver %s does not support shared folders", h.DriverName)
+	}
+	return sharer.ListShares(), nil
+}
+
+func (h *Host) changeShares(change func(drivers.Sharer) error) error {
+	sharer, ok := h.Driver.(drivers.Sharer)
+	if !ok {
+		return fmt.Errorf("driver %s does not support shared folders", h.DriverName)
+	}
+
+	return h.changeStopped("change its shared folders", func() error {
+		return change(sharer)
+	})
+}
+
+// changeStopped applies a change to the driver while the machine is stopped
+// and saves the changed configuration. A running machine is stopped first
+// and started again afterwards, also when the change failed.
+func (h *Host) changeStopped(reason string, change func() error) error {
+	currentState, err := h.Driver.GetState()
+	if err != nil {
+		return err
+	}
+	if currentState == state.Running {
+		log.Infof("Stopping %s to %s...", h.Name, reason)
+		if err := h.Stop(); err != nil {
+			return err
+		}
+	}
+
+	err = change()
+	if err == nil {
+		err = h.SaveConfig()
+	}
+
+	if currentState == state.Running {
+		log.Infof("Starting %s...", h.Name)
+		if startErr := h.Start(); startErr != nil && err == nil {
+			err = startErr
+		}
+	}
+	return err
+}
+
+// Resize changes the CPUs, memory or instance size of the machine, stopping
+// and restarting it if it is running
+func (h *Host) Resize(cpus int, memory int, size string) error {
+	resizer, ok := h.Driver.(drivers.Resizer)
+	if !ok {
+		return fmt.Errorf("driver %s does not support resizing", h.DriverName)
+	}
+	if cpus < 0 || memory < 0 {
+		return fmt.Errorf("the number of CPUs and the memory must be positive")
+	}
+	if cpus == 0 && memory == 0 && size == "" {
+		return fmt.Errorf("nothing to resize: the CPUs, memory or size must be given")
+	}
+
+	return h.changeStopped("resize it", func() error {
+		return resizer.Resize(cpus, memory, size)
+	})
+}
+
+func (h *Host) snapshotter() (drivers.Snapshotter, error) {
+	snapshotter, ok := h.Driver.(drivers.Snapshotter)
+	if !ok {
+		return nil, fmt.Errorf("driver %s does not support snapshots", h.DriverName)
+	}
+	return snapshotter, nil
+}
+
+// SaveSnapshot saves the state of the machine as tag
+func (h *Host) SaveSnapshot(tag string) error {
+	snapshotter, err := h.snapshotter()
+	if err != nil {
+		return err
+	}
+	return snapshotter.CreateSnapshot(tag)
+}
+
+// ListSnapshots returns the snapshots of the machine
+func (h *Host) ListSnapshots() ([]*drivers.Snapshot, error) {
+	snapshotter, err := h.snapshotter()
+	if err != nil {
+		return nil, err
+	}
+	return snapshotter.ListSnapshots()
+}
+
+// RemoveSnapshot deletes the snapshot saved as tag
+func (h *Host) RemoveSnapshot(tag string) error {
+	snapshotter, err := h.snapshotter()
+	if err != nil {
+		return err
+	}
+	return snapshotter.RemoveSnapshot(tag)
+}
+
+// RestoreSnapshot returns the machine to the state saved as tag. A running
+// machine is stopped first and started again afterwards. As the snapshot may
+// predate the machine's current IP or certificates, the certificates are
+// regenerated if they no longer match.
+func (h *Host) RestoreSnapshot(tag string) error {
+	snapshotter, err := h.snapshotter()
+	if err != nil {
+		return err
+	}
+
+	currentState, err := h.Driver.GetState()
+	if err != nil {
+		return err
+	}
+	if currentState == state.Running {
+		log.Infof("Stopping %s to restore snapshot %s...", h.Name, tag)
+		if err := h.Stop(); err != nil {
+			return err
+		}
+	}
+
+	if err := snapshotter.RestoreSnapshot(tag); err != nil {
+		return err
+	}
+	// the driver may record the volumes it replaced
+	if err := h.SaveConfig(); err != nil {
+		return err
+	}
+
+	// the machine is started to check it, also when it was stopped before;
+	// a snapshot of a running machine is restored in the saved state, while
+	// some cloud providers boot the machine when restoring it
+	restoredState, err := h.Driver.GetState()
+	if err != nil {
+		return err
+	}
+	if restoredState != state.Running {
+		if err := h.Start(); err != nil {
+			return err
+		}
+	}
+	if err := WaitForSSH(h); err != nil {
+		return err
+	}
+
+	matches, err := h.certsMatch()
+	if err != nil {
+		return err
+	}
+	if !matches {
+		log.Warnf("The IP or certificates of %s changed since snapshot %s; regenerating certificates...", h.Name, tag)
+		if err := h.ConfigureAuth(); err != nil {
+			return err
+		}
+	}
+
+	if currentState != state.Running {
+		return h.Stop()
+	}
+	return nil
+}
+
+// certsMatch reports whether the server certificate was generated for the
+// current IP of the running machine and the machine still uses it
+func (h *Host) certsMatch() (bool, error) {
+	ip, err := h.Driver.GetIP()
+	if err != nil {
+		return false, err
+	}
+
+	serverCertPath := filepath.Join(h.storePath, "server.pem")
+	hasIP, err := utils.CertHasHost(serverCertPath, ip)
+	if err != nil || !hasIP {
+		return false, err
+	}
+
+	serverCert, err := ioutil.ReadFile(serverCertPath)
+	if err != nil {
+		return false, err
+	}
+
+	dockerDir, err := h.GetDockerConfigDir()
+	if err != nil {
+		return false, err
+	}
+	cmd, err := h.GetSSHCommand(fmt.Sprintf("sudo cat %s", path.Join(dockerDir, "server.pem")))
+	if err != nil {
+		return false, err
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return false, nil
+	}
+	return strings.Contains(string(out), strings.TrimSpace(string(serverCert))), nil
+}
+
 func (h *Host) removeStorePath() error {
 	file, err := os.Stat(h.storePath)
 	if err != nil {
@@ -7,6 +7,7 @@ import (
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/codegangsta/cli"
+	"github.com/docker/machine/drivers"
 	"github.com/docker/machine/utils"
 )
 
@@ -16,6 +17,9 @@ func main() {
 			os.Setenv("DEBUG", "1")
 			initLogging(log.DebugLevel)
 		}
+		if f == "--offline" || f == "-offline" {
+			os.Setenv("MACHINE_OFFLINE", "1")
+		}
 	}
 
 	app := cli.NewApp()
@@ -32,6 +36,11 @@ func main() {
 			Name:  "debug, D",
 			Usage: "Enable debug mode",
 		},
+		cli.BoolFlag{
+			EnvVar: "MACHINE_OFFLINE",
+			Name:   "offline",
+			Usage:  "Use cached boot2docker ISOs instead of downloading them",
+		},
 		cli.StringFlag{
 			EnvVar: "MACHINE_STORAGE_PATH",
 			Name:   "storage-path",
@@ -64,5 +73,10 @@ func main() {
 		},
 	}
 
+	app.Before = func(c *cli.Context) error {
+		addPluginCreateFlags(c.App, c.Args(), drivers.GetPluginCreateFlags)
+		return nil
+	}
+
 	app.Run(os.Args)
 }
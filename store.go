@@ -36,14 +36,36 @@ func (s *Store) Create(name string, driverName string, flags drivers.DriverOptio
 		return nil, fmt.Errorf("Machine %s already exists", name)
 	}
 
+	if flags.Bool("swarm") {
+		discovery := flags.String("swarm-discovery")
+		if isGeneratedDiscovery(discovery) {
+			return nil, fmt.Errorf("generated %s discovery is only supported for swarms created with the swarm command", discovery)
+		}
+		if err := validateSwarmDiscovery(discovery); err != nil {
+			return nil, err
+		}
+		if strategy := flags.String("swarm-strategy"); strategy != "" {
+			if err := ValidateSwarmStrategy(strategy); err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	hostPath := filepath.Join(s.Path, name)
 
 	host, err := NewHost(name, driverName, hostPath, s.CaCertPath, s.PrivateKeyPath, flags.Bool("swarm-master"), flags.String("swarm-host"), flags.String("swarm-discovery"))
-	// architecture identifier
-	host.arch = flags.String("arch")
 	if err != nil {
 		return host, err
 	}
+	// architecture identifier
+	host.arch = flags.String("arch")
+	host.SwarmImage = flags.String("swarm-image")
+	host.SwarmStrategy = flags.String("swarm-strategy")
+	host.SwarmOpts = flags.StringSlice("swarm-opt")
+	host.EngineLabels = flags.StringSlice("engine-label")
+	host.EngineHttpProxy = flags.String("engine-http-proxy")
+	host.EngineHttpsProxy = flags.String("engine-https-proxy")
+	host.EngineNoProxy = flags.String("engine-no-proxy")
 	if flags != nil {
 		if err := host.Driver.SetConfigFromFlags(flags); err != nil {
 			return host, err
@@ -101,6 +123,8 @@ func (s *Store) Remove(name string, force bool) error {
 	if err != nil {
 		return err
 	}
+	defer host.Close()
+
 	return host.Remove(force)
 }
 
@@ -173,6 +197,368 @@ func (s *Store) RemoveActive() error {
 	return os.Remove(s.activePath())
 }
 
+func (s *Store) CreateSwarm(name string, driverName string, size int, discovery string, swarmHost string, flags flagValues) (*Swarm, error) {
+	if _, err := ValidateHostName(name); err != nil {
+		return nil, err
+	}
+
+	if size < 1 {
+		return nil, fmt.Errorf("A swarm needs at least one machine")
+	}
+
+	exists, err := s.SwarmExists(name)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, fmt.Errorf("Swarm %s already exists", name)
+	}
+
+	if discovery == "" {
+		log.Info("Creating Swarm discovery token...")
+		discovery, err = createSwarmDiscoveryToken()
+		if err != nil {
+			return nil, fmt.Errorf("error creating swarm discovery token: %s", err)
+		}
+	} else if err := validateSwarmDiscovery(discovery); err != nil {
+		return nil, err
+	}
+
+	if strategy := flags.String("swarm-strategy"); strategy != "" {
+		if err := ValidateSwarmStrategy(strategy); err != nil {
+			return nil, err
+		}
+	}
+
+	swarm := NewSwarm(name, driverName, discovery, swarmHost, filepath.Join(s.swarmsPath(), name), flags)
+	if err := swarm.SaveConfig(); err != nil {
+		return nil, err
+	}
+
+	// the master has to be up before any node tries to join
+	master := swarm.masterName()
+	log.Infof("Creating Swarm master %s...", master)
+	host, err := s.Create(master, driverName, swarm.nodeOptions(true))
+	if host != nil {
+		host.Close()
+	}
+	if exists, _ := s.Exists(master); exists {
+		swarm.Master = master
+		if err := swarm.SaveConfig(); err != nil {
+			return swarm, err
+		}
+	}
+	if err != nil {
+		return swarm, fmt.Errorf("error creating swarm master: %s", err)
+	}
+
+	if err := s.createSwarmNodes(swarm, size-1); err != nil {
+		return swarm, err
+	}
+
+	return swarm, s.configureSwarmDiscovery(swarm, true)
+}
+
+// ScaleSwarm creates or removes nodes until the swarm has the given number
+// of machines. The master is never removed.
+func (s *Store) ScaleSwarm(swarm *Swarm, size int) error {
+	if size < 1 {
+		return fmt.Errorf("A swarm needs at least one machine")
+	}
+
+	// forget about nodes which have been removed outside of the swarm
+	for _, name := range swarm.Nodes {
+		if exists, err := s.Exists(name); err == nil && !exists {
+			log.Warnf("Machine %s no longer exists, removing it from swarm %s", name, swarm.Name)
+			swarm.removeNode(name)
+		}
+	}
+
+	var err error
+	switch current := swarm.Size(); {
+	case size > current:
+		err = s.createSwarmNodes(swarm, size-current)
+	case size < current:
+		err = s.removeSwarmNodes(swarm, swarm.Nodes[len(swarm.Nodes)-(current-size):], false)
+	default:
+		err = swarm.SaveConfig()
+	}
+
+	// update the discovery data even if some nodes failed, so that the
+	// master knows about those which succeeded
+	if discoveryErr := s.configureSwarmDiscovery(swarm, false); discoveryErr != nil && err == nil {
+		err = discoveryErr
+	}
+	return err
+}
+
+// RemoveSwarm removes every machine in the swarm and then the swarm itself
+func (s *Store) RemoveSwarm(name string, force bool) error {
+	swarm, err := s.LoadSwarm(name)
+	if err != nil {
+		return err
+	}
+
+	if err := s.removeSwarmNodes(swarm, swarm.Nodes, force); err != nil {
+		return err
+	}
+
+	if swarm.Master != "" {
+		if err := s.removeSwarmMachine(swarm.Master, force); err != nil {
+			return fmt.Errorf("error removing swarm master: %s", err)
+		}
+		swarm.Master = ""
+	}
+
+	return swarm.removeStorePath()
+}
+
+// JoinSwarm adds an existing machine to the swarm using discovery. A node of
+// a swarm created with "swarm create" is taken out of that swarm first.
+func (s *Store) JoinSwarm(name string, discovery string, master bool, swarmHost string, addr string) error {
+	if err := validateSwarmDiscovery(discovery); err != nil {
+		return err
+	}
+	if isGeneratedDiscovery(discovery) {
+		return fmt.Errorf("%s discovery is only supported by \"swarm create\"", discovery)
+	}
+
+	host, err := s.Load(name)
+	if err != nil {
+		return err
+	}
+	defer host.Close()
+
+	if err := s.detachSwarmMachine(name); err != nil {
+		return err
+	}
+
+	return host.JoinSwarm(discovery, master, swarmHost, addr)
+}
+
+// LeaveSwarm removes a machine from its swarm
+func (s *Store) LeaveSwarm(name string) error {
+	host, err := s.Load(name)
+	if err != nil {
+		return err
+	}
+	defer host.Close()
+
+	if err := s.detachSwarmMachine(name); err != nil {
+		return err
+	}
+
+	return host.LeaveSwarm()
+}
+
+// detachSwarmMachine removes a node from the swarm definition it belongs to,
+// if any. The master of a swarm cannot leave it; the swarm is removed instead.
+func (s *Store) detachSwarmMachine(name string) error {
+	swarms, err := s.ListSwarms()
+	if err != nil {
+		return err
+	}
+
+	for i := range swarms {
+		swarm := &swarms[i]
+		if swarm.Master == name {
+			return fmt.Errorf("%s is the master of swarm %s; use \"swarm rm\" to remove the swarm", name, swarm.Name)
+		}
+		if !swarm.hasNode(name) {
+			continue
+		}
+
+		swarm.removeNode(name)
+		if err := swarm.SaveConfig(); err != nil {
+			return err
+		}
+		return s.configureSwarmDiscovery(swarm, false)
+	}
+	return nil
+}
+
+func (s *Store) ListSwarms() ([]Swarm, error) {
+	dir, err := ioutil.ReadDir(s.swarmsPath())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	swarms := []Swarm{}
+
+	for _, file := range dir {
+		if file.IsDir() {
+			swarm, err := s.LoadSwarm(file.Name())
+			if err != nil {
+				log.Errorf("error loading swarm %q: %s", file.Name(), err)
+				continue
+			}
+			swarms = append(swarms, *swarm)
+		}
+	}
+	return swarms, nil
+}
+
+func (s *Store) SwarmExists(name string) (bool, error) {
+	_, err := os.Stat(filepath.Join(s.swarmsPath(), name))
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err == nil {
+		return true, nil
+	}
+	return false, err
+}
+
+func (s *Store) LoadSwarm(name string) (*Swarm, error) {
+	return LoadSwarm(name, filepath.Join(s.swarmsPath(), name))
+}
+
+// configureSwarmDiscovery generates nodes:// or file:// discovery data from
+// the machines in the swarm and hands it to the master. A nodes:// master is
+// restarted with the new node list; a file:// master rereads the uploaded
+// file by itself, so it is only started when the swarm is created.
+func (s *Store) configureSwarmDiscovery(swarm *Swarm, startMaster bool) error {
+	if !isGeneratedDiscovery(swarm.Discovery) || swarm.Master == "" {
+		return nil
+	}
+
+	log.Info("Configuring Swarm discovery...")
+
+	hosts := []*Host{}
+	defer func() {
+		for _, host := range hosts {
+			host.Close()
+		}
+	}()
+
+	addrs := []string{}
+	for _, name := range swarm.Machines() {
+		host, err := s.Load(name)
+		if err != nil {
+			return err
+		}
+		hosts = append(hosts, host)
+		addr, err := host.GetSwarmAddr()
+		if err != nil {
+			return err
+		}
+		addrs = append(addrs, addr)
+	}
+
+	var discovery string
+	switch swarm.Discovery {
+	case "nodes://":
+		discovery = fmt.Sprintf("nodes://%s", strings.Join(addrs, ","))
+		startMaster = true
+	case "file://":
+		// every node gets a copy so that any of them can become the master
+		for _, host := range hosts {
+			discoveryFile, err := host.UploadSwarmDiscoveryFile(addrs)
+			if err != nil {
+				return fmt.Errorf("error uploading swarm discovery file to %s: %s", host.Name, err)
+			}
+			discovery = fmt.Sprintf("file://%s", discoveryFile)
+		}
+	}
+
+	if !startMaster {
+		return nil
+	}
+
+	master := hosts[0]
+	return master.ConfigureSwarm(discovery, true, swarm.Host, "")
+}
+
+// createSwarmNodes creates count new nodes in the swarm in parallel. Nodes
+// which were only partially created are still recorded so that removing the
+// swarm cleans them up.
+func (s *Store) createSwarmNodes(swarm *Swarm, count int) error {
+	names := s.newSwarmNodeNames(swarm, count)
+
+	failed := runSwarmNodeAction(swarm.DriverName, names, func(name string) error {
+		log.Infof("Creating Swarm node %s...", name)
+		host, err := s.Create(name, swarm.DriverName, swarm.nodeOptions(false))
+		if host != nil {
+			host.Close()
+		}
+		return err
+	})
+
+	for _, name := range names {
+		if exists, _ := s.Exists(name); exists {
+			swarm.addNode(name)
+		}
+	}
+
+	if err := swarm.SaveConfig(); err != nil {
+		return err
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("error creating swarm nodes: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func (s *Store) removeSwarmNodes(swarm *Swarm, names []string, force bool) error {
+	// copy the names as removing nodes modifies swarm.Nodes
+	names = append([]string{}, names...)
+
+	failed := runSwarmNodeAction(swarm.DriverName, names, func(name string) error {
+		log.Infof("Removing Swarm node %s...", name)
+		return s.removeSwarmMachine(name, force)
+	})
+
+	for _, name := range names {
+		if exists, _ := s.Exists(name); !exists {
+			swarm.removeNode(name)
+		}
+	}
+
+	if err := swarm.SaveConfig(); err != nil {
+		return err
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("error removing swarm nodes: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// removeSwarmMachine removes a machine, ignoring machines that are already gone
+func (s *Store) removeSwarmMachine(name string, force bool) error {
+	exists, err := s.Exists(name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+	return s.Remove(name, force)
+}
+
+// newSwarmNodeNames returns count node names which are neither in the swarm
+// nor used by another machine
+func (s *Store) newSwarmNodeNames(swarm *Swarm, count int) []string {
+	names := []string{}
+	for i := 0; len(names) < count; i++ {
+		name := fmt.Sprintf("%s-node-%02d", swarm.Name, i)
+		if swarm.hasNode(name) {
+			continue
+		}
+		if exists, err := s.Exists(name); err != nil || exists {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// swarmsPath returns the path to the directory that stores the swarm
+// definitions
+func (s *Store) swarmsPath() string {
+	return filepath.Join(s.Path, ".swarms")
+}
+
 // activePath returns the path to the file that stores the name of the
 // active host
 func (s *Store) activePath() string {
@@ -24,6 +24,10 @@ func (d DriverOptionsMock) String(key string) string {
 	return d.Data[key].(string)
 }
 
+func (d DriverOptionsMock) StringSlice(key string) []string {
+	return d.Data[key].([]string)
+}
+
 func (d DriverOptionsMock) Int(key string) int {
 	return d.Data[key].(int)
 }
@@ -39,12 +43,19 @@ func clearHosts() error {
 func getDefaultTestDriverFlags() *DriverOptionsMock {
 	return &DriverOptionsMock{
 		Data: map[string]interface{}{
-			"name":            "test",
-			"url":             "unix:///var/run/docker.sock",
-			"swarm":           false,
-			"swarm-host":      "",
-			"swarm-master":    false,
-			"swarm-discovery": "",
+			"name":               "test",
+			"url":                "unix:///var/run/docker.sock",
+			"swarm":              false,
+			"swarm-host":         "",
+			"swarm-master":       false,
+			"swarm-discovery":    "",
+			"swarm-image":        "swarm:latest",
+			"swarm-strategy":     "spread",
+			"swarm-opt":          []string{},
+			"engine-label":       []string{},
+			"engine-http-proxy":  "",
+			"engine-https-proxy": "",
+			"engine-no-proxy":    "",
 		},
 	}
 }
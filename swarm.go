@@ -0,0 +1,312 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+)
+
+// Swarm is a cluster of machines which is created, scaled and removed as a
+// unit. The master is always created first and is never scaled away.
+type Swarm struct {
+	Name          string `json:"-"`
+	DriverName    string
+	Discovery     string
+	Host          string
+	Master        string
+	Nodes         []string
+	DriverOptions flagValues
+	storePath     string
+}
+
+// flagValues is a snapshot of command line flags which can be persisted and
+// later handed to a driver in place of the original cli.Context.
+type flagValues map[string]interface{}
+
+func (f flagValues) String(key string) string {
+	if v, ok := f[key].(string); ok {
+		return v
+	}
+	return ""
+}
+
+func (f flagValues) StringSlice(key string) []string {
+	switch v := f[key].(type) {
+	case []string:
+		return v
+	case []interface{}:
+		// slices come back from config.json as []interface{}
+		values := []string{}
+		for _, value := range v {
+			if s, ok := value.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func (f flagValues) Int(key string) int {
+	switch v := f[key].(type) {
+	case int:
+		return v
+	case float64:
+		// numbers come back from config.json as float64
+		return int(v)
+	}
+	return 0
+}
+
+func (f flagValues) Bool(key string) bool {
+	if v, ok := f[key].(bool); ok {
+		return v
+	}
+	return false
+}
+
+// copy returns a copy of the values with the given overrides applied
+func (f flagValues) copy(overrides flagValues) flagValues {
+	values := flagValues{}
+	for k, v := range f {
+		values[k] = v
+	}
+	for k, v := range overrides {
+		values[k] = v
+	}
+	return values
+}
+
+// getFlagValues reads the current value of each flag from the context
+func getFlagValues(c *cli.Context, flags []cli.Flag) flagValues {
+	values := flagValues{}
+	for _, flag := range flags {
+		switch f := flag.(type) {
+		case cli.StringFlag:
+			name := flagName(f.Name)
+			values[name] = c.String(name)
+		case cli.StringSliceFlag:
+			name := flagName(f.Name)
+			values[name] = c.StringSlice(name)
+		case cli.IntFlag:
+			name := flagName(f.Name)
+			values[name] = c.Int(name)
+		case cli.BoolFlag:
+			name := flagName(f.Name)
+			values[name] = c.Bool(name)
+		}
+	}
+	return values
+}
+
+// flagName strips the short aliases from a flag name, e.g. "driver, d"
+func flagName(name string) string {
+	return strings.TrimSpace(strings.Split(name, ",")[0])
+}
+
+func NewSwarm(name, driverName, discovery, host, storePath string, options flagValues) *Swarm {
+	return &Swarm{
+		Name:          name,
+		DriverName:    driverName,
+		Discovery:     discovery,
+		Host:          host,
+		Nodes:         []string{},
+		DriverOptions: options,
+		storePath:     storePath,
+	}
+}
+
+func LoadSwarm(name string, storePath string) (*Swarm, error) {
+	if _, err := os.Stat(storePath); os.IsNotExist(err) {
+		return nil, fmt.Errorf("Swarm %q does not exist", name)
+	}
+
+	swarm := &Swarm{Name: name, storePath: storePath}
+	if err := swarm.LoadConfig(); err != nil {
+		return nil, err
+	}
+	return swarm, nil
+}
+
+// Size returns the number of machines in the swarm, including the master
+func (s *Swarm) Size() int {
+	size := len(s.Nodes)
+	if s.Master != "" {
+		size++
+	}
+	return size
+}
+
+// Machines returns the names of all machines in the swarm, master first
+func (s *Swarm) Machines() []string {
+	machines := []string{}
+	if s.Master != "" {
+		machines = append(machines, s.Master)
+	}
+	return append(machines, s.Nodes...)
+}
+
+func (s *Swarm) masterName() string {
+	return fmt.Sprintf("%s-master", s.Name)
+}
+
+func (s *Swarm) hasNode(name string) bool {
+	for _, n := range s.Nodes {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Swarm) addNode(name string) {
+	if !s.hasNode(name) {
+		s.Nodes = append(s.Nodes, name)
+	}
+}
+
+func (s *Swarm) removeNode(name string) {
+	nodes := []string{}
+	for _, n := range s.Nodes {
+		if n != name {
+			nodes = append(nodes, n)
+		}
+	}
+	s.Nodes = nodes
+}
+
+// nodeOptions returns the driver options used to create a machine in the
+// swarm. Generated discovery is configured once all machines exist.
+func (s *Swarm) nodeOptions(master bool) flagValues {
+	return s.DriverOptions.copy(flagValues{
+		"swarm":           !isGeneratedDiscovery(s.Discovery),
+		"swarm-master":    master,
+		"swarm-discovery": s.Discovery,
+		"swarm-host":      s.Host,
+		"swarm-addr":      "",
+	})
+}
+
+func (s *Swarm) LoadConfig() error {
+	data, err := ioutil.ReadFile(filepath.Join(s.storePath, "config.json"))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &s)
+}
+
+func (s *Swarm) SaveConfig() error {
+	if err := os.MkdirAll(s.storePath, 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(s.storePath, "config.json"), data, 0600); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Swarm) removeStorePath() error {
+	return os.RemoveAll(s.storePath)
+}
+
+// createSwarmDiscoveryToken registers a new cluster with the discovery
+// service and returns its token:// URL
+func createSwarmDiscoveryToken() (string, error) {
+	rsp, err := http.Post(fmt.Sprintf("%s/clusters", swarmDiscoveryServiceEndpoint), "text/plain", nil)
+	if err != nil {
+		return "", err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK && rsp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("unexpected response from discovery service: %s", rsp.Status)
+	}
+
+	token, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("token://%s", strings.TrimSpace(string(token))), nil
+}
+
+// runSwarmNodeAction runs action for each of the named machines and returns
+// the names for which it failed. Actions run concurrently except for
+// VirtualBox, which is temperamental about doing things concurrently.
+func runSwarmNodeAction(driverName string, names []string, action func(name string) error) []string {
+	type result struct {
+		name string
+		err  error
+	}
+
+	var (
+		failed  = []string{}
+		pending = 0
+		results = make(chan result)
+	)
+
+	collect := func() {
+		r := <-results
+		pending--
+		if r.err != nil {
+			log.Errorf("%s: %s", r.name, r.err)
+			failed = append(failed, r.name)
+		}
+	}
+
+	for _, name := range names {
+		pending++
+		go func(name string) {
+			results <- result{name, action(name)}
+		}(name)
+
+		if driverName == "virtualbox" {
+			collect()
+		}
+	}
+
+	for pending > 0 {
+		collect()
+	}
+
+	close(results)
+	return failed
+}
+
+// validateSwarmDiscovery checks that discovery is a discovery URL swarm
+// understands
+func validateSwarmDiscovery(discovery string) error {
+	u, err := url.Parse(discovery)
+	if err != nil {
+		return fmt.Errorf("invalid swarm discovery %q: %s", discovery, err)
+	}
+	switch u.Scheme {
+	case "token", "nodes", "file", "etcd", "consul", "zk":
+		return nil
+	}
+	return fmt.Errorf("invalid swarm discovery %q: unsupported scheme %q", discovery, u.Scheme)
+}
+
+// isStaticDiscovery reports whether the discovery lists the swarm nodes
+// itself, in which case the nodes do not need to join
+func isStaticDiscovery(discovery string) bool {
+	return strings.HasPrefix(discovery, "nodes://") || strings.HasPrefix(discovery, "file://")
+}
+
+// isGeneratedDiscovery reports whether the discovery data is generated by
+// machine from the machines in the swarm, i.e. "nodes://" or "file://"
+// without any addresses or path
+func isGeneratedDiscovery(discovery string) bool {
+	return discovery == "nodes://" || discovery == "file://"
+}
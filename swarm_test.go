@@ -0,0 +1,345 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/codegangsta/cli"
+)
+
+func getTestSwarmStore(t *testing.T) *Store {
+	tmpDir, err := ioutil.TempDir("", "machine-swarm-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewStore(tmpDir, hostTestCaCert, hostTestPrivateKey)
+}
+
+func TestFlagValues(t *testing.T) {
+	set := flag.NewFlagSet("create", 0)
+	set.String("driver", "", "")
+	set.Int("virtualbox-memory", 0, "")
+	set.Bool("swarm", false, "")
+	set.Parse([]string{"--driver", "virtualbox", "--virtualbox-memory", "2048", "--swarm"})
+	c := cli.NewContext(nil, set, set)
+
+	values := getFlagValues(c, []cli.Flag{
+		cli.StringFlag{Name: "driver, d"},
+		cli.IntFlag{Name: "virtualbox-memory"},
+		cli.BoolFlag{Name: "swarm"},
+	})
+
+	if values.String("driver") != "virtualbox" {
+		t.Fatalf("expected driver virtualbox; received %q", values.String("driver"))
+	}
+	if values.Int("virtualbox-memory") != 2048 {
+		t.Fatalf("expected memory 2048; received %d", values.Int("virtualbox-memory"))
+	}
+	if !values.Bool("swarm") {
+		t.Fatal("expected swarm to be set")
+	}
+
+	// values are read back from config.json as float64
+	values["virtualbox-memory"] = float64(1024)
+	if values.Int("virtualbox-memory") != 1024 {
+		t.Fatalf("expected memory 1024; received %d", values.Int("virtualbox-memory"))
+	}
+
+	// slices are read back from config.json as []interface{}
+	values["engine-label"] = []interface{}{"storage=ssd", "zone=us-east"}
+	if labels := values.StringSlice("engine-label"); len(labels) != 2 || labels[1] != "zone=us-east" {
+		t.Fatalf("unexpected engine labels %v", labels)
+	}
+
+	if values.String("missing") != "" || values.Int("missing") != 0 || values.Bool("missing") {
+		t.Fatal("expected zero values for missing flags")
+	}
+}
+
+func TestSwarmNodeOptions(t *testing.T) {
+	swarm := NewSwarm("test", "none", "token://abc", "tcp://0.0.0.0:3376", "", flagValues{"url": "tcp://1.2.3.4:2376"})
+
+	master := swarm.nodeOptions(true)
+	if !master.Bool("swarm") || !master.Bool("swarm-master") {
+		t.Fatal("expected master options to configure a swarm master")
+	}
+	if master.String("swarm-discovery") != "token://abc" {
+		t.Fatalf("unexpected discovery %q", master.String("swarm-discovery"))
+	}
+	if master.String("url") != "tcp://1.2.3.4:2376" {
+		t.Fatal("expected driver options to be passed through")
+	}
+
+	node := swarm.nodeOptions(false)
+	if node.Bool("swarm-master") {
+		t.Fatal("expected node options not to configure a master")
+	}
+
+	if _, ok := swarm.DriverOptions["swarm"]; ok {
+		t.Fatal("expected node options not to modify the swarm driver options")
+	}
+}
+
+func TestSwarmSaveLoad(t *testing.T) {
+	store := getTestSwarmStore(t)
+	defer os.RemoveAll(store.Path)
+
+	swarm := NewSwarm("test", "virtualbox", "token://abc", "tcp://0.0.0.0:3376",
+		filepath.Join(store.swarmsPath(), "test"), flagValues{"virtualbox-memory": 2048})
+	swarm.Master = "test-master"
+	swarm.addNode("test-node-00")
+	swarm.addNode("test-node-01")
+
+	if err := swarm.SaveConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	exists, err := store.SwarmExists("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists {
+		t.Fatal("expected swarm to exist")
+	}
+
+	loaded, err := store.LoadSwarm("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.Name != "test" || loaded.DriverName != "virtualbox" || loaded.Discovery != "token://abc" {
+		t.Fatalf("unexpected swarm loaded: %+v", loaded)
+	}
+	if loaded.Size() != 3 {
+		t.Fatalf("expected size 3; received %d", loaded.Size())
+	}
+	if machines := loaded.Machines(); machines[0] != "test-master" {
+		t.Fatalf("expected master first; received %v", machines)
+	}
+	if loaded.DriverOptions.Int("virtualbox-memory") != 2048 {
+		t.Fatal("expected driver options to be persisted")
+	}
+
+	swarms, err := store.ListSwarms()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(swarms) != 1 {
+		t.Fatalf("ListSwarms returned %d items", len(swarms))
+	}
+
+	// swarm definitions must not show up as machines
+	hosts, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 0 {
+		t.Fatalf("List returned %d items", len(hosts))
+	}
+}
+
+func TestLoadSwarmDoesNotExist(t *testing.T) {
+	store := getTestSwarmStore(t)
+	defer os.RemoveAll(store.Path)
+
+	if _, err := store.LoadSwarm("nope"); err == nil {
+		t.Fatal("expected error for non-existent swarm")
+	}
+}
+
+func TestNewSwarmNodeNames(t *testing.T) {
+	store := getTestSwarmStore(t)
+	defer os.RemoveAll(store.Path)
+
+	// a machine outside of the swarm already uses the first free name
+	if err := os.MkdirAll(filepath.Join(store.Path, "test-node-01"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	swarm := NewSwarm("test", "none", "", "", "", flagValues{})
+	swarm.addNode("test-node-00")
+
+	names := store.newSwarmNodeNames(swarm, 2)
+	expected := []string{"test-node-02", "test-node-03"}
+	if len(names) != len(expected) || names[0] != expected[0] || names[1] != expected[1] {
+		t.Fatalf("expected names %v; received %v", expected, names)
+	}
+}
+
+func TestSwarmRemoveNode(t *testing.T) {
+	swarm := NewSwarm("test", "none", "", "", "", flagValues{})
+	swarm.addNode("test-node-00")
+	swarm.addNode("test-node-00")
+	swarm.addNode("test-node-01")
+
+	if len(swarm.Nodes) != 2 {
+		t.Fatalf("expected 2 nodes; received %v", swarm.Nodes)
+	}
+
+	swarm.removeNode("test-node-00")
+	if len(swarm.Nodes) != 1 || swarm.Nodes[0] != "test-node-01" {
+		t.Fatalf("unexpected nodes after remove: %v", swarm.Nodes)
+	}
+}
+
+func TestRunSwarmNodeAction(t *testing.T) {
+	for _, driverName := range []string{"none", "virtualbox"} {
+		failed := runSwarmNodeAction(driverName, []string{"a", "b", "c"}, func(name string) error {
+			if name == "b" {
+				return errors.New("failure")
+			}
+			return nil
+		})
+
+		sort.Strings(failed)
+		if len(failed) != 1 || failed[0] != "b" {
+			t.Fatalf("%s: expected only b to fail; received %v", driverName, failed)
+		}
+	}
+}
+
+func TestValidateSwarmDiscovery(t *testing.T) {
+	valid := []string{
+		"token://1257e0f0bbb499b5cd04b4c9bdb2dab3",
+		"nodes://",
+		"nodes://10.0.0.1:2376,10.0.0.2:2376",
+		"file://",
+		"file:///var/lib/boot2docker/swarm-discovery",
+		"etcd://10.0.0.1:4001/swarm",
+		"consul://10.0.0.1:8500/swarm",
+		"zk://10.0.0.1:2181,10.0.0.2:2181/swarm",
+	}
+	for _, discovery := range valid {
+		if err := validateSwarmDiscovery(discovery); err != nil {
+			t.Fatalf("expected %q to be valid: %s", discovery, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"1257e0f0bbb499b5cd04b4c9bdb2dab3",
+		"http://10.0.0.1",
+	}
+	for _, discovery := range invalid {
+		if err := validateSwarmDiscovery(discovery); err == nil {
+			t.Fatalf("expected %q to be invalid", discovery)
+		}
+	}
+}
+
+func TestGeneratedDiscovery(t *testing.T) {
+	if !isGeneratedDiscovery("nodes://") || !isGeneratedDiscovery("file://") {
+		t.Fatal("expected empty nodes:// and file:// discovery to be generated")
+	}
+	if isGeneratedDiscovery("nodes://10.0.0.1:2376") || isGeneratedDiscovery("token://abc") {
+		t.Fatal("expected discovery with addresses not to be generated")
+	}
+
+	if !isStaticDiscovery("nodes://10.0.0.1:2376") || !isStaticDiscovery("file:///tmp/cluster") {
+		t.Fatal("expected nodes:// and file:// discovery to be static")
+	}
+	if isStaticDiscovery("etcd://10.0.0.1:4001/swarm") {
+		t.Fatal("expected etcd:// discovery not to be static")
+	}
+
+	// with generated discovery the swarm is configured once all nodes exist
+	swarm := NewSwarm("test", "none", "nodes://", "tcp://0.0.0.0:3376", "", flagValues{})
+	if swarm.nodeOptions(true).Bool("swarm") {
+		t.Fatal("expected nodes not to be configured individually")
+	}
+}
+
+func createTestSwarmMachine(t *testing.T, store *Store, name string) {
+	hostPath := filepath.Join(store.Path, name)
+	if err := os.MkdirAll(hostPath, 0700); err != nil {
+		t.Fatal(err)
+	}
+	host, err := NewHost(name, "none", hostPath, hostTestCaCert, hostTestPrivateKey, false, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := host.SaveConfig(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJoinLeaveSwarm(t *testing.T) {
+	store := getTestSwarmStore(t)
+	defer os.RemoveAll(store.Path)
+
+	createTestSwarmMachine(t, store, "test")
+
+	if err := store.JoinSwarm("test", "token://abc", true, "tcp://0.0.0.0:3376", ""); err != nil {
+		t.Fatal(err)
+	}
+	host, err := store.Load("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host.SwarmDiscovery != "token://abc" || !host.SwarmMaster || host.SwarmHost != "tcp://0.0.0.0:3376" {
+		t.Fatalf("unexpected swarm configuration after join: %+v", host)
+	}
+
+	// joining again moves the machine and demotes it
+	if err := store.JoinSwarm("test", "token://def", false, "tcp://0.0.0.0:3376", ""); err != nil {
+		t.Fatal(err)
+	}
+	host, err = store.Load("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host.SwarmDiscovery != "token://def" || host.SwarmMaster {
+		t.Fatalf("unexpected swarm configuration after rejoin: %+v", host)
+	}
+
+	if err := store.LeaveSwarm("test"); err != nil {
+		t.Fatal(err)
+	}
+	host, err = store.Load("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host.SwarmDiscovery != "" || host.SwarmMaster || host.SwarmHost != "" {
+		t.Fatalf("unexpected swarm configuration after leave: %+v", host)
+	}
+
+	if err := store.JoinSwarm("test", "nodes://", false, "", ""); err == nil {
+		t.Fatal("expected error joining with generated discovery")
+	}
+}
+
+func TestLeaveManagedSwarm(t *testing.T) {
+	store := getTestSwarmStore(t)
+	defer os.RemoveAll(store.Path)
+
+	createTestSwarmMachine(t, store, "test-master")
+	createTestSwarmMachine(t, store, "test-node-00")
+
+	swarm := NewSwarm("test", "none", "token://abc", "tcp://0.0.0.0:3376",
+		filepath.Join(store.swarmsPath(), "test"), flagValues{})
+	swarm.Master = "test-master"
+	swarm.addNode("test-node-00")
+	if err := swarm.SaveConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.LeaveSwarm("test-master"); err == nil {
+		t.Fatal("expected error removing the master from its swarm")
+	}
+
+	if err := store.LeaveSwarm("test-node-00"); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := store.LoadSwarm("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.hasNode("test-node-00") {
+		t.Fatal("expected node to be removed from the swarm definition")
+	}
+}
@@ -3,8 +3,6 @@ package utils
 import (
 	"encoding/json"
 	"fmt"
-	"io"
-	"io/ioutil"
 	"net"
 	"net/http"
 	"os"
@@ -14,6 +12,10 @@ import (
 
 const (
 	timeout = time.Second * 5
+
+	// responseTimeout bounds the wait for the headers of a response once the
+	// request is sent
+	responseTimeout = time.Second * 30
 )
 
 func defaultTimeout(network, addr string) (net.Conn, error) {
@@ -22,7 +24,9 @@ func defaultTimeout(network, addr string) (net.Conn, error) {
 
 func getClient() *http.Client {
 	transport := http.Transport{
-		Dial: defaultTimeout,
+		Proxy:                 http.ProxyFromEnvironment,
+		Dial:                  defaultTimeout,
+		ResponseHeaderTimeout: responseTimeout,
 	}
 
 	client := http.Client{
@@ -56,8 +60,9 @@ func NewB2dUtils(githubApiBaseUrl, githubBaseUrl string) *B2dUtils {
 }
 
 // Get the latest boot2docker release tag name (e.g. "v0.6.0").
-// FIXME: find or create some other way to get the "latest release" of boot2docker since the GitHub API has a pretty low rate limit on API requests
-func (b *B2dUtils) GetLatestBoot2DockerReleaseURL() (string, error) {
+// The GitHub API has a pretty low rate limit on API requests, so use an
+// ISOCache to avoid asking on every create.
+func (b *B2dUtils) GetLatestBoot2DockerReleaseTag() (string, error) {
 	client := getClient()
 	apiUrl := fmt.Sprintf("%s/repos/boot2docker/boot2docker/releases", b.githubApiBaseUrl)
 	rsp, err := client.Get(apiUrl)
@@ -66,6 +71,10 @@ func (b *B2dUtils) GetLatestBoot2DockerReleaseURL() (string, error) {
 	}
 	defer rsp.Body.Close()
 
+	if rsp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected response from %s: %s", apiUrl, rsp.Status)
+	}
+
 	var t []struct {
 		TagName string `json:"tag_name"`
 	}
@@ -76,35 +85,29 @@ func (b *B2dUtils) GetLatestBoot2DockerReleaseURL() (string, error) {
 		return "", fmt.Errorf("no releases found")
 	}
 
-	tag := t[0].TagName
-	isoUrl := fmt.Sprintf("%s/boot2docker/boot2docker/releases/download/%s/boot2docker.iso", b.githubBaseUrl, tag)
-	return isoUrl, nil
+	return t[0].TagName, nil
 }
 
-// Download boot2docker ISO image for the given tag and save it at dest.
-func (b *B2dUtils) DownloadISO(dir, file, url string) error {
-	client := getClient()
-	rsp, err := client.Get(url)
-	if err != nil {
-		return err
-	}
-	defer rsp.Body.Close()
+// Get the URL of the boot2docker ISO for the given release tag.
+func (b *B2dUtils) GetBoot2DockerReleaseURL(tag string) string {
+	return fmt.Sprintf("%s/boot2docker/boot2docker/releases/download/%s/boot2docker.iso", b.githubBaseUrl, tag)
+}
 
-	// Download to a temp file first then rename it to avoid partial download.
-	f, err := ioutil.TempFile(dir, file+".tmp")
+// Get the URL of the latest boot2docker ISO.
+func (b *B2dUtils) GetLatestBoot2DockerReleaseURL() (string, error) {
+	tag, err := b.GetLatestBoot2DockerReleaseTag()
 	if err != nil {
-		return err
-	}
-	defer os.Remove(f.Name())
-	if _, err := io.Copy(f, rsp.Body); err != nil {
-		// TODO: display download progress?
-		return err
-	}
-	if err := f.Close(); err != nil {
-		return err
+		return "", err
 	}
-	if err := os.Rename(f.Name(), filepath.Join(dir, file)); err != nil {
+	return b.GetBoot2DockerReleaseURL(tag), nil
+}
+
+// Download boot2docker ISO image from url, which may also be a file:// URL or
+// a local path, and save it as file in dir. Interrupted downloads are
+// retried and resumed.
+func (b *B2dUtils) DownloadISO(dir, file, url string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
 		return err
 	}
-	return nil
+	return downloadFile(getClient(), url, filepath.Join(dir, file))
 }
@@ -0,0 +1,410 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	isoFilename         = "boot2docker.iso"
+	isoManifestFilename = "manifest.json"
+	// how long the latest release is remembered before asking GitHub again
+	latestReleaseTTL = time.Hour * 24
+)
+
+// CachedISO is a boot2docker ISO for a single release in the cache
+type CachedISO struct {
+	Version    string
+	URL        string
+	SHA256     string
+	Size       int64
+	Downloaded time.Time
+	Path       string `json:"-"`
+}
+
+type isoManifest struct {
+	ISOs          map[string]*CachedISO
+	Latest        string
+	LatestChecked time.Time
+}
+
+// ISOCache keeps boot2docker ISOs per release in
+// <dir>/boot2docker/<version>/boot2docker.iso along with a manifest of their
+// checksums. In offline mode nothing is downloaded and "latest" is the newest
+// release in the cache.
+type ISOCache struct {
+	Dir     string
+	Offline bool
+	b2d     *B2dUtils
+}
+
+func NewISOCache(dir string, b2d *B2dUtils) *ISOCache {
+	return &ISOCache{
+		Dir:     filepath.Join(dir, "boot2docker"),
+		Offline: IsOffline(),
+		b2d:     b2d,
+	}
+}
+
+// IsOffline reports whether machine should avoid the network where it can,
+// i.e. MACHINE_OFFLINE is set
+func IsOffline() bool {
+	return os.Getenv("MACHINE_OFFLINE") != ""
+}
+
+// List returns the cached ISOs, newest release first
+func (c *ISOCache) List() ([]*CachedISO, error) {
+	m, err := c.loadManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	isos := []*CachedISO{}
+	for _, iso := range m.ISOs {
+		isos = append(isos, iso)
+	}
+	sort.Sort(isosByVersion(isos))
+	return isos, nil
+}
+
+// Get returns the cached ISO for version, which may be "latest", downloading
+// it first if it is not in the cache or fails verification
+func (c *ISOCache) Get(version string) (*CachedISO, error) {
+	return c.get(version, false)
+}
+
+// Pull downloads the ISO for version into the cache unless a verified copy
+// is already there. "latest" is always checked against GitHub.
+func (c *ISOCache) Pull(version string) (*CachedISO, error) {
+	return c.get(version, true)
+}
+
+func (c *ISOCache) get(version string, refresh bool) (*CachedISO, error) {
+	m, err := c.loadManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	if version == "" || version == "latest" {
+		version, err = c.resolveLatest(m, refresh)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if strings.ContainsAny(version, "/\\") || strings.HasPrefix(version, ".") {
+		return nil, fmt.Errorf("invalid boot2docker version %q", version)
+	}
+
+	if iso, ok := m.ISOs[version]; ok {
+		if err := c.verify(iso); err == nil {
+			return iso, nil
+		} else if c.Offline {
+			return nil, err
+		} else {
+			log.Warnf("%s, downloading it again", err)
+		}
+	}
+
+	if c.Offline {
+		return nil, fmt.Errorf("boot2docker %s is not in the cache and machine is offline", version)
+	}
+
+	iso, err := c.download(version)
+	if err != nil {
+		return nil, err
+	}
+
+	m.ISOs[version] = iso
+	if err := c.saveManifest(m); err != nil {
+		return nil, err
+	}
+	return iso, nil
+}
+
+// resolveLatest returns the latest release, asking GitHub at most once per
+// latestReleaseTTL. The newest cached release is used when offline or when
+// GitHub cannot be reached, e.g. because of its API rate limit.
+func (c *ISOCache) resolveLatest(m *isoManifest, refresh bool) (string, error) {
+	if !c.Offline {
+		if !refresh && m.Latest != "" && time.Since(m.LatestChecked) < latestReleaseTTL {
+			return m.Latest, nil
+		}
+
+		tag, err := c.b2d.GetLatestBoot2DockerReleaseTag()
+		if err == nil {
+			m.Latest = tag
+			m.LatestChecked = time.Now()
+			if err := c.saveManifest(m); err != nil {
+				return "", err
+			}
+			return tag, nil
+		}
+		log.Warnf("Unable to check for the latest release: %s", err)
+	}
+
+	isos := []*CachedISO{}
+	for _, iso := range m.ISOs {
+		isos = append(isos, iso)
+	}
+	if len(isos) == 0 {
+		return "", fmt.Errorf("no boot2docker release in the cache")
+	}
+	sort.Sort(isosByVersion(isos))
+	return isos[0].Version, nil
+}
+
+// Prune removes all but the keep newest releases from the cache, along with
+// the unversioned ISO of earlier versions of machine, and returns the
+// versions removed
+func (c *ISOCache) Prune(keep int) ([]string, error) {
+	isos, err := c.List()
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := c.loadManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	removed := []string{}
+	for i, iso := range isos {
+		if i < keep {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Dir(iso.Path)); err != nil {
+			return removed, err
+		}
+		delete(m.ISOs, iso.Version)
+		removed = append(removed, iso.Version)
+	}
+
+	if err := c.saveManifest(m); err != nil {
+		return removed, err
+	}
+
+	legacyISO := filepath.Join(filepath.Dir(c.Dir), isoFilename)
+	if err := os.Remove(legacyISO); err != nil && !os.IsNotExist(err) {
+		return removed, err
+	}
+
+	return removed, nil
+}
+
+func (c *ISOCache) download(version string) (*CachedISO, error) {
+	dir := filepath.Join(c.Dir, version)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	isoUrl := c.b2d.GetBoot2DockerReleaseURL(version)
+	log.Infof("Downloading boot2docker %s from %s...", version, isoUrl)
+	if err := c.b2d.DownloadISO(dir, isoFilename, isoUrl); err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(dir, isoFilename)
+	if err := verifyISOImage(path); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("downloaded boot2docker %s is invalid: %s", version, err)
+	}
+
+	sum, size, err := sha256File(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CachedISO{
+		Version:    version,
+		URL:        isoUrl,
+		SHA256:     sum,
+		Size:       size,
+		Downloaded: time.Now(),
+		Path:       path,
+	}, nil
+}
+
+// verify checks the cached ISO against the checksum in the manifest
+func (c *ISOCache) verify(iso *CachedISO) error {
+	sum, _, err := sha256File(iso.Path)
+	if err != nil {
+		return fmt.Errorf("cached boot2docker %s is unreadable: %s", iso.Version, err)
+	}
+	if sum != iso.SHA256 {
+		return fmt.Errorf("cached boot2docker %s does not match its checksum", iso.Version)
+	}
+	return nil
+}
+
+func (c *ISOCache) manifestPath() string {
+	return filepath.Join(c.Dir, isoManifestFilename)
+}
+
+func (c *ISOCache) loadManifest() (*isoManifest, error) {
+	m := &isoManifest{}
+
+	data, err := ioutil.ReadFile(c.manifestPath())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, m); err != nil {
+			return nil, fmt.Errorf("invalid cache manifest %s: %s", c.manifestPath(), err)
+		}
+	}
+
+	if m.ISOs == nil {
+		m.ISOs = make(map[string]*CachedISO)
+	}
+	for version, iso := range m.ISOs {
+		iso.Path = filepath.Join(c.Dir, version, isoFilename)
+	}
+	return m, nil
+}
+
+func (c *ISOCache) saveManifest(m *isoManifest) error {
+	if err := os.MkdirAll(c.Dir, 0700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(m, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	// write to a temp file first so that the manifest is never left truncated
+	f, err := ioutil.TempFile(c.Dir, isoManifestFilename+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), c.manifestPath())
+}
+
+func sha256File(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+// verifyISOImage checks for the ISO 9660 volume descriptor, so that e.g. an
+// HTML error page is not mistaken for an ISO
+func verifyISOImage(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	magic := make([]byte, 5)
+	if _, err := f.ReadAt(magic, 0x8001); err != nil {
+		return fmt.Errorf("not an ISO image")
+	}
+	if string(magic) != "CD001" {
+		return fmt.Errorf("not an ISO image")
+	}
+	return nil
+}
+
+type isosByVersion []*CachedISO
+
+func (s isosByVersion) Len() int {
+	return len(s)
+}
+
+func (s isosByVersion) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+func (s isosByVersion) Less(i, j int) bool {
+	return compareVersions(s[i].Version, s[j].Version) > 0
+}
+
+// compareVersions compares release tags such as "v1.5.0" and "1.6.0-rc1"
+// part by part, numerically where possible. A release sorts after its
+// release candidates.
+func compareVersions(a, b string) int {
+	split := func(v string) ([]string, string) {
+		v = strings.TrimPrefix(v, "v")
+		pre := ""
+		if i := strings.Index(v, "-"); i != -1 {
+			v, pre = v[:i], v[i+1:]
+		}
+		return strings.Split(v, "."), pre
+	}
+
+	aParts, aPre := split(a)
+	bParts, bPre := split(b)
+
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		var aPart, bPart string
+		if i < len(aParts) {
+			aPart = aParts[i]
+		}
+		if i < len(bParts) {
+			bPart = bParts[i]
+		}
+		if c := comparePart(aPart, bPart); c != 0 {
+			return c
+		}
+	}
+
+	switch {
+	case aPre == bPre:
+		return 0
+	case aPre == "":
+		return 1
+	case bPre == "":
+		return -1
+	}
+	return comparePart(aPre, bPre)
+}
+
+func comparePart(a, b string) int {
+	aNum, aErr := strconv.Atoi(a)
+	bNum, bErr := strconv.Atoi(b)
+	if aErr == nil && bErr == nil {
+		switch {
+		case aNum > bNum:
+			return 1
+		case aNum < bNum:
+			return -1
+		}
+		return 0
+	}
+	switch {
+	case a > b:
+		return 1
+	case a < b:
+		return -1
+	}
+	return 0
+}
@@ -0,0 +1,259 @@
+package utils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// testISO returns a minimal image with an ISO 9660 volume descriptor
+func testISO(version string) []byte {
+	data := make([]byte, 0x8010)
+	copy(data[0x8001:], "CD001")
+	copy(data, version)
+	return data
+}
+
+type testReleaseServer struct {
+	*httptest.Server
+	latest      string
+	apiRequests int
+}
+
+func newTestReleaseServer(latest string) *testReleaseServer {
+	s := &testReleaseServer{latest: latest}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/repos/boot2docker/boot2docker/releases" {
+			s.apiRequests++
+			if s.latest == "" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			fmt.Fprintf(w, `[{"tag_name": %q}]`, s.latest)
+			return
+		}
+		var version string
+		if _, err := fmt.Sscanf(r.URL.Path, "/boot2docker/boot2docker/releases/download/%s", &version); err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(testISO(filepath.Dir(version)))
+	}))
+	return s
+}
+
+func getTestISOCache(t *testing.T, s *testReleaseServer) *ISOCache {
+	dir, err := ioutil.TempDir("", "machine-cache-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := NewISOCache(dir, NewB2dUtils(s.URL, s.URL))
+	cache.Offline = false
+	return cache
+}
+
+func TestISOCacheGetLatest(t *testing.T) {
+	s := newTestReleaseServer("v1.5.0")
+	defer s.Close()
+	cache := getTestISOCache(t, s)
+	defer os.RemoveAll(filepath.Dir(cache.Dir))
+
+	iso, err := cache.Get("latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if iso.Version != "v1.5.0" {
+		t.Fatalf("expected v1.5.0; received %s", iso.Version)
+	}
+	if iso.Path != filepath.Join(cache.Dir, "v1.5.0", "boot2docker.iso") {
+		t.Fatalf("unexpected path %s", iso.Path)
+	}
+	if iso.SHA256 == "" {
+		t.Fatal("expected a checksum to be recorded")
+	}
+
+	// the latest release is remembered, so GitHub is not asked again
+	if _, err := cache.Get("latest"); err != nil {
+		t.Fatal(err)
+	}
+	if s.apiRequests != 1 {
+		t.Fatalf("expected 1 API request; received %d", s.apiRequests)
+	}
+
+	isos, err := cache.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(isos) != 1 || isos[0].Version != "v1.5.0" {
+		t.Fatalf("unexpected cached ISOs %v", isos)
+	}
+}
+
+func TestISOCacheRateLimited(t *testing.T) {
+	s := newTestReleaseServer("v1.5.0")
+	defer s.Close()
+	cache := getTestISOCache(t, s)
+	defer os.RemoveAll(filepath.Dir(cache.Dir))
+
+	if _, err := cache.Pull("v1.4.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// GitHub refuses to answer; the newest cached release is used
+	s.latest = ""
+	iso, err := cache.Get("latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if iso.Version != "v1.4.1" {
+		t.Fatalf("expected v1.4.1; received %s", iso.Version)
+	}
+}
+
+func TestISOCacheOffline(t *testing.T) {
+	s := newTestReleaseServer("v1.5.0")
+	defer s.Close()
+	cache := getTestISOCache(t, s)
+	defer os.RemoveAll(filepath.Dir(cache.Dir))
+
+	for _, version := range []string{"v1.4.1", "v1.5.0-rc1"} {
+		if _, err := cache.Pull(version); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cache.Offline = true
+	requests := s.apiRequests
+
+	iso, err := cache.Get("latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if iso.Version != "v1.5.0-rc1" {
+		t.Fatalf("expected v1.5.0-rc1; received %s", iso.Version)
+	}
+	if s.apiRequests != requests {
+		t.Fatal("expected no API requests when offline")
+	}
+
+	if _, err := cache.Get("v1.3.0"); err == nil {
+		t.Fatal("expected error getting an uncached release when offline")
+	}
+}
+
+func TestISOCacheVerify(t *testing.T) {
+	s := newTestReleaseServer("v1.5.0")
+	defer s.Close()
+	cache := getTestISOCache(t, s)
+	defer os.RemoveAll(filepath.Dir(cache.Dir))
+
+	iso, err := cache.Pull("v1.5.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(iso.Path, []byte("corrupt"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cache.Offline = true
+	if _, err := cache.Get("v1.5.0"); err == nil {
+		t.Fatal("expected error for a corrupt ISO when offline")
+	}
+
+	// a corrupt ISO is downloaded again
+	cache.Offline = false
+	iso, err = cache.Get("v1.5.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.verify(iso); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestISOCacheRejectsInvalidDownload(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html>rate limited</html>"))
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "machine-cache-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cache := NewISOCache(dir, NewB2dUtils(ts.URL, ts.URL))
+	cache.Offline = false
+	if _, err := cache.Pull("v1.5.0"); err == nil {
+		t.Fatal("expected error for a download which is not an ISO")
+	}
+	if _, err := os.Stat(filepath.Join(cache.Dir, "v1.5.0")); !os.IsNotExist(err) {
+		t.Fatal("expected the invalid download to be removed")
+	}
+}
+
+func TestISOCachePrune(t *testing.T) {
+	s := newTestReleaseServer("v1.5.0")
+	defer s.Close()
+	cache := getTestISOCache(t, s)
+	defer os.RemoveAll(filepath.Dir(cache.Dir))
+
+	for _, version := range []string{"v1.4.1", "v1.5.0", "v1.10.0"} {
+		if _, err := cache.Pull(version); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := cache.Prune(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(removed)
+	if len(removed) != 2 || removed[0] != "v1.4.1" || removed[1] != "v1.5.0" {
+		t.Fatalf("unexpected removed releases %v", removed)
+	}
+	if _, err := os.Stat(filepath.Join(cache.Dir, "v1.4.1")); !os.IsNotExist(err) {
+		t.Fatal("expected pruned release to be removed from disk")
+	}
+
+	isos, err := cache.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(isos) != 1 || isos[0].Version != "v1.10.0" {
+		t.Fatalf("unexpected cached ISOs after prune %v", isos)
+	}
+}
+
+func TestISOCacheInvalidVersion(t *testing.T) {
+	s := newTestReleaseServer("v1.5.0")
+	defer s.Close()
+	cache := getTestISOCache(t, s)
+	defer os.RemoveAll(filepath.Dir(cache.Dir))
+
+	if _, err := cache.Pull("../v1.5.0"); err == nil {
+		t.Fatal("expected error for a version outside of the cache")
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	ordered := []string{"v1.10.0", "v1.5.0", "1.5.0-rc2", "v1.5.0-rc1", "v1.4.1", "v1.4"}
+	for i := 0; i < len(ordered)-1; i++ {
+		if compareVersions(ordered[i], ordered[i+1]) <= 0 {
+			t.Fatalf("expected %s to be newer than %s", ordered[i], ordered[i+1])
+		}
+		if compareVersions(ordered[i+1], ordered[i]) >= 0 {
+			t.Fatalf("expected %s to be older than %s", ordered[i+1], ordered[i])
+		}
+	}
+	if compareVersions("v1.5.0", "1.5.0") != 0 {
+		t.Fatal("expected v prefix to be ignored")
+	}
+}
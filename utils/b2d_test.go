@@ -56,3 +56,13 @@ func TestDownloadIso(t *testing.T) {
 		t.Fatalf("expected data \"%s\"; received \"%s\"", testData, string(data))
 	}
 }
+
+func TestGetClientUsesProxyFromEnvironment(t *testing.T) {
+	transport, ok := getClient().Transport.(*http.Transport)
+	if !ok {
+		t.Fatal("expected an http.Transport")
+	}
+	if transport.Proxy == nil {
+		t.Fatal("expected the client to honor proxy environment variables")
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"fmt"
+	"io/ioutil"
 	"math/big"
 	"net"
 	"os"
@@ -149,3 +151,21 @@ func GenerateCert(hosts []string, certFile, keyFile, caFile, caKeyFile, org stri
 
 	return nil
 }
+
+// CertHasHost reports whether the certificate in certFile is valid for
+// host, which is an IP or a host name
+func CertHasHost(certFile string, host string) (bool, error) {
+	data, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return false, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return false, fmt.Errorf("no certificate found in %s", certFile)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return false, err
+	}
+	return cert.VerifyHostname(host) == nil, nil
+}
@@ -74,3 +74,32 @@ func TestGenerateCert(t *testing.T) {
 	// cleanup
 	_ = os.RemoveAll(tmpDir)
 }
+
+func TestCertHasHost(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	caCertPath := filepath.Join(tmpDir, "ca.pem")
+	caKeyPath := filepath.Join(tmpDir, "key.pem")
+	certPath := filepath.Join(tmpDir, "cert.pem")
+	keyPath := filepath.Join(tmpDir, "cert-key.pem")
+	if err := GenerateCACertificate(caCertPath, caKeyPath, "test-org", 2048); err != nil {
+		t.Fatal(err)
+	}
+	if err := GenerateCert([]string{"192.168.99.100"}, certPath, keyPath, caCertPath, caKeyPath, "test-org", 2048); err != nil {
+		t.Fatal(err)
+	}
+
+	for host, expected := range map[string]bool{"192.168.99.100": true, "192.168.99.101": false} {
+		has, err := CertHasHost(certPath, host)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if has != expected {
+			t.Fatalf("expected CertHasHost(%s) to be %t", host, expected)
+		}
+	}
+}
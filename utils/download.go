@@ -0,0 +1,307 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/docker/pkg/term"
+)
+
+var (
+	// number of attempts for a download and the wait before the first retry,
+	// which doubles with every attempt
+	downloadAttempts = 5
+	downloadBackoff  = time.Second * 2
+
+	// time without receiving any data after which a download is considered
+	// stalled and is resumed
+	downloadIdleTimeout = time.Second * 30
+)
+
+// permanentError is a download error which retrying will not fix
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+// localPath returns the path of a file:// URL or of a plain local path
+func localPath(location string) (string, bool) {
+	if strings.HasPrefix(location, "file://") {
+		u, err := url.Parse(location)
+		if err != nil {
+			return "", false
+		}
+		path := u.Path
+		// file:///C:/boot2docker.iso
+		if runtime.GOOS == "windows" && len(path) > 2 && path[0] == '/' && path[2] == ':' {
+			path = path[1:]
+		}
+		return filepath.FromSlash(path), true
+	}
+
+	u, err := url.Parse(location)
+	// a single letter scheme is a Windows drive, e.g. C:\boot2docker.iso
+	if err != nil || u.Scheme == "" || len(u.Scheme) == 1 {
+		return location, true
+	}
+	return "", false
+}
+
+// downloadFile fetches location, which may be an http(s) or file:// URL or a
+// local path, to dest. HTTP downloads go to dest.part first and are resumed
+// from there when they are interrupted, including by a previous run.
+func downloadFile(client *http.Client, location string, dest string) error {
+	if path, ok := localPath(location); ok {
+		return copyFileAtomic(path, dest)
+	}
+
+	part := dest + ".part"
+	wait := downloadBackoff
+
+	var err error
+	for attempt := 1; attempt <= downloadAttempts; attempt++ {
+		if err = downloadPart(client, location, part); err == nil {
+			os.Remove(validatorPath(part))
+			return os.Rename(part, dest)
+		}
+		if _, ok := err.(permanentError); ok || attempt == downloadAttempts {
+			break
+		}
+
+		log.Warnf("Download of %s interrupted: %s. Retrying in %s...", location, err, wait)
+		time.Sleep(wait)
+		wait *= 2
+	}
+	return fmt.Errorf("error downloading %s: %s", location, err)
+}
+
+// downloadPart downloads location into part, resuming from the end of part
+// with an HTTP range request if it already exists. The range is only served
+// if the file is still the one part was downloaded from, as identified by
+// the validator saved along with part.
+func downloadPart(client *http.Client, location string, part string) error {
+	var offset int64
+	validator := ""
+	if fi, err := os.Stat(part); err == nil {
+		if v, err := ioutil.ReadFile(validatorPath(part)); err == nil && len(v) > 0 {
+			offset, validator = fi.Size(), string(v)
+		}
+	}
+
+	req, err := http.NewRequest("GET", location, nil)
+	if err != nil {
+		return permanentError{err}
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", validator)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rsp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	body := newIdleReader(rsp.Body, downloadIdleTimeout, cancel)
+	defer body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch rsp.StatusCode {
+	case http.StatusPartialContent:
+		log.Debugf("resuming download of %s at %d bytes", location, offset)
+		flags |= os.O_APPEND
+	case http.StatusOK:
+		// the server ignored the range or the file changed; start over
+		offset = 0
+		flags |= os.O_TRUNC
+	case http.StatusRequestedRangeNotSatisfiable:
+		// the partial file does not belong to what is being served now
+		os.Remove(part)
+		os.Remove(validatorPath(part))
+		return fmt.Errorf("unexpected response: %s", rsp.Status)
+	default:
+		err := fmt.Errorf("unexpected response: %s", rsp.Status)
+		if rsp.StatusCode >= 400 && rsp.StatusCode < 500 {
+			return permanentError{err}
+		}
+		return err
+	}
+
+	// without a validator, a partial download cannot be resumed safely
+	if v := rangeValidator(rsp); v != "" {
+		if err := ioutil.WriteFile(validatorPath(part), []byte(v), 0600); err != nil {
+			return permanentError{err}
+		}
+	} else {
+		os.Remove(validatorPath(part))
+	}
+
+	f, err := os.OpenFile(part, flags, 0600)
+	if err != nil {
+		return permanentError{err}
+	}
+	defer f.Close()
+
+	total := int64(-1)
+	if rsp.ContentLength >= 0 {
+		total = offset + rsp.ContentLength
+	}
+	progress := newDownloadProgress(filepath.Base(location), offset, total)
+	defer progress.Done()
+
+	n, err := io.Copy(f, io.TeeReader(body, progress))
+	if err != nil {
+		return err
+	}
+	if rsp.ContentLength >= 0 && n < rsp.ContentLength {
+		return io.ErrUnexpectedEOF
+	}
+	return f.Close()
+}
+
+// validatorPath returns the path of the file holding the validator of a
+// partial download
+func validatorPath(part string) string {
+	return part + ".validator"
+}
+
+// rangeValidator returns the value identifying the file served by rsp in
+// an If-Range header: its strong ETag or else its modification date
+func rangeValidator(rsp *http.Response) string {
+	if etag := rsp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return rsp.Header.Get("Last-Modified")
+}
+
+// idleReader reads a response body and cancels its request once no data
+// was received for timeout, so that a stalled download fails instead of
+// blocking forever
+type idleReader struct {
+	body    io.ReadCloser
+	timeout time.Duration
+	timer   *time.Timer
+	expired int32
+}
+
+func newIdleReader(body io.ReadCloser, timeout time.Duration, cancel func()) *idleReader {
+	r := &idleReader{body: body, timeout: timeout}
+	r.timer = time.AfterFunc(timeout, func() {
+		atomic.StoreInt32(&r.expired, 1)
+		cancel()
+	})
+	return r
+}
+
+func (r *idleReader) Read(b []byte) (int, error) {
+	n, err := r.body.Read(b)
+	if atomic.LoadInt32(&r.expired) == 1 {
+		return n, fmt.Errorf("no data received for %s", r.timeout)
+	}
+	if n > 0 {
+		r.timer.Reset(r.timeout)
+	}
+	return n, err
+}
+
+func (r *idleReader) Close() error {
+	r.timer.Stop()
+	return r.body.Close()
+}
+
+// copyFileAtomic copies src to a temp file next to dst and then renames it,
+// so that dst is never left incomplete
+func copyFileAtomic(src, dst string) error {
+	tmp := dst + ".tmp"
+	if err := CopyFile(src, tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+// downloadProgress reports the progress of a download: a progress bar on a
+// terminal and a log line every 10% otherwise
+type downloadProgress struct {
+	name     string
+	current  int64
+	total    int64
+	tty      bool
+	out      io.Writer
+	reported int64
+}
+
+func newDownloadProgress(name string, current, total int64) *downloadProgress {
+	return &downloadProgress{
+		name:    name,
+		current: current,
+		total:   total,
+		tty:     term.IsTerminal(os.Stderr.Fd()),
+		out:     os.Stderr,
+	}
+}
+
+func (p *downloadProgress) Write(b []byte) (int, error) {
+	p.current += int64(len(b))
+	p.report()
+	return len(b), nil
+}
+
+func (p *downloadProgress) report() {
+	if p.tty {
+		fmt.Fprintf(p.out, "\r%s", p.bar())
+		return
+	}
+
+	// log every 10% or, if the size is unknown, every 10MB
+	step := int64(10 * 1024 * 1024)
+	if p.total > 0 {
+		step = p.total / 10
+	}
+	if step > 0 && p.current-p.reported >= step {
+		p.reported = p.current
+		log.Infof("%s: %s", p.name, p.status())
+	}
+}
+
+// Done finishes the progress bar so that later output starts on a new line
+func (p *downloadProgress) Done() {
+	if p.tty {
+		fmt.Fprintln(p.out)
+	}
+}
+
+func (p *downloadProgress) status() string {
+	if p.total <= 0 {
+		return fmt.Sprintf("%.1f MB", float64(p.current)/1024/1024)
+	}
+	return fmt.Sprintf("%.1f MB / %.1f MB (%d%%)",
+		float64(p.current)/1024/1024, float64(p.total)/1024/1024, p.current*100/p.total)
+}
+
+func (p *downloadProgress) bar() string {
+	const width = 40
+	if p.total <= 0 {
+		return p.status()
+	}
+	done := int(p.current * width / p.total)
+	if done > width {
+		done = width
+	}
+	return fmt.Sprintf("[%s%s] %s", strings.Repeat("=", done), strings.Repeat(" ", width-done), p.status())
+}
@@ -0,0 +1,280 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func getTestDownloadDir(t *testing.T) string {
+	downloadBackoff = time.Millisecond
+	dir, err := ioutil.TempDir("", "machine-download-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestDownloadFileResume(t *testing.T) {
+	dir := getTestDownloadDir(t)
+	defer os.RemoveAll(dir)
+
+	content := bytes.Repeat([]byte("boot2docker"), 1000)
+	ranges := []string{}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		w.Header().Set("ETag", `"v1"`)
+
+		if len(ranges) == 1 {
+			// drop the connection halfway through the first attempt
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Write(content[:len(content)/2])
+			return
+		}
+
+		var offset int
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &offset); err != nil {
+			t.Errorf("expected a range request; received %q", r.Header.Get("Range"))
+		}
+		if r.Header.Get("If-Range") != `"v1"` {
+			t.Errorf("expected the range to depend on the ETag; received %q", r.Header.Get("If-Range"))
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, len(content)-1, len(content)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(content[offset:])
+	}))
+	defer ts.Close()
+
+	dest := filepath.Join(dir, "boot2docker.iso")
+	if err := downloadFile(getClient(), ts.URL+"/boot2docker.iso", dest); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Fatal("downloaded file does not match")
+	}
+
+	if len(ranges) != 2 || ranges[1] != fmt.Sprintf("bytes=%d-", len(content)/2) {
+		t.Fatalf("unexpected range requests %v", ranges)
+	}
+
+	for _, path := range []string{dest + ".part", dest + ".part.validator"} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("expected %s to be removed", path)
+		}
+	}
+}
+
+func TestDownloadFileStalled(t *testing.T) {
+	dir := getTestDownloadDir(t)
+	defer os.RemoveAll(dir)
+	saved := downloadIdleTimeout
+	downloadIdleTimeout = 100 * time.Millisecond
+	defer func() { downloadIdleTimeout = saved }()
+
+	content := bytes.Repeat([]byte("boot2docker"), 1000)
+	requests := 0
+	stalled := make(chan struct{})
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Last-Modified", "Mon, 01 Jun 2015 00:00:00 GMT")
+		if requests == 1 {
+			// send half of the file and then nothing, keeping the connection open
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Write(content[:len(content)/2])
+			w.(http.Flusher).Flush()
+			<-stalled
+			return
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", len(content)/2, len(content)-1, len(content)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(content[len(content)/2:])
+	}))
+	defer ts.Close()
+	defer close(stalled)
+
+	dest := filepath.Join(dir, "boot2docker.iso")
+	if err := downloadFile(getClient(), ts.URL, dest); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Fatal("downloaded file does not match")
+	}
+	if requests != 2 {
+		t.Fatalf("expected the stalled download to be resumed; received %d requests", requests)
+	}
+}
+
+func TestDownloadFileChanged(t *testing.T) {
+	dir := getTestDownloadDir(t)
+	defer os.RemoveAll(dir)
+
+	dest := filepath.Join(dir, "boot2docker.iso")
+	if err := ioutil.WriteFile(dest+".part", []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(dest+".part.validator", []byte(`"v1"`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v2"`)
+		// the validator does not match, so the whole new file is served
+		if r.Header.Get("If-Range") != `"v1"` {
+			t.Errorf("expected If-Range \"v1\"; received %q", r.Header.Get("If-Range"))
+		}
+		w.Write([]byte("new release"))
+	}))
+	defer ts.Close()
+
+	if err := downloadFile(getClient(), ts.URL, dest); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "new release" {
+		t.Fatalf("expected the new file only; received %q", data)
+	}
+}
+
+func TestDownloadFileRangeIgnored(t *testing.T) {
+	dir := getTestDownloadDir(t)
+	defer os.RemoveAll(dir)
+
+	dest := filepath.Join(dir, "boot2docker.iso")
+	if err := ioutil.WriteFile(dest+".part", []byte("stale"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("complete"))
+	}))
+	defer ts.Close()
+
+	if err := downloadFile(getClient(), ts.URL, dest); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "complete" {
+		t.Fatalf("expected the download to start over; received %q", data)
+	}
+}
+
+func TestDownloadFileNotFound(t *testing.T) {
+	dir := getTestDownloadDir(t)
+	defer os.RemoveAll(dir)
+
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	if err := downloadFile(getClient(), ts.URL, filepath.Join(dir, "boot2docker.iso")); err == nil {
+		t.Fatal("expected error for a missing file")
+	}
+	if requests != 1 {
+		t.Fatalf("expected no retries for a missing file; received %d requests", requests)
+	}
+}
+
+func TestDownloadFileRetries(t *testing.T) {
+	dir := getTestDownloadDir(t)
+	defer os.RemoveAll(dir)
+
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	if err := downloadFile(getClient(), ts.URL, filepath.Join(dir, "boot2docker.iso")); err == nil {
+		t.Fatal("expected error")
+	}
+	if requests != downloadAttempts {
+		t.Fatalf("expected %d attempts; received %d", downloadAttempts, requests)
+	}
+}
+
+func TestDownloadFileLocal(t *testing.T) {
+	dir := getTestDownloadDir(t)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "local.iso")
+	if err := ioutil.WriteFile(src, []byte("local"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, location := range []string{src, "file://" + filepath.ToSlash(src)} {
+		dest := filepath.Join(dir, fmt.Sprintf("boot2docker-%d.iso", i))
+		if err := downloadFile(getClient(), location, dest); err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadFile(dest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "local" {
+			t.Fatalf("%s: unexpected content %q", location, data)
+		}
+	}
+}
+
+func TestLocalPath(t *testing.T) {
+	if _, ok := localPath("https://github.com/boot2docker.iso"); ok {
+		t.Fatal("expected https URL not to be local")
+	}
+	if path, ok := localPath("file:///tmp/boot2docker.iso"); !ok || path != filepath.FromSlash("/tmp/boot2docker.iso") {
+		t.Fatalf("unexpected path %q for file:// URL", path)
+	}
+	if _, ok := localPath(`C:\Users\test\boot2docker.iso`); !ok {
+		t.Fatal("expected Windows path to be local")
+	}
+}
+
+func TestDownloadProgress(t *testing.T) {
+	out := &bytes.Buffer{}
+	p := &downloadProgress{name: "boot2docker.iso", total: 10 * 1024 * 1024, tty: true, out: out}
+
+	p.Write(make([]byte, 5*1024*1024))
+	if !strings.Contains(out.String(), "5.0 MB / 10.0 MB (50%)") {
+		t.Fatalf("unexpected progress %q", out.String())
+	}
+	if !strings.Contains(out.String(), "["+strings.Repeat("=", 20)+strings.Repeat(" ", 20)+"]") {
+		t.Fatalf("unexpected progress bar %q", out.String())
+	}
+
+	unknown := &downloadProgress{total: -1}
+	unknown.Write(make([]byte, 1024*1024))
+	if unknown.status() != "1.0 MB" {
+		t.Fatalf("unexpected status %q", unknown.status())
+	}
+}